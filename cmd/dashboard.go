@@ -0,0 +1,79 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/api"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/dashboard"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// dashboardCmd represents the dashboard command
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard [datafile...]",
+	Short: "Serves a web dashboard over fetched data",
+	Long: `Serves a web dashboard over fetched data.
+
+The page shows request volume over time, the status mix, the cache hit
+ratio, top countries on a map and the top URIs. It is embedded in the binary
+and loads nothing from the network, so it works offline. Filters are kept in
+the page URL, so a copied link opens the same view.
+
+Records come from the same stores as serve, and the JSON API is served
+alongside the page.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serveDashboard(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dashboardCmd)
+
+	addStoreFlags(dashboardCmd.Flags())
+
+	dashboardCmd.Flags().String("listen", "localhost:8080", "Address to listen on")
+	viper.BindPFlag("listen", dashboardCmd.Flags().Lookup("listen"))
+}
+
+func serveDashboard(args []string) error {
+	s, source, err := openStore(args)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	server, err := api.New(
+		api.SetStore(s),
+		api.SetLog(log),
+	)
+	if err != nil {
+		return err
+	}
+
+	return listenAndServe(dashboard.Handler(server.Handler()), source)
+}
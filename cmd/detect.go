@@ -0,0 +1,47 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// detectCmd represents the detect command
+var detectCmd = &cobra.Command{
+	Use:   "detect",
+	Short: "Flags unusual traffic in fetched data files or a Trino window",
+	Long: `Flags unusual traffic in fetched data files or a Trino window.
+
+Records are read the same way as the report commands: from data files given
+as arguments, from --datafile, or streamed from Trino with --trino.`,
+}
+
+func init() {
+	rootCmd.AddCommand(detectCmd)
+
+	addInputFlags(detectCmd.PersistentFlags())
+
+	detectCmd.PersistentFlags().String("output", report.OutputTable, "Output format (table, json, csv)")
+	viper.BindPFlag("output", detectCmd.PersistentFlags().Lookup("output"))
+}
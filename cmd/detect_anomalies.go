@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/anomaly"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// detectAnomaliesCmd represents the detect anomalies command
+var detectAnomaliesCmd = &cobra.Command{
+	Use:   "anomalies [datafile...]",
+	Short: "Flags spikes in requests, bytes and error rates",
+	Long: `Flags spikes in requests, bytes and error rates.
+
+Requests are counted per time bucket for every value of each --by dimension.
+Each bucket is compared with a rolling baseline of the buckets before it,
+either the median and median absolute deviation of the last --window buckets
+(mad) or an exponentially weighted moving average (ewma). Buckets scoring
+--threshold or more deviations above the baseline are listed with the
+clients and URIs that contributed most to them.
+
+Only the --max-series busiest values of each dimension are scored, so a
+high-cardinality dimension such as uri_stem stays affordable over long ranges.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := detectAnomalies(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	detectCmd.AddCommand(detectAnomaliesCmd)
+
+	detectAnomaliesCmd.Flags().StringSlice("by", []string{"host", "country"}, "Dimensions to build series for ("+strings.Join(report.DimensionNames(), ", ")+")")
+	viper.BindPFlag("by", detectAnomaliesCmd.Flags().Lookup("by"))
+
+	detectAnomaliesCmd.Flags().Duration("bucket", anomaly.DefaultBucket, "Time bucket size")
+	viper.BindPFlag("bucket", detectAnomaliesCmd.Flags().Lookup("bucket"))
+
+	detectAnomaliesCmd.Flags().String("method", anomaly.MethodMAD, "Baseline method (mad, ewma)")
+	viper.BindPFlag("method", detectAnomaliesCmd.Flags().Lookup("method"))
+
+	detectAnomaliesCmd.Flags().Int("window", anomaly.DefaultWindow, "Buckets in the rolling baseline")
+	viper.BindPFlag("window", detectAnomaliesCmd.Flags().Lookup("window"))
+
+	detectAnomaliesCmd.Flags().Float64("alpha", anomaly.DefaultAlpha, "EWMA smoothing factor")
+	viper.BindPFlag("alpha", detectAnomaliesCmd.Flags().Lookup("alpha"))
+
+	detectAnomaliesCmd.Flags().Float64("threshold", anomaly.DefaultThreshold, "Deviations above the baseline that flag a bucket")
+	viper.BindPFlag("threshold", detectAnomaliesCmd.Flags().Lookup("threshold"))
+
+	detectAnomaliesCmd.Flags().Int64("min-requests", anomaly.DefaultMinRequests, "Fewest requests in a bucket for it to be flagged")
+	viper.BindPFlag("min-requests", detectAnomaliesCmd.Flags().Lookup("min-requests"))
+
+	detectAnomaliesCmd.Flags().Int("top", anomaly.DefaultTop, "Contributing clients and URIs listed per anomaly")
+	viper.BindPFlag("top", detectAnomaliesCmd.Flags().Lookup("top"))
+
+	detectAnomaliesCmd.Flags().Int("max-series", anomaly.DefaultMaxSeries, "Busiest values of each dimension to score")
+	viper.BindPFlag("max-series", detectAnomaliesCmd.Flags().Lookup("max-series"))
+}
+
+func detectAnomalies(args []string) error {
+	dims, err := report.LookupDimensions(viper.GetStringSlice("by"))
+	if err != nil {
+		return err
+	}
+
+	detector, err := anomaly.New(
+		anomaly.SetDimensions(dims...),
+		anomaly.SetBucket(viper.GetDuration("bucket")),
+		anomaly.SetMethod(viper.GetString("method")),
+		anomaly.SetWindow(viper.GetInt("window")),
+		anomaly.SetAlpha(viper.GetFloat64("alpha")),
+		anomaly.SetThreshold(viper.GetFloat64("threshold")),
+		anomaly.SetMinRequests(viper.GetInt64("min-requests")),
+		anomaly.SetTop(viper.GetInt("top")),
+		anomaly.SetMaxSeries(viper.GetInt("max-series")),
+	)
+	if err != nil {
+		return err
+	}
+
+	return runReport(args, detector)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/scanner"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// detectScannersCmd represents the detect scanners command
+var detectScannersCmd = &cobra.Command{
+	Use:   "scanners [datafile...]",
+	Short: "Finds clients exceeding request rates, collecting 404s or probing exploit paths",
+	Long: `Finds clients exceeding request rates, collecting 404s or probing exploit paths.
+
+Clients are single addresses by default; --ipv4-prefix 24 and --ipv6-prefix 64
+group them into networks. Flagged clients are ranked with the evidence that
+flagged them, and --blocklist writes their CIDRs as plain text or as an AWS WAF
+IP set (--blocklist-format waf). WAF IP sets hold one IP version, so IPv6
+networks go to a second file with -ipv6 added to the name.
+
+Each limit exceeded and each distinct exploit path probed is a rule hit. Only
+clients with --block-min-hits rule hits or more are written to the blocklist,
+so a lone request for a scanner path does not block a real visitor.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := detectScanners(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	detectCmd.AddCommand(detectScannersCmd)
+
+	detectScannersCmd.Flags().Int("ipv4-prefix", 32, "IPv4 prefix length to group clients by")
+	viper.BindPFlag("ipv4-prefix", detectScannersCmd.Flags().Lookup("ipv4-prefix"))
+
+	detectScannersCmd.Flags().Int("ipv6-prefix", 128, "IPv6 prefix length to group clients by")
+	viper.BindPFlag("ipv6-prefix", detectScannersCmd.Flags().Lookup("ipv6-prefix"))
+
+	detectScannersCmd.Flags().Duration("window", scanner.DefaultWindow, "Window the request limit applies to")
+	viper.BindPFlag("window", detectScannersCmd.Flags().Lookup("window"))
+
+	detectScannersCmd.Flags().Int64("max-requests", scanner.DefaultMaxRequests, "Most requests a client may make in one window")
+	viper.BindPFlag("max-requests", detectScannersCmd.Flags().Lookup("max-requests"))
+
+	detectScannersCmd.Flags().Int("max-404", scanner.DefaultMax404, "Most distinct URIs a client may get a 404 for")
+	viper.BindPFlag("max-404", detectScannersCmd.Flags().Lookup("max-404"))
+
+	detectScannersCmd.Flags().StringSlice("exploit-path", nil, "Extra exploit paths to match, in addition to the built-in list (a leading / anchors the path; a trailing / or * matches a prefix)")
+	viper.BindPFlag("exploit-path", detectScannersCmd.Flags().Lookup("exploit-path"))
+
+	detectScannersCmd.Flags().String("blocklist", "", "Write the flagged networks to this file")
+	viper.BindPFlag("blocklist", detectScannersCmd.Flags().Lookup("blocklist"))
+
+	detectScannersCmd.Flags().Int("block-min-hits", scanner.DefaultMinHits, "Fewest rule hits for a client to be written to the blocklist")
+	viper.BindPFlag("block-min-hits", detectScannersCmd.Flags().Lookup("block-min-hits"))
+
+	detectScannersCmd.Flags().String("blocklist-format", scanner.BlocklistText, "Blocklist format (text, waf)")
+	viper.BindPFlag("blocklist-format", detectScannersCmd.Flags().Lookup("blocklist-format"))
+
+	detectScannersCmd.Flags().String("waf-name", "rtl-blocklist", "Name of the WAF IP set")
+	viper.BindPFlag("waf-name", detectScannersCmd.Flags().Lookup("waf-name"))
+
+	detectScannersCmd.Flags().String("waf-scope", scanner.ScopeCloudFront, "Scope of the WAF IP set (CLOUDFRONT, REGIONAL)")
+	viper.BindPFlag("waf-scope", detectScannersCmd.Flags().Lookup("waf-scope"))
+}
+
+func detectScanners(args []string) error {
+	format := viper.GetString("blocklist-format")
+	if format != scanner.BlocklistText && format != scanner.BlocklistWAF {
+		return fmt.Errorf("unknown blocklist format %q", format)
+	}
+
+	detector, err := scanner.New(
+		scanner.SetPrefixes(viper.GetInt("ipv4-prefix"), viper.GetInt("ipv6-prefix")),
+		scanner.SetWindow(viper.GetDuration("window")),
+		scanner.SetMaxRequests(viper.GetInt64("max-requests")),
+		scanner.SetMax404(viper.GetInt("max-404")),
+		scanner.SetExploitPaths(append(scanner.DefaultExploitPaths, viper.GetStringSlice("exploit-path")...)),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = eachRecord(args, func(record *rtl.Record) error {
+		detector.Add(record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := report.Render(os.Stdout, viper.GetString("output"), detector); err != nil {
+		return err
+	}
+
+	if path := viper.GetString("blocklist"); path != "" {
+		return writeBlocklist(path, format, detector.Flagged())
+	}
+	return nil
+}
+
+// writeBlocklist writes the flagged networks to path
+func writeBlocklist(path, format string, clients []scanner.Client) error {
+	v4, v6 := scanner.Blocklist(clients, viper.GetInt("block-min-hits"))
+
+	if format == scanner.BlocklistText {
+		return writeFile(path, func(f *os.File) error {
+			return scanner.WriteText(f, append(v4, v6...))
+		})
+	}
+
+	name := viper.GetString("waf-name")
+	scope := viper.GetString("waf-scope")
+	if len(v6) > 0 {
+		ext := filepath.Ext(path)
+		v6Path := strings.TrimSuffix(path, ext) + "-ipv6" + ext
+		err := writeFile(v6Path, func(f *os.File) error {
+			return scanner.WriteWAF(f, name+"-ipv6", scope, v6)
+		})
+		if err != nil {
+			return err
+		}
+		if len(v4) == 0 {
+			return nil
+		}
+	}
+	return writeFile(path, func(f *os.File) error {
+		return scanner.WriteWAF(f, name, scope, v4)
+	})
+}
+
+// writeFile creates path, calls fn to fill it and logs the result
+func writeFile(path string, fn func(f *os.File) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"file": path,
+	}).Info("Wrote blocklist")
+	return nil
+}
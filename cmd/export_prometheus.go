@@ -0,0 +1,205 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/metrics"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// exportPrometheusCmd represents the export prometheus command
+var exportPrometheusCmd = &cobra.Command{
+	Use:   "prometheus [datafile...]",
+	Short: "Exports request, byte and time taken aggregates as Prometheus metrics",
+	Long: `Exports request, byte and time taken aggregates as Prometheus metrics.
+
+Metrics:
+  cloudfront_rtl_requests_total{host,status,edge_location,cache_result}
+  cloudfront_rtl_response_bytes_total{host,status,edge_location,cache_result}
+  cloudfront_rtl_time_taken_seconds{host} (histogram)
+  cloudfront_rtl_last_request_timestamp_seconds
+
+With --listen the metrics are served on /metrics, in OpenMetrics when the
+scraper asks for it. With --textfile they are written to a file for the
+node_exporter textfile collector; the file is replaced atomically. The
+textfile collector reads the Prometheus text format, so that is the default
+--metrics-format; use openmetrics for other consumers.
+
+With --refresh the input is read again on that interval and the metrics
+replaced, which suits data files that fetch --incremental keeps appending to.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := exportPrometheus(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportPrometheusCmd)
+
+	exportPrometheusCmd.Flags().String("listen", "", "Serve /metrics on this address (e.g. :9400)")
+	viper.BindPFlag("listen", exportPrometheusCmd.Flags().Lookup("listen"))
+
+	exportPrometheusCmd.Flags().String("textfile", "", "Write the metrics to this file (e.g. /var/lib/node_exporter/textfile/rtl.prom)")
+	viper.BindPFlag("textfile", exportPrometheusCmd.Flags().Lookup("textfile"))
+
+	exportPrometheusCmd.Flags().String("metrics-format", metrics.FormatText, "Textfile format (text, openmetrics)")
+	viper.BindPFlag("metrics-format", exportPrometheusCmd.Flags().Lookup("metrics-format"))
+
+	exportPrometheusCmd.Flags().String("namespace", metrics.DefaultNamespace, "Prefix of every metric name")
+	viper.BindPFlag("namespace", exportPrometheusCmd.Flags().Lookup("namespace"))
+
+	buckets := make([]string, len(metrics.DefaultBuckets))
+	for i, b := range metrics.DefaultBuckets {
+		buckets[i] = strconv.FormatFloat(b, 'g', -1, 64)
+	}
+	exportPrometheusCmd.Flags().StringSlice("buckets", buckets, "Time taken histogram bounds in seconds")
+	viper.BindPFlag("buckets", exportPrometheusCmd.Flags().Lookup("buckets"))
+
+	exportPrometheusCmd.Flags().Duration("refresh", 0, "Read the input again on this interval (0 to read it once)")
+	viper.BindPFlag("refresh", exportPrometheusCmd.Flags().Lookup("refresh"))
+}
+
+func exportPrometheus(args []string) error {
+	listen := viper.GetString("listen")
+	textfile := viper.GetString("textfile")
+	format := viper.GetString("metrics-format")
+	refresh := viper.GetDuration("refresh")
+	if listen == "" && textfile == "" {
+		return fmt.Errorf("listen or textfile is required")
+	}
+	if format != metrics.FormatText && format != metrics.FormatOpenMetrics {
+		return fmt.Errorf("unknown metrics format %q", format)
+	}
+	if refresh < 0 {
+		return fmt.Errorf("refresh must not be negative")
+	}
+	var buckets []float64
+	for _, b := range viper.GetStringSlice("buckets") {
+		bound, err := strconv.ParseFloat(b, 64)
+		if err != nil {
+			return fmt.Errorf("buckets: %w", err)
+		}
+		buckets = append(buckets, bound)
+	}
+
+	// update reads the input into a fresh set of metrics
+	update := func() (*metrics.Config, error) {
+		m, err := metrics.New(
+			metrics.SetNamespace(viper.GetString("namespace")),
+			metrics.SetBuckets(buckets),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := eachRecord(args, func(record *rtl.Record) error {
+			m.Add(record)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if textfile != "" {
+			if err := m.WriteFile(textfile, format); err != nil {
+				return nil, err
+			}
+			log.WithFields(logrus.Fields{
+				"file": textfile,
+			}).Debug("Wrote metrics")
+		}
+		return m, nil
+	}
+
+	m, err := update()
+	if err != nil {
+		return err
+	}
+	if listen == "" && refresh == 0 {
+		log.WithFields(logrus.Fields{
+			"file": textfile,
+		}).Info("Wrote metrics")
+		return nil
+	}
+
+	var current atomic.Pointer[metrics.Config]
+	current.Store(m)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if refresh > 0 {
+		go func() {
+			ticker := time.NewTicker(refresh)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				m, err := update()
+				if err != nil {
+					// keep serving the last good metrics
+					log.WithFields(logrus.Fields{
+						"error": err,
+					}).Error("error refreshing metrics")
+					continue
+				}
+				current.Store(m)
+			}
+		}()
+	}
+
+	if listen == "" {
+		<-ctx.Done()
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current.Load().ServeHTTP(w, r)
+	}))
+	source := "trino"
+	if !viper.GetBool("trino") {
+		files, err := inputFiles(args)
+		if err != nil {
+			return err
+		}
+		source = strings.Join(files, ",")
+	}
+	return listenAndServe(mux, source)
+}
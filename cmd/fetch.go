@@ -22,20 +22,18 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"encoding/gob"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net"
-	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/checkpoint"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/chunk"
 	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
-	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/mysql"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/pipeline"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/reader"
 	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
-	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/writer"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -44,7 +42,30 @@ import (
 // fetchCmd represents the fetch command
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
-	Short: "Fetches data from Trino and writes it to a gob file for furthe processing",
+	Short: "Fetches data from Trino and writes it to a data file for further processing",
+	Long: `Fetches data from Trino and writes it to a data file for further processing.
+
+With --incremental, fetch starts --lookback before the newest record recorded
+in a checkpoint file for the hostname, appends to the data file (ndjson or
+csv) or upserts into the database sink, and moves the checkpoint forward once
+the records are written. Run it from cron to keep a data file current.
+CloudFront delivers records out of order, so the lookback picks up records
+that arrived after newer ones were fetched. Records the previous run already
+wrote are skipped, using the edge request IDs kept in the checkpoint.
+
+File output is written to a temporary file and only replaces the data file
+once complete. Ranges longer than --chunk are fetched one chunk at a time
+into <datafile>.parts, each chunk committed as it completes; if the fetch
+is interrupted, rerunning it without --from/--to resumes from the first
+incomplete chunk.
+
+With --source rtl:path, entries are read from the CloudFront real-time log
+files Kinesis Data Firehose delivers (plain or gzipped) instead of Trino.
+
+--fields lists the fields of the real-time log configuration, in the order
+CloudFront writes them. It decides the columns selected from Trino and the
+layout of log file lines; fields without a typed record field are kept in
+the record's "extra" object in JSON and gob output.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Catch errors
 		var err error
@@ -66,249 +87,299 @@ var fetchCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(fetchCmd)
 
-	fetchCmd.PersistentFlags().StringP("trinodsn", "d", "", "Trino DNS")
-	viper.BindPFlag("trinodsn", fetchCmd.Flags().Lookup("dsn"))
+	fetchCmd.PersistentFlags().StringP("datafile", "o", "", "Output file")
+	viper.BindPFlag("datafile", fetchCmd.PersistentFlags().Lookup("datafile"))
 
-	fetchCmd.PersistentFlags().StringP("geoipdb", "g", "", "Path to GeoIP database")
-	viper.BindPFlag("geoipdb", fetchCmd.Flags().Lookup("geoip"))
+	fetchCmd.PersistentFlags().String("sink", "file", "Where to write records (file, mysql, sqlite:path.db)")
+	viper.BindPFlag("sink", fetchCmd.PersistentFlags().Lookup("sink"))
 
-	fetchCmd.PersistentFlags().StringP("datafile", "o", "", "GOB Output file")
-	viper.BindPFlag("datafile", fetchCmd.Flags().Lookup("datafile"))
+	fetchCmd.PersistentFlags().String("mysqldsn", "", "MySQL DSN for the mysql sink")
+	viper.BindPFlag("mysqldsn", fetchCmd.PersistentFlags().Lookup("mysqldsn"))
 
-	fetchCmd.PersistentFlags().StringP("hostname", "n", "", "Hostname to query")
-	viper.BindPFlag("hostname", fetchCmd.Flags().Lookup("hostname"))
-}
+	fetchCmd.PersistentFlags().Int("batch-size", mysql.DefaultBatchSize, "Records per database transaction")
+	viper.BindPFlag("batch-size", fetchCmd.PersistentFlags().Lookup("batch-size"))
 
-func fetchData() error {
-	trinodns := viper.GetString("trinodsn")
-	if trinodns == "" {
-		return fmt.Errorf("trinodsn is required")
-	}
+	fetchCmd.PersistentFlags().StringP("format", "f", "", "Output format (json, ndjson, csv, gob, parquet; default from the datafile extension)")
+	viper.BindPFlag("format", fetchCmd.PersistentFlags().Lookup("format"))
 
-	geoipdb := viper.GetString("geoipdb")
-	if geoipdb == "" {
-		return fmt.Errorf("geoipdb is required")
-	}
+	fetchCmd.PersistentFlags().Duration("chunk", 24*time.Hour, "Fetch file output in chunks of this size that survive an interruption (0 to fetch in one query)")
+	viper.BindPFlag("chunk", fetchCmd.PersistentFlags().Lookup("chunk"))
 
-	datafile := viper.GetString("datafile")
-	if datafile == "" {
-		return fmt.Errorf("datafile is required")
-	}
+	fetchCmd.PersistentFlags().Bool("incremental", false, "Fetch only rows newer than the checkpoint and append them to the output")
+	viper.BindPFlag("incremental", fetchCmd.PersistentFlags().Lookup("incremental"))
 
-	hostname := viper.GetString("hostname")
-	if hostname == "" {
-		return fmt.Errorf("hostname is required")
-	}
+	fetchCmd.PersistentFlags().String("checkpoint", "", "Checkpoint file for --incremental (default <datafile>.checkpoint.json)")
+	viper.BindPFlag("checkpoint", fetchCmd.PersistentFlags().Lookup("checkpoint"))
 
-	log.WithFields(logrus.Fields{
-		"trinodsn": trinodns,
-		"geoipdb":  geoipdb,
-		"datafile": datafile,
-		"hostname": hostname,
-	}).Debug("fetching data")
+	fetchCmd.PersistentFlags().Duration("lookback", checkpoint.DefaultLookback, "How far before the newest checkpointed record --incremental resumes, for records that arrive late")
+	viper.BindPFlag("lookback", fetchCmd.PersistentFlags().Lookup("lookback"))
 
-	geo, err := geoip.New(geoip.SetGeoDB(geoipdb))
-	if err != nil {
-		return err
-	}
+	addTrinoFlags(fetchCmd.PersistentFlags())
 
-	// Get a new Trino database connection
-	trino, err := fetch.New(fetch.SetDSN(trinodns))
-	if err != nil {
-		return err
-	}
-	defer trino.Close()
-
-	log.Debug("Connected to Trino")
-
-	// Query to execute
-	query := "SELECT * FROM hive.cfrtl.rtl WHERE year='2022' AND month='7' LIMIT 10"
-	// "SELECT * FROM hive.cfrtl.rtl WHERE year='2022' AND month='2' AND HOST LIKE ?"
+}
 
-	log.WithFields(logrus.Fields{
-		"query": query,
-	}).Debug("Executing query")
-	// Execute the query
-	rows, err := trino.DB.Queryx(query)
-	//rows, err := trino.DB.Queryx(query, fmt.Sprintf("%%%s", hostname))
+func fetchData() error {
+	query, err := buildQuery()
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-	log.Debug("Query executed. Processing results...")
-
-	// Slice to hold the results
-	var records []rtl.Record
 
-	// Iterate over the results
-	count := 0
-	for rows.Next() {
-		// fetch.Entry is a struct that is compatible with the data returned from Trino
-		var entry fetch.Entry
-
-		// Get a row
-		if err := rows.StructScan(&entry); err != nil {
+	var checkpoints *checkpoint.Checkpoints
+	p := &progress{}
+	if viper.GetBool("incremental") {
+		if checkpoints, err = loadCheckpoints(); err != nil {
 			return err
 		}
-
-		record, err := processRecord(geo, &entry)
-		if err != nil {
-			return err
+		p.lookback = viper.GetDuration("lookback")
+		p.written = make(map[string]time.Time)
+		if entry, ok := checkpoints.Get(query.Hostname); ok {
+			if resume := entry.Resume(p.lookback); resume.After(query.From) {
+				query.From = resume
+				p.previous = entry
+			}
 		}
-
-		// Build a properly typed reccord
-		records = append(records, *record)
-		count++
-		if count%1000 == 0 {
+		if !query.To.After(query.From) {
 			log.WithFields(logrus.Fields{
-				"count": count,
-			}).Debug("Processed record")
+				"from": query.From,
+				"to":   query.To,
+			}).Info("Nothing new to fetch")
+			return nil
 		}
 	}
-	log.WithFields(logrus.Fields{
-		"count": count,
-	}).Debug("Processed all records")
 
-	// Write the records to a file
-	if fqpn, err := writeJSON(datafile, &records); err != nil {
-		return err
+	ctx := context.Background()
+
+	var count int64
+	var dest string
+	if size := viper.GetDuration("chunk"); chunked(query, size) {
+		count, dest, err = fetchChunks(ctx, query, size, p)
 	} else {
-		// Print the number of records and output filename
-		log.WithFields(logrus.Fields{
-			"count": len(records),
-			"file":  *fqpn,
-		}).Info("Wrote data")
+		count, dest, err = fetchStream(ctx, query, p)
+	}
+	if err != nil {
+		return err
 	}
 
-	geo.Close()
+	// Print the number of records and output destination
+	log.WithFields(logrus.Fields{
+		"count":   count,
+		"skipped": p.skipped,
+		"sink":    dest,
+		"from":    query.From,
+		"to":      query.To,
+	}).Info("Wrote data")
+
+	// The checkpoint only moves once the records are safely written
+	if checkpoints != nil {
+		checkpoints.Advance(query.Hostname, query.To, p.latest, p.written, p.lookback)
+		if err := checkpoints.Save(); err != nil {
+			return err
+		}
+		log.WithFields(logrus.Fields{
+			"checkpoint": checkpoints.Path,
+		}).Debug("Saved checkpoint")
+	}
 
 	return nil
 }
 
-func processRecord(geo *geoip.Config, entry *fetch.Entry) (*rtl.Record, error) {
-	// Convert the timestamp string to a time.Time
-	epoch, err := strconv.ParseInt(strings.Replace(entry.Timestamp, ".", "", 1), 10, 64)
-	if err != nil {
-		return nil, err
-	}
-	timestamp := time.UnixMilli(epoch)
-
-	// Convert the year, month, and day strings to ints
-	year, err := strconv.Atoi(entry.Year)
-	if err != nil {
-		return nil, err
+// chunked reports whether the query is fetched in chunks of size.
+// Only Trino queries into file sinks are chunked; database sinks commit every
+// batch as it arrives and log files are reread for every chunk. A row limit
+// applies to a whole query, so limited queries are not split.
+func chunked(query *fetch.Query, size time.Duration) bool {
+	if !trinoSource() {
+		return false
 	}
-	month, err := strconv.Atoi(entry.Month)
-	if err != nil {
-		return nil, err
-	}
-	day, err := strconv.Atoi(entry.Day)
-	if err != nil {
-		return nil, err
+	if sink := viper.GetString("sink"); sink != "" && sink != "file" {
+		return false
 	}
+	return size > 0 && query.Limit == 0 && len(chunk.Split(query.From, query.To, size)) > 1
+}
 
-	geodata, err := geo.Lookup(net.ParseIP(entry.ClientIP))
+// fetchStream streams the whole query into the sink
+func fetchStream(ctx context.Context, query *fetch.Query, p *progress) (int64, string, error) {
+	// Records are written as they arrive rather than collected in memory
+	out, dest, err := openSink()
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
 
-	uaparser, err := useragent.Parse(entry.UserAgent)
+	count, err := streamQuery(ctx, query, p.sink(out))
 	if err != nil {
-		return nil, err
+		abort(out)
+		return 0, "", err
 	}
-
-	return &rtl.Record{
-		Timestamp:                timestamp,
-		ClientIPAddr:             entry.ClientIP,
-		Status:                   entry.Status,
-		Bytes:                    entry.Bytes,
-		Method:                   entry.Method,
-		Protocol:                 entry.Protocol,
-		Host:                     entry.Host,
-		UriStem:                  entry.UriStem,
-		EdgeLocation:             entry.EdgeLocation,
-		EdgeRequestID:            entry.EdgeRequestID,
-		HostHeader:               entry.HostHeader,
-		TimeTaken:                entry.TimeTaken,
-		ProtoVersion:             entry.ProtoVersion,
-		IPVersion:                entry.IPVersion,
-		Referer:                  entry.Referer,
-		Cookie:                   entry.Cookie,
-		UriQuery:                 entry.UriQuery,
-		EdgeResponseResultType:   entry.EdgeResponseResultType,
-		SslProtocol:              entry.SslProtocol,
-		SslCipher:                entry.SslCipher,
-		EdgeResultType:           entry.EdgeResultType,
-		ContentType:              entry.ContentType,
-		ContentLength:            entry.ContentLength,
-		EdgeDetailedResultType:   entry.EdgeDetailedResultType,
-		Country:                  entry.Country,
-		CacheBehaviorPathPattern: entry.CacheBehaviorPathPattern,
-		Year:                     year,
-		Month:                    month,
-		Day:                      day,
-		ClientIP:                 geodata,
-		UserAgent:                uaparser,
-	}, nil
+	if err := out.Close(); err != nil {
+		return 0, "", err
+	}
+	return count, dest, nil
 }
 
-func writeGOB(datafile string, records *[]rtl.Record) (*string, error) {
-	// Resolve the output file path
-	fqpn, err := filepath.Abs(datafile)
-	if err != nil {
-		return nil, err
+// fetchChunks fetches the query one chunk at a time into a directory next to
+// the data file, committing each chunk as it completes, then combines the
+// chunks into the data file. A rerun after an interruption skips the chunks
+// already committed.
+func fetchChunks(ctx context.Context, query *fetch.Query, size time.Duration, p *progress) (int64, string, error) {
+	path := viper.GetString("datafile")
+	if path == "" {
+		return 0, "", fmt.Errorf("datafile is required")
 	}
+	path += ".parts"
 
-	if err := os.MkdirAll(filepath.Dir(fqpn), 0755); err != nil {
-		return nil, err
+	// Without an explicit range, pick up the interrupted fetch where it stopped
+	if m, err := chunk.LoadManifest(path); err != nil {
+		return 0, "", err
+	} else if m != nil && viper.GetString("from") == "" && viper.GetString("to") == "" {
+		log.WithFields(logrus.Fields{
+			"from": m.From,
+			"to":   m.To,
+		}).Info("Resuming interrupted fetch")
+		query.From, query.To = m.From, m.To
 	}
 
+	parts, err := chunk.Open(path, chunk.Manifest{
+		Hostname:      query.Hostname,
+		From:          query.From,
+		To:            query.To,
+		Size:          size.String(),
+		Status:        query.Status,
+		Methods:       query.Methods,
+		EdgeLocations: query.EdgeLocations,
+		Fields:        viper.GetStringSlice("fields"),
+	})
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
 
-	// Create the output file
-	f, err := os.Create(fqpn)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
+	ranges := chunk.Split(query.From, query.To, size)
+	for _, r := range ranges {
+		if parts.Done(r) {
+			log.WithFields(logrus.Fields{
+				"from": r.From,
+				"to":   r.To,
+			}).Debug("Chunk already fetched")
+			continue
+		}
 
-	// Encode the records to the file
-	enc := gob.NewEncoder(f)
-	if err := enc.Encode(records); err != nil {
-		return nil, err
-	}
+		out, err := parts.Create(r)
+		if err != nil {
+			return 0, "", err
+		}
+		q := *query
+		q.From, q.To = r.From, r.To
+		count, err := streamQuery(ctx, &q, out)
+		if err != nil {
+			out.Abort()
+			return 0, "", err
+		}
+		if err := out.Close(); err != nil {
+			return 0, "", err
+		}
 
-	return &fqpn, nil
-}
+		log.WithFields(logrus.Fields{
+			"count": count,
+			"from":  r.From,
+			"to":    r.To,
+		}).Info("Fetched chunk")
+	}
 
-func writeJSON(datafile string, records *[]rtl.Record) (*string, error) {
-	// Resolve the output file path
-	fqpn, err := filepath.Abs(datafile)
+	// Every chunk is committed; combine them into the data file
+	out, dest, err := openSink()
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
-
-	if err := os.MkdirAll(filepath.Dir(fqpn), 0755); err != nil {
-		return nil, err
+	var count int64
+	sink := p.sink(out)
+	for _, r := range ranges {
+		in, err := reader.Open(parts.File(r), writer.FormatGob)
+		if err != nil {
+			abort(out)
+			return 0, "", err
+		}
+		err = reader.Each(in, func(record *rtl.Record) error {
+			count++
+			return sink.Write(record)
+		})
+		in.Close()
+		if err != nil {
+			abort(out)
+			return 0, "", fmt.Errorf("%s: %w", in.Path, err)
+		}
 	}
-
-	if err != nil {
-		return nil, err
+	if err := out.Close(); err != nil {
+		return 0, "", err
 	}
 
-	// Create the output file
-	f, err := os.Create(fqpn)
-	if err != nil {
-		return nil, err
+	if err := parts.Remove(); err != nil {
+		return 0, "", err
 	}
-	defer f.Close()
+	return count, dest, nil
+}
+
+// progress follows the records a fetch writes, for its checkpoint
+type progress struct {
+	// lookback is how far before the newest record the next fetch resumes
+	lookback time.Duration
+	// previous is the checkpoint this fetch resumed from; the records it
+	// lists were written already
+	previous checkpoint.Entry
+	latest   time.Time
+	skipped  int64
+	// written holds the edge request IDs and timestamps of records written
+	// within lookback of latest; nil when there is no checkpoint
+	written map[string]time.Time
+	pruned  int
+}
+
+// sink wraps out, skipping records the previous fetch wrote and recording
+// the newest timestamp and recent IDs written
+func (p *progress) sink(out writer.Writer) pipeline.Sink {
+	return recordFunc(func(record *rtl.Record) error {
+		if p.previous.Written(record.EdgeRequestID) {
+			p.skipped++
+			return nil
+		}
+		if record.Timestamp.After(p.latest) {
+			p.latest = record.Timestamp
+		}
+		if p.written != nil && p.lookback > 0 {
+			p.written[record.EdgeRequestID] = record.Timestamp
+			// Only the IDs near the newest record are kept, so a long
+			// fetch does not hold every ID in memory
+			if len(p.written) > 2*p.pruned+1024 {
+				since := p.latest.Add(-p.lookback)
+				for id, ts := range p.written {
+					if ts.Before(since) {
+						delete(p.written, id)
+					}
+				}
+				p.pruned = len(p.written)
+			}
+		}
+		return out.Write(record)
+	})
+}
 
-	file, _ := json.MarshalIndent(records, "", " ")
-	if _, err := f.Write(file); err != nil {
-		return nil, err
+// abort discards a partially written output where the sink allows it
+func abort(out writer.Writer) {
+	if a, ok := out.(interface{ Abort() error }); ok {
+		a.Abort()
+		return
 	}
+	out.Close()
+}
 
-	return &fqpn, nil
+// loadCheckpoints reads the checkpoint file named by --checkpoint,
+// defaulting to one next to the data file
+func loadCheckpoints() (*checkpoint.Checkpoints, error) {
+	path := viper.GetString("checkpoint")
+	if path == "" {
+		datafile := viper.GetString("datafile")
+		if sink := viper.GetString("sink"); datafile == "" || (sink != "" && sink != "file") {
+			return nil, fmt.Errorf("checkpoint is required for --incremental without a datafile")
+		}
+		path = datafile + ".checkpoint.json"
+	}
+	return checkpoint.Load(path)
 }
@@ -0,0 +1,430 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/checkpoint"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch/fetchtest"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip/geoiptest"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/reader"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const testUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0"
+
+// testStart is the first fixture timestamp; rows follow every four hours for three days
+var testStart = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+// testRows returns the fixture rows. Every sixth row belongs to another host.
+// Even rows come from the US network in the fixture GeoIP databases, odd rows
+// from the German hosting provider.
+func testRows() []fetch.Entry {
+	var rows []fetch.Entry
+	for i := 0; i < 18; i++ {
+		ts := testStart.Add(time.Duration(i)*4*time.Hour + time.Duration(i)*time.Millisecond)
+		host := "d111111abcdef8.cloudfront.net"
+		if i%6 == 5 {
+			host = "d222222abcdef8.cloudfront.net"
+		}
+		ip := fmt.Sprintf("192.0.2.%d", i+1)
+		if i%2 == 1 {
+			ip = fmt.Sprintf("2001:db8::%x", i+1)
+		}
+		rows = append(rows, fetch.Entry{
+			Timestamp:      fmt.Sprintf("%d.%03d", ts.Unix(), ts.Nanosecond()/int(time.Millisecond)),
+			ClientIP:       ip,
+			Status:         200,
+			Bytes:          int64(512 * (i + 1)),
+			Method:         "GET",
+			Protocol:       "https",
+			Host:           host,
+			UriStem:        fmt.Sprintf("/index-%d.html", i),
+			EdgeLocation:   "IAD89-C1",
+			EdgeRequestID:  fmt.Sprintf("req-%02d", i),
+			TimeTaken:      0.05,
+			ProtoVersion:   "HTTP/2.0",
+			IPVersion:      "IPv4",
+			UserAgent:      testUserAgent,
+			EdgeResultType: "Hit",
+			ContentType:    "text/html",
+			Year:           ts.Format("2006"),
+			Month:          fmt.Sprint(int(ts.Month())),
+			Day:            fmt.Sprint(ts.Day()),
+		})
+	}
+	return rows
+}
+
+// testFetch starts a fake Trino server with the fixture rows, writes the
+// fixture GeoIP databases and points the fetch flags at them
+func testFetch(t *testing.T, settings map[string]interface{}) (*fetchtest.Server, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	geodb := filepath.Join(dir, "city.mmdb")
+	err := geoiptest.Write(geodb,
+		geoiptest.City{Network: "192.0.2.0/24", City: "Ashburn", Continent: "NA", Country: "US", Subdivisions: []string{"VA"}},
+		geoiptest.City{Network: "2001:db8::/32", City: "Frankfurt am Main", Continent: "EU", Country: "DE"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asndb := filepath.Join(dir, "asn.mmdb")
+	if err := geoiptest.WriteASN(asndb, geoiptest.ASN{Network: "2001:db8::/32", Number: 64500, Organization: "Example Hosting"}); err != nil {
+		t.Fatal(err)
+	}
+	anondb := filepath.Join(dir, "anonymous.mmdb")
+	if err := geoiptest.WriteAnonymousIP(anondb, geoiptest.AnonymousIP{Network: "2001:db8::/32", IsHostingProvider: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := fetchtest.NewServer(testRows())
+	srv.PageSize = 2
+	srv.Select = fetchtest.Range
+	t.Cleanup(srv.Close)
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	level := log.GetLevel()
+	log.SetLevel(logrus.WarnLevel)
+	t.Cleanup(func() { log.SetLevel(level) })
+
+	viper.Set("trinodsn", srv.DSN())
+	viper.Set("geoipdb", []string{geodb, asndb, anondb})
+	viper.Set("hostname", "d111111abcdef8.cloudfront.net")
+	viper.Set("sink", "file")
+	viper.Set("workers", 2)
+	viper.Set("ordered", true)
+	for k, v := range settings {
+		viper.Set(k, v)
+	}
+
+	return srv, dir
+}
+
+// readRecords reads back a data file
+func readRecords(t *testing.T, path string) []*rtl.Record {
+	t.Helper()
+	in, err := reader.Open(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	var records []*rtl.Record
+	if err := reader.Each(in, func(record *rtl.Record) error {
+		records = append(records, record)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// requestIDs returns the edge request IDs of records, in order
+func requestIDs(records []*rtl.Record) []string {
+	ids := make([]string, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.EdgeRequestID)
+	}
+	return ids
+}
+
+// wantIDs returns the fixture request IDs for the queried host in [from, to)
+func wantIDs(from, to time.Time) []string {
+	var ids []string
+	for i := 0; i < 18; i++ {
+		ts := testStart.Add(time.Duration(i)*4*time.Hour + time.Duration(i)*time.Millisecond)
+		if i%6 != 5 && !ts.Before(from) && ts.Before(to) {
+			ids = append(ids, fmt.Sprintf("req-%02d", i))
+		}
+	}
+	return ids
+}
+
+func TestFetch(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		chunk   time.Duration
+		queries int
+	}{
+		{name: "chunked", file: "out.ndjson", chunk: 24 * time.Hour, queries: 3},
+		{name: "single query", file: "out.csv", chunk: 0, queries: 1},
+		{name: "one chunk", file: "out.parquet", chunk: 7 * 24 * time.Hour, queries: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, dir := testFetch(t, map[string]interface{}{
+				"from":  "2023-11-14",
+				"to":    "2023-11-17",
+				"chunk": tc.chunk,
+			})
+			datafile := filepath.Join(dir, tc.file)
+			viper.Set("datafile", datafile)
+
+			if err := fetchData(); err != nil {
+				t.Fatal(err)
+			}
+
+			if n := len(srv.Queries()); n != tc.queries {
+				t.Errorf("got %d queries, want %d", n, tc.queries)
+			}
+			if _, err := os.Stat(datafile + ".parts"); !os.IsNotExist(err) {
+				t.Errorf("chunk directory left behind: %v", err)
+			}
+
+			records := readRecords(t, datafile)
+			want := wantIDs(testStart, testStart.Add(72*time.Hour))
+			if got := requestIDs(records); !reflect.DeepEqual(got, want) {
+				t.Fatalf("got records %v, want %v", got, want)
+			}
+
+			// Records are enriched from the GeoIP database and the user agent
+			first, second := records[0], records[1]
+			if !first.Timestamp.Equal(testStart) {
+				t.Errorf("timestamp %s, want %s", first.Timestamp, testStart)
+			}
+			if first.ClientIP == nil || first.ClientIP.Country != "US" || first.ClientIP.Subdivision != "VA" {
+				t.Errorf("first record location %+v, want US/VA", first.ClientIP)
+			}
+			if second.ClientIP == nil || second.ClientIP.Country != "DE" || second.ClientIP.City != "Frankfurt am Main" {
+				t.Errorf("second record location %+v, want Frankfurt, DE", second.ClientIP)
+			}
+			if first.ClientIP.ASN != 0 || first.ClientIP.IsHostingProvider {
+				t.Errorf("first record network %+v, want none", first.ClientIP)
+			}
+			if second.ClientIP.ASN != 64500 || second.ClientIP.ASNOrg != "Example Hosting" || !second.ClientIP.IsHostingProvider {
+				t.Errorf("second record network %+v, want AS64500 hosting provider", second.ClientIP)
+			}
+			if first.UserAgent == nil || first.UserAgent.BrowserName != "Firefox" {
+				t.Errorf("user agent %+v, want Firefox", first.UserAgent)
+			}
+			if first.Year != 2023 || first.Month != 11 || first.Day != 14 {
+				t.Errorf("partition %d-%d-%d, want 2023-11-14", first.Year, first.Month, first.Day)
+			}
+		})
+	}
+}
+
+func TestFetchResume(t *testing.T) {
+	srv, dir := testFetch(t, map[string]interface{}{
+		"from":  "2023-11-14",
+		"to":    "2023-11-17",
+		"chunk": 24 * time.Hour,
+	})
+	datafile := filepath.Join(dir, "out.ndjson")
+	viper.Set("datafile", datafile)
+
+	// The second day's query fails part way through the range
+	failing := fmt.Sprintf("%d.000", testStart.Add(24*time.Hour).Unix())
+	srv.Select = func(q *fetchtest.Query, rows []fetch.Entry) ([]fetch.Entry, error) {
+		if q.Arg(0) == failing {
+			return nil, errors.New("node lost")
+		}
+		return fetchtest.Range(q, rows)
+	}
+
+	if err := fetchData(); err == nil {
+		t.Fatal("expected the failed chunk to fail the fetch")
+	}
+	if _, err := os.Stat(datafile); !os.IsNotExist(err) {
+		t.Errorf("data file written by a failed fetch: %v", err)
+	}
+	if n := len(srv.Queries()); n != 2 {
+		t.Errorf("got %d queries before the failure, want 2", n)
+	}
+
+	// Rerunning without a range resumes from the failed chunk
+	srv.Select = fetchtest.Range
+	viper.Set("from", "")
+	viper.Set("to", "")
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := srv.Queries()[2:]
+	if len(queries) != 2 || queries[0].Arg(0) != failing {
+		t.Errorf("resumed with %v, want the last two days", queries)
+	}
+	want := wantIDs(testStart, testStart.Add(72*time.Hour))
+	if got := requestIDs(readRecords(t, datafile)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got records %v, want %v", got, want)
+	}
+	if _, err := os.Stat(datafile + ".parts"); !os.IsNotExist(err) {
+		t.Errorf("chunk directory left behind: %v", err)
+	}
+}
+
+func TestFetchIncremental(t *testing.T) {
+	srv, dir := testFetch(t, map[string]interface{}{
+		"from":        "2023-11-14",
+		"to":          "2023-11-15T12:00:00Z",
+		"chunk":       24 * time.Hour,
+		"incremental": true,
+		"lookback":    checkpoint.DefaultLookback,
+	})
+	datafile := filepath.Join(dir, "out.ndjson")
+	viper.Set("datafile", datafile)
+
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+	mid := testStart.Add(36 * time.Hour)
+	if got, want := requestIDs(readRecords(t, datafile)), wantIDs(testStart, mid); !reflect.DeepEqual(got, want) {
+		t.Fatalf("first run wrote %v, want %v", got, want)
+	}
+
+	checkpoints, err := checkpoint.Load(datafile + ".checkpoint.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := checkpoints.Get("d111111abcdef8.cloudfront.net")
+	if !ok {
+		t.Fatal("no checkpoint saved for the hostname")
+	}
+	// req-08, the newest row fetched, is at 32h and 8ms
+	latest := testStart.Add(32*time.Hour + 8*time.Millisecond)
+	if !entry.MaxTimestamp.Equal(latest) || !entry.To.Equal(mid) {
+		t.Errorf("checkpoint %+v, want max %s to %s", entry, latest, mid)
+	}
+
+	if !reflect.DeepEqual(entry.Recent, map[string]time.Time{"req-08": latest}) {
+		t.Errorf("checkpoint recent %v, want only req-08", entry.Recent)
+	}
+
+	// The next run starts the lookback before the newest record and appends,
+	// skipping req-08 which it fetches again
+	viper.Set("to", "2023-11-17")
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+	queries := srv.Queries()
+	resume := latest.Add(-checkpoint.DefaultLookback)
+	if got, want := queries[len(queries)-2].Arg(0), fmt.Sprintf("%d.008", resume.Unix()); got != want {
+		t.Errorf("second run started at %s, want %s", got, want)
+	}
+	want := wantIDs(testStart, testStart.Add(72*time.Hour))
+	if got := requestIDs(readRecords(t, datafile)); !reflect.DeepEqual(got, want) {
+		t.Errorf("after the second run got %v, want %v", got, want)
+	}
+
+	// Rerunning the same range writes nothing new
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+	if got := requestIDs(readRecords(t, datafile)); !reflect.DeepEqual(got, want) {
+		t.Errorf("after a rerun got %v, want %v", got, want)
+	}
+
+	// A range ending before the checkpoint has nothing to fetch
+	count := len(srv.Queries())
+	viper.Set("to", "2023-11-16T12:00:00Z")
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Queries()); n != count {
+		t.Errorf("up to date fetch ran %d queries", n-count)
+	}
+}
+
+func TestFetchLateArrival(t *testing.T) {
+	srv, dir := testFetch(t, map[string]interface{}{
+		"from":        "2023-11-14",
+		"to":          "2023-11-15T12:00:00Z",
+		"incremental": true,
+		"lookback":    5 * time.Hour,
+	})
+	datafile := filepath.Join(dir, "out.ndjson")
+	viper.Set("datafile", datafile)
+
+	// req-07, at 28h, is not in Athena yet when the first run queries
+	late := true
+	srv.Select = func(q *fetchtest.Query, rows []fetch.Entry) ([]fetch.Entry, error) {
+		rows, err := fetchtest.Range(q, rows)
+		if !late {
+			return rows, err
+		}
+		var arrived []fetch.Entry
+		for _, row := range rows {
+			if row.EdgeRequestID != "req-07" {
+				arrived = append(arrived, row)
+			}
+		}
+		return arrived, err
+	}
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run reaches back past req-07 and picks it up once, while
+	// req-08 is skipped as written already
+	late = false
+	viper.Set("to", "2023-11-16")
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"req-00", "req-01", "req-02", "req-03", "req-04", "req-06", "req-08", "req-07", "req-09", "req-10"}
+	if got := requestIDs(readRecords(t, datafile)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got records %v, want %v", got, want)
+	}
+}
+
+func TestFetchLogFiles(t *testing.T) {
+	srv, dir := testFetch(t, map[string]interface{}{
+		"from":  "2023-11-14",
+		"to":    "2023-11-17",
+		"chunk": 24 * time.Hour,
+	})
+
+	// The default field order follows fetch.Entry up to the partition columns
+	var lines []string
+	for _, row := range testRows() {
+		v := reflect.ValueOf(row)
+		values := make([]string, len(fetch.DefaultFields))
+		for i := range values {
+			values[i] = fmt.Sprint(v.Field(i).Interface())
+			if values[i] == "" {
+				values[i] = "-"
+			}
+		}
+		lines = append(lines, strings.Join(values, "\t"))
+	}
+	logs := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(logs, "cfrtl-1"), []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	datafile := filepath.Join(dir, "out.ndjson")
+	viper.Set("datafile", datafile)
+	viper.Set("source", "rtl:"+logs)
+	viper.Set("trinodsn", "")
+
+	if err := fetchData(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Queries()); n != 0 {
+		t.Errorf("got %d Trino queries reading log files", n)
+	}
+
+	records := readRecords(t, datafile)
+	want := wantIDs(testStart, testStart.Add(72*time.Hour))
+	if got := requestIDs(records); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got records %v, want %v", got, want)
+	}
+	if records[1].ClientIP == nil || records[1].ClientIP.Country != "DE" || records[1].Day != 14 {
+		t.Errorf("record not enriched: %+v", records[1])
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/mysql"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/reader"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// loadCmd represents the load command
+var loadCmd = &cobra.Command{
+	Use:   "load [datafile...]",
+	Short: "Loads fetched data files into MySQL",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := loadData(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loadCmd)
+
+	loadCmd.Flags().StringP("datafile", "i", "", "Input file (used when no files are given as arguments)")
+	viper.BindPFlag("datafile", loadCmd.Flags().Lookup("datafile"))
+
+	loadCmd.Flags().StringP("format", "f", "", "Input format (json, ndjson, csv, gob, parquet; default from the file extension)")
+	viper.BindPFlag("format", loadCmd.Flags().Lookup("format"))
+
+	loadCmd.Flags().String("mysqldsn", "", "MySQL DSN")
+	viper.BindPFlag("mysqldsn", loadCmd.Flags().Lookup("mysqldsn"))
+
+	loadCmd.Flags().Int("batch-size", mysql.DefaultBatchSize, "Records per database transaction")
+	viper.BindPFlag("batch-size", loadCmd.Flags().Lookup("batch-size"))
+}
+
+func loadData(files []string) error {
+	if len(files) == 0 {
+		datafile := viper.GetString("datafile")
+		if datafile == "" {
+			return fmt.Errorf("datafile is required")
+		}
+		files = []string{datafile}
+	}
+
+	db, _, err := openMySQL()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, file := range files {
+		count, err := loadFile(db, file)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		total += count
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"count": total,
+		"files": len(files),
+	}).Info("Loaded data")
+
+	return nil
+}
+
+// loadFile streams a single data file into the database
+func loadFile(db *mysql.Config, file string) (int64, error) {
+	in, err := reader.Open(file, viper.GetString("format"))
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	var count int64
+	err = reader.Each(in, func(record *rtl.Record) error {
+		if err := db.Write(record); err != nil {
+			return err
+		}
+		count++
+		if count%10000 == 0 {
+			log.WithFields(logrus.Fields{
+				"count": count,
+				"file":  in.Path,
+			}).Debug("Loaded records")
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	// Commit the tail of this file before moving on
+	if err := db.Flush(); err != nil {
+		return count, err
+	}
+
+	log.WithFields(logrus.Fields{
+		"count": count,
+		"file":  in.Path,
+	}).Debug("Loaded file")
+
+	return count, nil
+}
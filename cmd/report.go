@@ -0,0 +1,147 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/reader"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Analyzes fetched data files or a Trino window",
+	Long: `Analyzes fetched data files or a Trino window.
+
+Records are read from the data files given as arguments, from --datafile, or
+streamed straight from Trino with --trino using the same query flags as fetch.
+With --source rtl:path, the raw CloudFront real-time log files under path are
+read and enriched in place of Trino.`,
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	addInputFlags(reportCmd.PersistentFlags())
+
+	reportCmd.PersistentFlags().String("output", report.OutputTable, "Output format (table, json, csv)")
+	viper.BindPFlag("output", reportCmd.PersistentFlags().Lookup("output"))
+}
+
+// addInputFlags adds the flags selecting where analysis commands read records from
+func addInputFlags(flags *pflag.FlagSet) {
+	flags.StringP("datafile", "i", "", "Input file (used when no files are given as arguments)")
+	viper.BindPFlag("datafile", flags.Lookup("datafile"))
+
+	flags.StringP("format", "f", "", "Input format (json, ndjson, csv, gob, parquet; default from the file extension)")
+	viper.BindPFlag("format", flags.Lookup("format"))
+
+	flags.Bool("trino", false, "Stream records from Trino instead of reading data files")
+	viper.BindPFlag("trino", flags.Lookup("trino"))
+
+	addTrinoFlags(flags)
+}
+
+// recordFunc adapts a function to the pipeline.Sink interface
+type recordFunc func(record *rtl.Record) error
+
+func (f recordFunc) Write(record *rtl.Record) error {
+	return f(record)
+}
+
+// inputFiles returns the data files named in args, falling back to --datafile
+func inputFiles(args []string) ([]string, error) {
+	if len(args) > 0 {
+		return args, nil
+	}
+	datafile := viper.GetString("datafile")
+	if datafile == "" {
+		return nil, fmt.Errorf("datafile is required")
+	}
+	return []string{datafile}, nil
+}
+
+// eachRecord calls fn for every input record, from Trino, raw log files or the data files
+func eachRecord(args []string, fn func(record *rtl.Record) error) error {
+	if viper.GetBool("trino") || !trinoSource() {
+		count, err := streamSource(context.Background(), recordFunc(fn))
+		if err != nil {
+			return err
+		}
+		log.WithFields(logrus.Fields{
+			"count": count,
+		}).Debug("Read records from source")
+		return nil
+	}
+
+	files, err := inputFiles(args)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := eachFileRecord(file, fn); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// eachFileRecord calls fn for every record in a single data file
+func eachFileRecord(file string, fn func(record *rtl.Record) error) error {
+	in, err := reader.Open(file, viper.GetString("format"))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var count int64
+	err = reader.Each(in, func(record *rtl.Record) error {
+		count++
+		return fn(record)
+	})
+	log.WithFields(logrus.Fields{
+		"count": count,
+		"file":  in.Path,
+	}).Debug("Read records")
+	return err
+}
+
+// runReport feeds every input record to r and renders the result to stdout
+func runReport(args []string, r report.Report) error {
+	err := eachRecord(args, func(record *rtl.Record) error {
+		r.Add(record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return report.Render(os.Stdout, viper.GetString("output"), r)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportBotsCmd represents the report bots command
+var reportBotsCmd = &cobra.Command{
+	Use:   "bots [datafile...]",
+	Short: "Bot and crawler share of requests and bytes per host",
+	Long: `Bot and crawler share of requests and bytes per host.
+
+With --verify, clients claiming to be a known crawler are checked with
+forward-confirmed reverse DNS against an allowlist of domains per bot.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := reportBots(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportBotsCmd)
+
+	reportBotsCmd.Flags().Bool("verify", false, "Verify claimed crawlers by reverse DNS")
+	viper.BindPFlag("verify", reportBotsCmd.Flags().Lookup("verify"))
+
+	reportBotsCmd.Flags().String("allowlist", "", "JSON file mapping bot names to domain suffixes (default is the bundled list)")
+	viper.BindPFlag("allowlist", reportBotsCmd.Flags().Lookup("allowlist"))
+}
+
+func reportBots(args []string) error {
+	var verify report.VerifyFunc
+	if viper.GetBool("verify") {
+		verifier, err := useragent.NewVerifier(useragent.SetAllowlist(viper.GetString("allowlist")))
+		if err != nil {
+			return err
+		}
+		verify = func(name, ip string) string {
+			return verifier.Verify(context.Background(), name, ip)
+		}
+	}
+
+	return runReport(args, report.NewBots(verify))
+}
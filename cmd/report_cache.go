@@ -0,0 +1,63 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportCacheCmd represents the report cache command
+var reportCacheCmd = &cobra.Command{
+	Use:   "cache [datafile...]",
+	Short: "Cache hit, miss, refresh-hit and error ratios by path pattern, edge location and time",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := reportCache(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportCacheCmd)
+
+	reportCacheCmd.Flags().Int("top", 10, "Number of worst URIs to list")
+	viper.BindPFlag("top", reportCacheCmd.Flags().Lookup("top"))
+
+	reportCacheCmd.Flags().Duration("bucket", time.Hour, "Time bucket size")
+	viper.BindPFlag("bucket", reportCacheCmd.Flags().Lookup("bucket"))
+}
+
+func reportCache(args []string) error {
+	bucket := viper.GetDuration("bucket")
+	if bucket <= 0 {
+		return fmt.Errorf("bucket must be positive")
+	}
+	return runReport(args, report.NewCache(viper.GetInt("top"), bucket))
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportLatencyCmd represents the report latency command
+var reportLatencyCmd = &cobra.Command{
+	Use:   "latency [datafile...]",
+	Short: "Time taken percentiles grouped by dimensions and time buckets",
+	Long: `Time taken percentiles grouped by dimensions and time buckets.
+
+Each data file is summarized into its own histograms in parallel and the
+histograms are merged, so any number of files can be combined.
+
+When the records carry the newer real-time log fields, a second table
+separates origin slowness from edge slowness per group:
+
+  ttfb        time to first byte (time-to-first-byte)
+  origin_fbl  origin first-byte latency, for requests sent to the origin
+  origin_lbl  origin last-byte latency, for requests sent to the origin
+  edge        time taken minus origin_lbl, for requests sent to the origin`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := reportLatency(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportLatencyCmd)
+
+	reportLatencyCmd.Flags().StringSlice("by", []string{"host"}, "Dimensions to group by ("+strings.Join(report.DimensionNames(), ", ")+")")
+	viper.BindPFlag("by", reportLatencyCmd.Flags().Lookup("by"))
+
+	reportLatencyCmd.Flags().Duration("bucket", 0, "Time bucket size (0 for no time buckets)")
+	viper.BindPFlag("bucket", reportLatencyCmd.Flags().Lookup("bucket"))
+}
+
+func reportLatency(args []string) error {
+	dims, err := report.LookupDimensions(viper.GetStringSlice("by"))
+	if err != nil {
+		return err
+	}
+	bucket := viper.GetDuration("bucket")
+	if bucket < 0 {
+		return fmt.Errorf("bucket must not be negative")
+	}
+
+	if viper.GetBool("trino") || !trinoSource() {
+		return runReport(args, report.NewLatency(bucket, dims...))
+	}
+
+	files, err := inputFiles(args)
+	if err != nil {
+		return err
+	}
+
+	// Summarize each file on its own, then merge the histograms
+	partials := make([]*report.Latency, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			partial := report.NewLatency(bucket, dims...)
+			errs[i] = eachFileRecord(file, func(record *rtl.Record) error {
+				partial.Add(record)
+				return nil
+			})
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", file, errs[i])
+			}
+			partials[i] = partial
+		}(i, file)
+	}
+	wg.Wait()
+
+	latency := report.NewLatency(bucket, dims...)
+	for i := range files {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		if err := latency.Merge(partials[i]); err != nil {
+			return err
+		}
+	}
+
+	return report.Render(os.Stdout, viper.GetString("output"), latency)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/session"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportSessionsCmd represents the report sessions command
+var reportSessionsCmd = &cobra.Command{
+	Use:   "sessions [datafile...]",
+	Short: "Visitor session lengths and common entry and exit pages",
+	Long: `Visitor session lengths and common entry and exit pages.
+
+Requests are grouped into sessions by client IP and user agent (and
+optionally a cookie), and a session ends after --timeout without requests.
+Input does not have to be in time order: a record up to --timeout older
+than the latest record seen still joins its session. Records later than
+that start a new session.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := reportSessions(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportSessionsCmd)
+
+	reportSessionsCmd.Flags().Int("top", 10, "Number of entry and exit pages to list")
+	viper.BindPFlag("top", reportSessionsCmd.Flags().Lookup("top"))
+
+	reportSessionsCmd.Flags().Duration("timeout", session.DefaultTimeout, "Inactivity gap that ends a session")
+	viper.BindPFlag("timeout", reportSessionsCmd.Flags().Lookup("timeout"))
+
+	reportSessionsCmd.Flags().String("cookie", "", "Name of a cookie to add to the visitor key")
+	viper.BindPFlag("cookie", reportSessionsCmd.Flags().Lookup("cookie"))
+
+	reportSessionsCmd.Flags().String("sessions-out", "", "Also write every session to this NDJSON file")
+	viper.BindPFlag("sessions-out", reportSessionsCmd.Flags().Lookup("sessions-out"))
+}
+
+func reportSessions(args []string) error {
+	var emit func(s *session.Session)
+	var emitErr error
+	if out := viper.GetString("sessions-out"); out != "" {
+		if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		enc := json.NewEncoder(f)
+		emit = func(s *session.Session) {
+			if err := enc.Encode(s); err != nil && emitErr == nil {
+				emitErr = err
+			}
+		}
+	}
+
+	sessions, err := report.NewSessions(
+		viper.GetInt("top"),
+		viper.GetDuration("timeout"),
+		viper.GetString("cookie"),
+		emit,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := runReport(args, sessions); err != nil {
+		return err
+	}
+	return emitErr
+}
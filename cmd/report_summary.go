@@ -0,0 +1,62 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportSummaryCmd represents the report summary command
+var reportSummaryCmd = &cobra.Command{
+	Use:   "summary [datafile...]",
+	Short: "Traffic overview: volume over time, status mix, cache hit ratio, countries and URIs",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := reportSummary(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportSummaryCmd)
+
+	reportSummaryCmd.Flags().Int("top", 10, "Number of countries and URIs to list")
+	viper.BindPFlag("top", reportSummaryCmd.Flags().Lookup("top"))
+
+	reportSummaryCmd.Flags().Duration("bucket", 0, "Time bucket size (0 to pick one from the time range)")
+	viper.BindPFlag("bucket", reportSummaryCmd.Flags().Lookup("bucket"))
+}
+
+func reportSummary(args []string) error {
+	bucket := viper.GetDuration("bucket")
+	if bucket < 0 {
+		return fmt.Errorf("bucket must not be negative")
+	}
+	return runReport(args, report.NewSummary(viper.GetInt("top"), bucket))
+}
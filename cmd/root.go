@@ -28,6 +28,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -38,6 +39,9 @@ var rootCmd = &cobra.Command{
 	Long: `rtl-trino-analysis is a realtime traffic analysis tool.
 	
 	The tool helps pull data from AWS Glue via Trino and analyze it.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindFlags(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -70,6 +74,15 @@ func init() {
 	viper.BindPFlag("loglevel", rootCmd.PersistentFlags().Lookup("loglevel"))
 }
 
+// bindFlags binds the flags of the command being run to viper.
+// Several commands share keys such as datafile, and a key can only be bound
+// to one flag, so the running command's flags must win over those bound in init.
+func bindFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		viper.BindPFlag(flag.Name, flag)
+	})
+}
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if cfgFile != "" {
@@ -0,0 +1,148 @@
+/*
+Copyright © 2022 Robert Sigler <sigler@improvisedscience.org>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve [datafile...]",
+	Short: "Serves the analysis reports as a JSON API",
+	Long: `Serves the analysis reports as a JSON API.
+
+Reports are computed on each request from a local store: fetched data files
+(--store file, the default), a SQLite database (--store sqlite:path.db) or
+MySQL (--store mysql).
+
+Endpoints:
+  GET /api/v1/top?by=host,uri_stem&n=10
+  GET /api/v1/latency?by=host&bucket=1h
+  GET /api/v1/cache?n=10&bucket=1h
+  GET /api/v1/errors?n=10&bucket=1m
+  GET /api/v1/summary?n=10&bucket=5m (bucket is automatic when omitted)
+  GET /healthz
+
+Every report endpoint accepts the filters from, to (RFC3339 or YYYY-MM-DD),
+host (the host and its subdomains), status, method, edge_location, country
+and uri (prefix match), and output=json or output=csv.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serve(args); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("error")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	addStoreFlags(serveCmd.Flags())
+
+	serveCmd.Flags().String("listen", ":8080", "Address to listen on")
+	viper.BindPFlag("listen", serveCmd.Flags().Lookup("listen"))
+}
+
+// addStoreFlags adds the flags selecting the local store records are read from
+func addStoreFlags(flags *pflag.FlagSet) {
+	flags.String("store", "file", "Where to read records (file, mysql, sqlite:path.db)")
+	viper.BindPFlag("store", flags.Lookup("store"))
+
+	flags.StringP("datafile", "i", "", "Input file for the file store (used when no files are given as arguments)")
+	viper.BindPFlag("datafile", flags.Lookup("datafile"))
+
+	flags.StringP("format", "f", "", "Input format (json, ndjson, csv, gob, parquet; default from the file extension)")
+	viper.BindPFlag("format", flags.Lookup("format"))
+
+	flags.String("mysqldsn", "", "MySQL DSN for the mysql store")
+	viper.BindPFlag("mysqldsn", flags.Lookup("mysqldsn"))
+}
+
+func serve(args []string) error {
+	s, source, err := openStore(args)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	server, err := api.New(
+		api.SetStore(s),
+		api.SetLog(log),
+	)
+	if err != nil {
+		return err
+	}
+
+	return listenAndServe(server.Handler(), source)
+}
+
+// listenAndServe serves handler on --listen until interrupted
+func listenAndServe(handler http.Handler, source string) error {
+	srv := &http.Server{
+		Addr:              viper.GetString("listen"),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	log.WithFields(logrus.Fields{
+		"listen": srv.Addr,
+		"source": source,
+	}).Info("Serving")
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
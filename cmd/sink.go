@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/mysql"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/sqlite"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/store"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/writer"
+	"github.com/spf13/viper"
+)
+
+// openSink returns the record destination selected by --sink and a description of it for logging
+func openSink() (writer.Writer, string, error) {
+	sink := viper.GetString("sink")
+	if path, ok := strings.CutPrefix(sink, "sqlite:"); ok {
+		return openSQLite(path)
+	}
+
+	switch sink {
+	case "", "file":
+		datafile := viper.GetString("datafile")
+		if datafile == "" {
+			return nil, "", fmt.Errorf("datafile is required")
+		}
+
+		// database sinks upsert, so only files need opening in append mode
+		create := writer.Create
+		if viper.GetBool("incremental") {
+			create = writer.Append
+		}
+		out, err := create(datafile, viper.GetString("format"))
+		if err != nil {
+			return nil, "", err
+		}
+		return out, out.Path, nil
+
+	case "mysql":
+		return openMySQL()
+
+	default:
+		return nil, "", fmt.Errorf("unknown sink %q", sink)
+	}
+}
+
+// openMySQL connects to the database named by --mysqldsn
+func openMySQL() (*mysql.Config, string, error) {
+	mysqldsn := viper.GetString("mysqldsn")
+	if mysqldsn == "" {
+		return nil, "", fmt.Errorf("mysqldsn is required")
+	}
+
+	db, err := mysql.New(
+		mysql.SetDSN(mysqldsn),
+		mysql.SetBatchSize(viper.GetInt("batch-size")),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return db, "mysql", nil
+}
+
+// openSQLite opens (or creates) the SQLite database at path
+func openSQLite(path string) (*sqlite.Config, string, error) {
+	if path == "" {
+		return nil, "", fmt.Errorf("sqlite sink requires a path, e.g. sqlite:data/rtl.db")
+	}
+
+	db, err := sqlite.New(
+		sqlite.SetPath(path),
+		sqlite.SetBatchSize(viper.GetInt("batch-size")),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return db, "sqlite:" + path, nil
+}
+
+// openStore returns the record store selected by --store, reading data files
+// from args or --datafile, and a description of it for logging
+func openStore(args []string) (store.Store, string, error) {
+	source := viper.GetString("store")
+	if path, ok := strings.CutPrefix(source, "sqlite:"); ok {
+		return openSQLite(path)
+	}
+
+	switch source {
+	case "", "file":
+		files, err := inputFiles(args)
+		if err != nil {
+			return nil, "", err
+		}
+		s, err := store.NewFiles(viper.GetString("format"), files...)
+		if err != nil {
+			return nil, "", err
+		}
+		return s, strings.Join(files, ","), nil
+
+	case "mysql":
+		return openMySQL()
+
+	default:
+		return nil, "", fmt.Errorf("unknown store %q", source)
+	}
+}
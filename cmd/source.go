@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtlfile"
+	"github.com/spf13/viper"
+)
+
+// openSource returns the entry source selected by --source and a description of it for logging
+func openSource() (fetch.Source, string, error) {
+	source := viper.GetString("source")
+	if paths, ok := strings.CutPrefix(source, "rtl:"); ok {
+		files, err := rtlfile.New(rtlfile.SetPaths(strings.Split(paths, ",")...))
+		if err != nil {
+			return nil, "", err
+		}
+		return files, source, nil
+	}
+
+	switch source {
+	case "", "trino":
+		trinodsn := viper.GetString("trinodsn")
+		if trinodsn == "" {
+			return nil, "", fmt.Errorf("trinodsn is required")
+		}
+		trino, err := fetch.New(fetch.SetDSN(trinodsn))
+		if err != nil {
+			return nil, "", err
+		}
+		return trino, "trino", nil
+
+	default:
+		return nil, "", fmt.Errorf("unknown source %q", source)
+	}
+}
+
+// trinoSource reports whether entries are read from Trino rather than log files
+func trinoSource() bool {
+	source := viper.GetString("source")
+	return source == "" || source == "trino"
+}
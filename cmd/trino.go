@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/enrich"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/pipeline"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// addTrinoFlags adds the source, query and enrichment flags shared by
+// every command that can pull records from Trino or raw log files
+func addTrinoFlags(flags *pflag.FlagSet) {
+	flags.String("source", "trino", "Where entries are read from (trino, or rtl:path[,path] for CloudFront real-time log files or directories of them)")
+	viper.BindPFlag("source", flags.Lookup("source"))
+
+	flags.StringSlice("fields", nil, "Fields of the real-time log configuration in order, as CloudFront field names or table columns (default the original 27 fields)")
+	viper.BindPFlag("fields", flags.Lookup("fields"))
+
+	flags.StringP("trinodsn", "d", "", "Trino DNS")
+	viper.BindPFlag("trinodsn", flags.Lookup("trinodsn"))
+
+	flags.StringSliceP("geoipdb", "g", nil, "Paths to GeoIP databases: a City database plus optional ASN, ISP, Anonymous-IP and Connection-Type databases")
+	viper.BindPFlag("geoipdb", flags.Lookup("geoipdb"))
+
+	flags.StringP("hostname", "n", "", "Hostname to query; its subdomains match too")
+	viper.BindPFlag("hostname", flags.Lookup("hostname"))
+
+	flags.String("from", "", "Start of the time range (RFC3339 or YYYY-MM-DD, default 24h before --to)")
+	viper.BindPFlag("from", flags.Lookup("from"))
+
+	flags.String("to", "", "End of the time range, exclusive (RFC3339 or YYYY-MM-DD, default now)")
+	viper.BindPFlag("to", flags.Lookup("to"))
+
+	flags.IntSlice("status", nil, "Only fetch these HTTP status codes")
+	viper.BindPFlag("status", flags.Lookup("status"))
+
+	flags.StringSlice("method", nil, "Only fetch these HTTP methods")
+	viper.BindPFlag("method", flags.Lookup("method"))
+
+	flags.StringSlice("edge-location", nil, "Only fetch these edge locations")
+	viper.BindPFlag("edge-location", flags.Lookup("edge-location"))
+
+	flags.Int("limit", 0, "Maximum number of rows to fetch (0 for no limit)")
+	viper.BindPFlag("limit", flags.Lookup("limit"))
+
+	flags.Int("workers", runtime.NumCPU(), "Number of concurrent enrichment workers")
+	viper.BindPFlag("workers", flags.Lookup("workers"))
+
+	flags.Bool("ordered", false, "Write records in the order Trino returned them")
+	viper.BindPFlag("ordered", flags.Lookup("ordered"))
+}
+
+// streamSource runs the query described by the Trino flags and streams the
+// enriched records into sink
+func streamSource(ctx context.Context, sink pipeline.Sink) (int64, error) {
+	query, err := buildQuery()
+	if err != nil {
+		return 0, err
+	}
+	return streamQuery(ctx, query, sink)
+}
+
+// streamQuery reads the entries matching query from the source and streams
+// the enriched records into sink
+func streamQuery(ctx context.Context, query *fetch.Query, sink pipeline.Sink) (int64, error) {
+	geoipdb := viper.GetStringSlice("geoipdb")
+	if len(geoipdb) == 0 {
+		return 0, fmt.Errorf("geoipdb is required")
+	}
+
+	geo, err := geoip.New(geoip.SetGeoDB(geoipdb...))
+	if err != nil {
+		return 0, err
+	}
+	defer geo.Close()
+
+	enricher, err := enrich.New(enrich.SetGeoIP(geo))
+	if err != nil {
+		return 0, err
+	}
+
+	pipe, err := pipeline.New(
+		pipeline.SetEnricher(enricher),
+		pipeline.SetWorkers(viper.GetInt("workers")),
+		pipeline.SetOrdered(viper.GetBool("ordered")),
+		pipeline.SetProgress(func(count int64) {
+			log.WithFields(logrus.Fields{
+				"count": count,
+			}).Debug("Processed record")
+		}),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// Get a new Trino database connection or log file reader
+	source, desc, err := openSource()
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	log.WithFields(logrus.Fields{
+		"source":   desc,
+		"geoipdb":  geoipdb,
+		"hostname": query.Hostname,
+		"from":     query.From,
+		"to":       query.To,
+	}).Debug("fetching data")
+
+	// Execute the query
+	rows, err := source.Rows(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	log.Debug("Query executed. Processing results...")
+
+	return pipe.Run(ctx, rows, sink)
+}
+
+// buildQuery assembles the Trino query from the query flags
+func buildQuery() (*fetch.Query, error) {
+	hostname := viper.GetString("hostname")
+	if hostname == "" {
+		return nil, fmt.Errorf("hostname is required")
+	}
+
+	to := time.Now().UTC()
+	if v := viper.GetString("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --to: %w", err)
+		}
+		to = t
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if v := viper.GetString("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --from: %w", err)
+		}
+		from = t
+	}
+
+	mapping, err := fetch.NewMapping(viper.GetStringSlice("fields")...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --fields: %w", err)
+	}
+
+	return &fetch.Query{
+		Mapping:       mapping,
+		From:          from,
+		To:            to,
+		Hostname:      hostname,
+		Status:        viper.GetIntSlice("status"),
+		Methods:       viper.GetStringSlice("method"),
+		EdgeLocations: viper.GetStringSlice("edge-location"),
+		Limit:         viper.GetInt("limit"),
+	}, nil
+}
+
+// parseTime accepts RFC3339 timestamps or plain dates (UTC)
+func parseTime(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", v)
+}
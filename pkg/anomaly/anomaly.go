@@ -0,0 +1,548 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Baseline methods
+const (
+	MethodMAD  = "mad"
+	MethodEWMA = "ewma"
+)
+
+// Metrics scored in every bucket
+const (
+	MetricRequests  = "requests"
+	MetricBytes     = "bytes"
+	MetricErrorRate = "error_rate"
+)
+
+// Defaults
+const (
+	DefaultBucket      = 5 * time.Minute
+	DefaultWindow      = 12
+	DefaultThreshold   = 3.5
+	DefaultAlpha       = 0.3
+	DefaultMinRequests = 50
+	DefaultTop         = 5
+	DefaultMaxSeries   = 1000
+)
+
+// madScale converts a median absolute deviation into a standard deviation estimate
+const madScale = 1.4826
+
+// Contributor is a client or URI that made up part of a flagged interval
+type Contributor struct {
+	Key      string  `json:"key"`
+	Requests int64   `json:"requests"`
+	Bytes    int64   `json:"bytes"`
+	Share    float64 `json:"share"`
+}
+
+// Anomaly is a flagged interval of one series
+type Anomaly struct {
+	Dimension  string        `json:"dimension"`
+	Key        string        `json:"key"`
+	Time       time.Time     `json:"time"`
+	Metric     string        `json:"metric"`
+	Value      float64       `json:"value"`
+	Baseline   float64       `json:"baseline"`
+	Score      float64       `json:"score"`
+	Requests   int64         `json:"requests"`
+	Bytes      int64         `json:"bytes"`
+	Errors     int64         `json:"errors"`
+	TopClients []Contributor `json:"top_clients"`
+	TopURIs    []Contributor `json:"top_uris"`
+}
+
+// Result is the JSON form of the detection run
+type Result struct {
+	Method    string    `json:"method"`
+	Bucket    string    `json:"bucket"`
+	Threshold float64   `json:"threshold"`
+	Series    int       `json:"series"`
+	Scored    int       `json:"scored"`
+	Anomalies []Anomaly `json:"anomalies"`
+}
+
+// counts are the totals of one series in one bucket
+type counts struct {
+	requests int64
+	bytes    int64
+	errors   int64
+}
+
+// cell is one series in one bucket, with the breakdowns needed to explain it
+type cell struct {
+	counts
+	clients map[string]*counts
+	uris    map[string]*counts
+}
+
+// seriesKey identifies a series
+type seriesKey struct {
+	dimension string
+	key       string
+}
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// detector configs
+type Config struct {
+	dims        []report.Dimension
+	bucket      time.Duration
+	method      string
+	window      int
+	alpha       float64
+	threshold   float64
+	minRequests int64
+	top         int
+	maxSeries   int
+	series      map[seriesKey]map[time.Time]*cell
+	first, last time.Time
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{
+		bucket:      DefaultBucket,
+		method:      MethodMAD,
+		window:      DefaultWindow,
+		alpha:       DefaultAlpha,
+		threshold:   DefaultThreshold,
+		minRequests: DefaultMinRequests,
+		top:         DefaultTop,
+		maxSeries:   DefaultMaxSeries,
+		series:      make(map[seriesKey]map[time.Time]*cell),
+	}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// at least one dimension must be set
+	if len(config.dims) == 0 {
+		return nil, fmt.Errorf("at least one dimension is required")
+	}
+
+	if config.bucket <= 0 {
+		return nil, fmt.Errorf("bucket must be positive")
+	}
+
+	switch config.method {
+	case MethodMAD, MethodEWMA:
+	default:
+		return nil, fmt.Errorf("unknown method %q (known: %s, %s)", config.method, MethodMAD, MethodEWMA)
+	}
+
+	if config.window < 2 {
+		return nil, fmt.Errorf("window must be at least 2 buckets")
+	}
+
+	if config.alpha <= 0 || config.alpha > 1 {
+		return nil, fmt.Errorf("alpha must be in (0, 1]")
+	}
+
+	if config.threshold <= 0 {
+		return nil, fmt.Errorf("threshold must be positive")
+	}
+
+	if config.maxSeries < 1 {
+		return nil, fmt.Errorf("max series must be positive")
+	}
+
+	return config, nil
+}
+
+// SetDimensions sets the dimensions whose values each get their own series
+func SetDimensions(dims ...report.Dimension) Option {
+	return func(c *Config) {
+		c.dims = dims
+	}
+}
+
+// SetBucket sets the time bucket size
+func SetBucket(bucket time.Duration) Option {
+	return func(c *Config) {
+		c.bucket = bucket
+	}
+}
+
+// SetMethod sets the baseline method (mad or ewma)
+func SetMethod(method string) Option {
+	return func(c *Config) {
+		c.method = method
+	}
+}
+
+// SetWindow sets the number of preceding buckets in the rolling baseline.
+// The EWMA baseline uses it as its warm-up length.
+func SetWindow(window int) Option {
+	return func(c *Config) {
+		c.window = window
+	}
+}
+
+// SetAlpha sets the EWMA smoothing factor
+func SetAlpha(alpha float64) Option {
+	return func(c *Config) {
+		c.alpha = alpha
+	}
+}
+
+// SetThreshold sets the score above which a bucket is flagged
+func SetThreshold(threshold float64) Option {
+	return func(c *Config) {
+		c.threshold = threshold
+	}
+}
+
+// SetMinRequests sets the fewest requests a bucket needs to be flagged
+func SetMinRequests(n int64) Option {
+	return func(c *Config) {
+		c.minRequests = n
+	}
+}
+
+// SetTop sets the number of contributing clients and URIs listed per anomaly
+func SetTop(n int) Option {
+	return func(c *Config) {
+		c.top = n
+	}
+}
+
+// SetMaxSeries sets the most series scored per dimension. The busiest are
+// kept, which bounds the work for high-cardinality dimensions like uri_stem.
+func SetMaxSeries(n int) Option {
+	return func(c *Config) {
+		c.maxSeries = n
+	}
+}
+
+// Add counts the record in the series of every dimension
+func (c *Config) Add(r *rtl.Record) {
+	t := r.Timestamp.UTC().Truncate(c.bucket)
+	if c.first.IsZero() || t.Before(c.first) {
+		c.first = t
+	}
+	if t.After(c.last) {
+		c.last = t
+	}
+
+	var errors int64
+	if r.Status >= 400 {
+		errors = 1
+	}
+
+	for _, d := range c.dims {
+		k := seriesKey{dimension: d.Name, key: d.Key(r)}
+		buckets, ok := c.series[k]
+		if !ok {
+			buckets = make(map[time.Time]*cell)
+			c.series[k] = buckets
+		}
+		b, ok := buckets[t]
+		if !ok {
+			b = &cell{clients: make(map[string]*counts), uris: make(map[string]*counts)}
+			buckets[t] = b
+		}
+		b.add(r.Bytes, errors)
+		addCounts(b.clients, r.ClientIPAddr, r.Bytes, errors)
+		addCounts(b.uris, r.UriStem, r.Bytes, errors)
+	}
+}
+
+func (n *counts) add(bytes, errors int64) {
+	n.requests++
+	n.bytes += bytes
+	n.errors += errors
+}
+
+func addCounts(m map[string]*counts, key string, bytes, errors int64) {
+	n, ok := m[key]
+	if !ok {
+		n = &counts{}
+		m[key] = n
+	}
+	n.add(bytes, errors)
+}
+
+// Detect scores every bucket of every series against its baseline and
+// returns the flagged intervals, highest score first
+func (c *Config) Detect() []Anomaly {
+	var out []Anomaly
+	if c.first.IsZero() {
+		return out
+	}
+
+	// Every series spans the whole input so quiet buckets count as zero
+	var times []time.Time
+	for t := c.first; !t.After(c.last); t = t.Add(c.bucket) {
+		times = append(times, t)
+	}
+
+	// The dense series are reused, so only one is held at a time
+	metrics := map[string][]float64{
+		MetricRequests:  make([]float64, len(times)),
+		MetricBytes:     make([]float64, len(times)),
+		MetricErrorRate: make([]float64, len(times)),
+	}
+	rateOK := make([]bool, len(times))
+
+	for _, k := range c.scored() {
+		buckets := c.series[k]
+		for _, values := range metrics {
+			clear(values)
+		}
+		// buckets too small to be meaningful are left out of the error rate baseline
+		clear(rateOK)
+		for i, t := range times {
+			b, ok := buckets[t]
+			if !ok {
+				continue
+			}
+			metrics[MetricRequests][i] = float64(b.requests)
+			metrics[MetricBytes][i] = float64(b.bytes)
+			metrics[MetricErrorRate][i] = float64(b.errors) / float64(b.requests)
+			rateOK[i] = b.requests >= c.minRequests
+		}
+
+		for _, metric := range []string{MetricRequests, MetricBytes, MetricErrorRate} {
+			var valid []bool
+			if metric == MetricErrorRate {
+				valid = rateOK
+			}
+			for _, s := range c.score(metrics[metric], valid, minScale(metric)) {
+				b := buckets[times[s.index]]
+				if b == nil || b.requests < c.minRequests {
+					continue
+				}
+				out = append(out, Anomaly{
+					Dimension:  k.dimension,
+					Key:        k.key,
+					Time:       times[s.index],
+					Metric:     metric,
+					Value:      metrics[metric][s.index],
+					Baseline:   s.baseline,
+					Score:      s.score,
+					Requests:   b.requests,
+					Bytes:      b.bytes,
+					Errors:     b.errors,
+					TopClients: contributors(b.clients, b.requests, c.top),
+					TopURIs:    contributors(b.uris, b.requests, c.top),
+				})
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		if !out[i].Time.Equal(out[j].Time) {
+			return out[i].Time.Before(out[j].Time)
+		}
+		if out[i].Dimension != out[j].Dimension {
+			return out[i].Dimension < out[j].Dimension
+		}
+		if out[i].Key != out[j].Key {
+			return out[i].Key < out[j].Key
+		}
+		return out[i].Metric < out[j].Metric
+	})
+	return out
+}
+
+// scored returns the series to score: the maxSeries busiest of each dimension
+func (c *Config) scored() []seriesKey {
+	totals := make(map[seriesKey]int64, len(c.series))
+	byDimension := map[string][]seriesKey{}
+	for k, buckets := range c.series {
+		for _, b := range buckets {
+			totals[k] += b.requests
+		}
+		byDimension[k.dimension] = append(byDimension[k.dimension], k)
+	}
+
+	var keys []seriesKey
+	for _, dimKeys := range byDimension {
+		sort.Slice(dimKeys, func(i, j int) bool {
+			if totals[dimKeys[i]] != totals[dimKeys[j]] {
+				return totals[dimKeys[i]] > totals[dimKeys[j]]
+			}
+			return dimKeys[i].key < dimKeys[j].key
+		})
+		if len(dimKeys) > c.maxSeries {
+			dimKeys = dimKeys[:c.maxSeries]
+		}
+		keys = append(keys, dimKeys...)
+	}
+	return keys
+}
+
+// flag is a point scoring above the threshold
+type flag struct {
+	index    int
+	baseline float64
+	score    float64
+}
+
+// score flags points that rise above the rolling baseline of the points before them.
+// Points where valid is false are neither scored nor used in the baseline.
+func (c *Config) score(values []float64, valid []bool, floor float64) []flag {
+	ok := func(i int) bool { return valid == nil || valid[i] }
+
+	var flags []flag
+	switch c.method {
+	case MethodMAD:
+		var history []float64
+		for i, v := range values {
+			if !ok(i) {
+				continue
+			}
+			if len(history) >= c.window {
+				med := median(history)
+				deviations := make([]float64, len(history))
+				for j, h := range history {
+					deviations[j] = math.Abs(h - med)
+				}
+				spread := math.Max(madScale*median(deviations), spreadFloor(med, floor))
+				if score := (v - med) / spread; score >= c.threshold {
+					flags = append(flags, flag{index: i, baseline: med, score: score})
+				}
+			}
+			history = append(history, v)
+			if len(history) > c.window {
+				history = history[1:]
+			}
+		}
+
+	case MethodEWMA:
+		var mean, variance float64
+		seen := 0
+		for i, v := range values {
+			if !ok(i) {
+				continue
+			}
+			if seen == 0 {
+				mean = v
+			} else {
+				if seen >= c.window {
+					spread := math.Max(math.Sqrt(variance), spreadFloor(mean, floor))
+					if score := (v - mean) / spread; score >= c.threshold {
+						flags = append(flags, flag{index: i, baseline: mean, score: score})
+					}
+				}
+				diff := v - mean
+				mean += c.alpha * diff
+				variance = (1 - c.alpha) * (variance + c.alpha*diff*diff)
+			}
+			seen++
+		}
+	}
+	return flags
+}
+
+// minScale is the smallest spread a metric's baseline may have, so a perfectly
+// flat history does not turn every small change into an anomaly
+func minScale(metric string) float64 {
+	if metric == MetricErrorRate {
+		return 0.01
+	}
+	return 1
+}
+
+// spreadFloor allows at least a 10% change around the baseline
+func spreadFloor(baseline, floor float64) float64 {
+	return math.Max(0.1*math.Abs(baseline), floor)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// contributors returns the n keys with the most requests
+func contributors(m map[string]*counts, total int64, n int) []Contributor {
+	out := make([]Contributor, 0, len(m))
+	for k, c := range m {
+		out = append(out, Contributor{Key: k, Requests: c.requests, Bytes: c.bytes, Share: float64(c.requests) / float64(total)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Key < out[j].Key
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// Result returns the flagged intervals
+func (c *Config) Result() interface{} {
+	return &Result{
+		Method:    c.method,
+		Bucket:    c.bucket.String(),
+		Threshold: c.threshold,
+		Series:    len(c.series),
+		Scored:    len(c.scored()),
+		Anomalies: c.Detect(),
+	}
+}
+
+// Tables returns the flagged intervals and their top contributors
+func (c *Config) Tables() []report.Table {
+	anomalies := c.Detect()
+
+	flagged := report.Table{
+		Title:   fmt.Sprintf("Anomalies (%s baseline, %s buckets, score >= %g)", c.method, c.bucket, c.threshold),
+		Columns: []string{"time", "dimension", "key", "metric", "value", "baseline", "score", "requests", "top_client", "top_uri"},
+	}
+	for _, a := range anomalies {
+		flagged.Rows = append(flagged.Rows, []string{
+			a.Time.Format(time.RFC3339),
+			a.Dimension,
+			a.Key,
+			a.Metric,
+			formatValue(a.Metric, a.Value),
+			formatValue(a.Metric, a.Baseline),
+			strconv.FormatFloat(a.Score, 'f', 1, 64),
+			strconv.FormatInt(a.Requests, 10),
+			topKey(a.TopClients),
+			topKey(a.TopURIs),
+		})
+	}
+
+	return []report.Table{flagged}
+}
+
+func formatValue(metric string, v float64) string {
+	if metric == MetricErrorRate {
+		return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
+
+// topKey describes the largest contributor and its share
+func topKey(contributors []Contributor) string {
+	if len(contributors) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s (%.0f%%)", contributors[0].Key, contributors[0].Share*100)
+}
@@ -0,0 +1,196 @@
+package anomaly
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+var start = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+// series returns a bucket's worth of records per entry in perBucket, with
+// errors[i] of them failing
+func series(perBucket []int, errors []int) []*rtl.Record {
+	var records []*rtl.Record
+	for i, n := range perBucket {
+		t := start.Add(time.Duration(i) * DefaultBucket)
+		for j := 0; j < n; j++ {
+			r := &rtl.Record{
+				Timestamp:    t.Add(time.Duration(j) * time.Millisecond),
+				Host:         "a.example.com",
+				ClientIPAddr: fmt.Sprintf("192.0.2.%d", j%10),
+				UriStem:      "/",
+				Status:       200,
+				Bytes:        100,
+			}
+			if errors != nil && j < errors[i] {
+				r.Status = 503
+			}
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func detect(t *testing.T, records []*rtl.Record, opts ...func(*Config)) []Anomaly {
+	t.Helper()
+	dims, err := report.LookupDimensions([]string{"host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(append([]func(*Config){SetDimensions(dims...)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		c.Add(r)
+	}
+	return c.Detect()
+}
+
+func TestSpike(t *testing.T) {
+	flat := make([]int, 24)
+	for i := range flat {
+		flat[i] = 100
+	}
+	spiked := append([]int(nil), flat...)
+	spiked[18] = 500
+	records := series(spiked, nil)
+	// the spike comes from one client
+	for _, r := range records[18*100+100:] {
+		if r.Timestamp.Before(start.Add(19 * DefaultBucket)) {
+			r.ClientIPAddr = "198.51.100.9"
+			r.UriStem = "/search"
+		}
+	}
+
+	for _, method := range []string{MethodMAD, MethodEWMA} {
+		if got := detect(t, series(flat, nil), SetMethod(method)); len(got) != 0 {
+			t.Errorf("%s: flagged a flat series: %+v", method, got)
+		}
+
+		got := detect(t, records, SetMethod(method))
+		metrics := map[string]bool{}
+		for _, a := range got {
+			if !a.Time.Equal(start.Add(18 * DefaultBucket)) {
+				t.Errorf("%s: flagged %s %s at %s, want the spike only", method, a.Metric, a.Key, a.Time)
+				continue
+			}
+			metrics[a.Metric] = true
+			want := 500.0
+			if a.Metric == MetricBytes {
+				want *= 100
+			}
+			if a.Value != want {
+				t.Errorf("%s: %s value %g, want %g", method, a.Metric, a.Value, want)
+			}
+			if len(a.TopClients) == 0 || a.TopClients[0].Key != "198.51.100.9" || a.TopURIs[0].Key != "/search" {
+				t.Errorf("%s: top contributors %+v %+v", method, a.TopClients, a.TopURIs)
+			}
+		}
+		if !metrics[MetricRequests] || !metrics[MetricBytes] || len(metrics) != 2 {
+			t.Errorf("%s: flagged metrics %v, want requests and bytes", method, metrics)
+		}
+	}
+}
+
+func TestErrorRateMinRequests(t *testing.T) {
+	// Small buckets with an outage in one of them
+	perBucket := make([]int, 24)
+	errors := make([]int, 24)
+	for i := range perBucket {
+		perBucket[i] = 20
+	}
+	errors[18] = 20
+	records := series(perBucket, errors)
+
+	for _, tc := range []struct {
+		method      string
+		minRequests int64
+		want        bool
+	}{
+		{MethodMAD, DefaultMinRequests, false},
+		{MethodEWMA, DefaultMinRequests, false},
+		{MethodMAD, 20, true},
+		{MethodEWMA, 20, true},
+		{MethodMAD, 21, false},
+	} {
+		got := detect(t, records, SetMethod(tc.method), SetMinRequests(tc.minRequests))
+		flagged := false
+		for _, a := range got {
+			if a.Metric != MetricErrorRate {
+				t.Errorf("%s min %d: flagged %s", tc.method, tc.minRequests, a.Metric)
+				continue
+			}
+			flagged = a.Time.Equal(start.Add(18*DefaultBucket)) && a.Value == 1
+		}
+		if flagged != tc.want {
+			t.Errorf("%s min %d: flagged the outage %v, want %v", tc.method, tc.minRequests, flagged, tc.want)
+		}
+	}
+}
+
+func TestMaxSeries(t *testing.T) {
+	busy := make([]int, 24)
+	quiet := make([]int, 24)
+	for i := range busy {
+		busy[i] = 100
+		quiet[i] = 60
+	}
+	quiet[18] = 300
+	records := series(busy, nil)
+	for _, r := range series(quiet, nil) {
+		r.UriStem = "/rare"
+		records = append(records, r)
+	}
+
+	dims, err := report.LookupDimensions([]string{"uri_stem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		max  int
+		want bool
+	}{
+		{DefaultMaxSeries, true},
+		{1, false},
+	} {
+		c, err := New(SetDimensions(dims...), SetMaxSeries(tc.max))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			c.Add(r)
+		}
+		res := c.Result().(*Result)
+		flagged := false
+		for _, a := range res.Anomalies {
+			flagged = flagged || a.Key == "/rare"
+		}
+		if flagged != tc.want || res.Series != 2 || res.Scored != min(tc.max, 2) {
+			t.Errorf("max %d: flagged /rare %v, scored %d of %d series", tc.max, flagged, res.Scored, res.Series)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	dims, err := report.LookupDimensions([]string{"host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string][]func(*Config){
+		"no dimensions":  nil,
+		"unknown method": {SetDimensions(dims...), SetMethod("mean")},
+		"short window":   {SetDimensions(dims...), SetWindow(1)},
+		"alpha above 1":  {SetDimensions(dims...), SetAlpha(1.5)},
+		"zero bucket":    {SetDimensions(dims...), SetBucket(0)},
+		"no series":      {SetDimensions(dims...), SetMaxSeries(0)},
+	} {
+		if _, err := New(opts...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
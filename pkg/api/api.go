@@ -0,0 +1,297 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// API server configs
+type Config struct {
+	store store.Store
+	log   *logrus.Logger
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// store must be set
+	if config.store == nil {
+		return nil, fmt.Errorf("store is required")
+	}
+
+	if config.log == nil {
+		config.log = logrus.New()
+	}
+
+	return config, nil
+}
+
+// SetStore sets the store the reports are computed from
+func SetStore(s store.Store) Option {
+	return func(c *Config) {
+		c.store = s
+	}
+}
+
+// SetLog sets the logger used for request errors
+func SetLog(log *logrus.Logger) Option {
+	return func(c *Config) {
+		c.log = log
+	}
+}
+
+// reportFunc builds a report from the request's query parameters
+type reportFunc func(q *params) (report.Report, error)
+
+// Handler returns the HTTP handler serving the report endpoints:
+//
+//	GET /api/v1/top      by=host,uri_stem n=10
+//	GET /api/v1/latency  by=host bucket=1h
+//	GET /api/v1/cache    n=10 bucket=1h
+//	GET /api/v1/errors   n=10 bucket=1m
+//	GET /api/v1/summary  n=10 bucket (automatic when empty)
+//
+// Every endpoint accepts from, to, host, status, method, edge_location,
+// country and uri filters, and output=json (default) or csv.
+func (c *Config) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.Handle("/api/v1/top", c.report(func(q *params) (report.Report, error) {
+		dims, err := report.LookupDimensions(q.list("by", []string{"host", "uri_stem"}))
+		if err != nil {
+			return nil, err
+		}
+		n, err := q.int("n", 10)
+		if err != nil {
+			return nil, err
+		}
+		return report.NewTop(n, dims...), nil
+	}))
+	mux.Handle("/api/v1/latency", c.report(func(q *params) (report.Report, error) {
+		dims, err := report.LookupDimensions(q.list("by", []string{"host"}))
+		if err != nil {
+			return nil, err
+		}
+		bucket, err := q.duration("bucket", 0)
+		if err != nil {
+			return nil, err
+		}
+		return report.NewLatency(bucket, dims...), nil
+	}))
+	mux.Handle("/api/v1/cache", c.report(func(q *params) (report.Report, error) {
+		n, err := q.int("n", 10)
+		if err != nil {
+			return nil, err
+		}
+		bucket, err := q.duration("bucket", time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		return report.NewCache(n, bucket), nil
+	}))
+	mux.Handle("/api/v1/errors", c.report(func(q *params) (report.Report, error) {
+		n, err := q.int("n", 10)
+		if err != nil {
+			return nil, err
+		}
+		bucket, err := q.duration("bucket", time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		return report.NewErrors(n, bucket), nil
+	}))
+	mux.Handle("/api/v1/summary", c.report(func(q *params) (report.Report, error) {
+		n, err := q.int("n", 10)
+		if err != nil {
+			return nil, err
+		}
+		bucket, err := q.duration("bucket", 0)
+		if err != nil {
+			return nil, err
+		}
+		return report.NewSummary(n, bucket), nil
+	}))
+	return mux
+}
+
+// report serves a single report endpoint
+func (c *Config) report(build reportFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			c.error(w, r, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		q := &params{r.URL.Query()}
+		filter, err := q.filter()
+		if err != nil {
+			c.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		rep, err := build(q)
+		if err != nil {
+			c.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		output := q.get("output", report.OutputJSON)
+		if output != report.OutputJSON && output != report.OutputCSV {
+			c.error(w, r, http.StatusBadRequest, fmt.Errorf("unknown output %q", output))
+			return
+		}
+
+		if err := c.store.Each(r.Context(), filter, func(record *rtl.Record) error {
+			rep.Add(record)
+			return nil
+		}); err != nil {
+			c.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if output == report.OutputCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		if err := report.Render(w, output, rep); err != nil {
+			c.log.WithFields(logrus.Fields{
+				"error": err,
+				"path":  r.URL.Path,
+			}).Error("error writing response")
+		}
+	})
+}
+
+// error writes a JSON error body
+func (c *Config) error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		c.log.WithFields(logrus.Fields{
+			"error": err,
+			"path":  r.URL.Path,
+		}).Error("request failed")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// params reads typed query parameters
+type params struct {
+	values map[string][]string
+}
+
+func (q *params) get(key, def string) string {
+	if v := q.values[key]; len(v) > 0 && v[0] != "" {
+		return v[0]
+	}
+	return def
+}
+
+// list accepts both repeated and comma separated values
+func (q *params) list(key string, def []string) []string {
+	var out []string
+	for _, v := range q.values[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return def
+	}
+	return out
+}
+
+func (q *params) int(key string, def int) (int, error) {
+	v := q.get(key, "")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return n, nil
+}
+
+func (q *params) duration(key string, def time.Duration) (time.Duration, error) {
+	v := q.get(key, "")
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return d, nil
+}
+
+func (q *params) time(key string) (time.Time, error) {
+	v := q.get(key, "")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s: unrecognized time %q", key, v)
+}
+
+// filter builds the record filter from the query parameters
+func (q *params) filter() (*store.Filter, error) {
+	from, err := q.time("from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := q.time("to")
+	if err != nil {
+		return nil, err
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+
+	filter := &store.Filter{
+		From:          from,
+		To:            to,
+		Host:          q.get("host", ""),
+		Methods:       q.list("method", nil),
+		EdgeLocations: q.list("edge_location", nil),
+		Country:       q.get("country", ""),
+		URIPrefix:     q.get("uri", ""),
+	}
+	for _, s := range q.list("status", nil) {
+		status, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("status: %w", err)
+		}
+		filter.Status = append(filter.Status, status)
+	}
+	return filter, nil
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/sqlite"
+)
+
+var start = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+// server serves the API over a SQLite store holding one record per host
+func server(t *testing.T) *httptest.Server {
+	t.Helper()
+	db, err := sqlite.New(sqlite.SetPath(filepath.Join(t.TempDir(), "rtl.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for i, r := range []struct {
+		host    string
+		country string
+	}{
+		{"www.example.com", "US"},
+		{"example.com", "DE"},
+		{"badexample.com", "US"},
+		{"my_site.test", "US"},
+		{"myxsite.test", "FR"},
+	} {
+		err := db.Write(&rtl.Record{
+			Timestamp:     start.Add(time.Duration(i) * time.Hour),
+			EdgeRequestID: fmt.Sprintf("req-%d", i),
+			Host:          r.host,
+			Status:        200,
+			Method:        "GET",
+			UriStem:       "/",
+			ClientIP:      &geoip.GeoIPData{Country: r.country},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := New(SetStore(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(c.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFilters(t *testing.T) {
+	srv := server(t)
+	for _, tc := range []struct {
+		query string
+		want  int64
+	}{
+		{"", 5},
+		{"from=2023-11-14T01:00:00Z&to=2023-11-14T03:00:00Z", 2},
+		{"from=2023-11-14T04:00", 1},
+		{"to=2023-11-14", 0},
+		{"host=example.com", 2},
+		{"host=www.example.com", 1},
+		{"host=my_site.test", 1},
+		{"host=%25.test", 0},
+		{"country=US", 3},
+		{"country=us&host=example.com", 1},
+		{"status=200,404&method=get", 5},
+		{"status=500", 0},
+	} {
+		resp, err := http.Get(srv.URL + "/api/v1/top?by=host&" + tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res report.TopResult
+		err = json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		if resp.StatusCode != http.StatusOK || res.Requests != tc.want {
+			t.Errorf("%q: got status %d and %d requests, want %d", tc.query, resp.StatusCode, res.Requests, tc.want)
+		}
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	srv := server(t)
+	for _, tc := range []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/api/v1/top?status=ok", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/top?from=yesterday", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/top?from=2023-11-15&to=2023-11-14", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/top?by=nonsense", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/top?n=ten", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/latency?bucket=-1h", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/errors?output=xml", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/summary", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/summary", http.StatusOK},
+		{http.MethodGet, "/api/v1/cache?output=csv", http.StatusOK},
+		{http.MethodGet, "/healthz", http.StatusOK},
+	} {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]string
+		if tc.want != http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body["error"] == "" {
+				t.Errorf("%s %s: got body %v (%v), want an error message", tc.method, tc.path, body, err)
+			}
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s: got status %d, want %d", tc.method, tc.path, resp.StatusCode, tc.want)
+		}
+	}
+}
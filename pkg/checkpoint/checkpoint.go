@@ -0,0 +1,147 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLookback is how far before the newest record a fetch resumes
+const DefaultLookback = 5 * time.Minute
+
+// Entry records how far fetch has got for one hostname
+type Entry struct {
+	// Partition is the last year/month/day partition fetched in full
+	Partition string `json:"partition,omitempty"`
+	// MaxTimestamp is the newest record written
+	MaxTimestamp time.Time `json:"max_timestamp"`
+	// To is the exclusive end of the last range fetched
+	To        time.Time `json:"to"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Recent are the edge request IDs and timestamps of the records written
+	// within the lookback before MaxTimestamp. A fetch resuming inside that
+	// window skips them rather than appending them to a data file again.
+	Recent map[string]time.Time `json:"recent,omitempty"`
+}
+
+// Checkpoints are the entries stored in one checkpoint file, keyed by hostname
+type Checkpoints struct {
+	Path  string           `json:"-"`
+	Hosts map[string]Entry `json:"hosts"`
+}
+
+// Load reads the checkpoint file at path. A missing file holds no entries.
+func Load(path string) (*Checkpoints, error) {
+	c := &Checkpoints{Path: path, Hosts: make(map[string]Entry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if c.Hosts == nil {
+		c.Hosts = make(map[string]Entry)
+	}
+	return c, nil
+}
+
+// Get returns the entry for hostname
+func (c *Checkpoints) Get(hostname string) (Entry, bool) {
+	e, ok := c.Hosts[hostname]
+	return e, ok
+}
+
+// Resume returns where the next fetch starts: lookback before the newest
+// record written, or before the end of the last range if no record has been
+// written yet. CloudFront delivers records to the table out of order, so a
+// record can arrive after newer ones were fetched; looking back picks it up.
+// Without a lookback the fetch starts just after the newest record.
+func (e Entry) Resume(lookback time.Duration) time.Time {
+	if e.MaxTimestamp.IsZero() {
+		return e.To.Add(-lookback)
+	}
+	if lookback <= 0 {
+		// timestamps have millisecond precision
+		return e.MaxTimestamp.Add(time.Millisecond)
+	}
+	return e.MaxTimestamp.Add(-lookback)
+}
+
+// Written reports whether the record with the edge request ID was written
+// by a fetch overlapping the next one
+func (e Entry) Written(id string) bool {
+	_, ok := e.Recent[id]
+	return ok
+}
+
+// Advance records a completed fetch ending at to for hostname whose newest
+// record is at latest (zero when nothing was fetched). written maps the edge
+// request IDs of the records written to their timestamps; those within
+// lookback of the newest record are kept for the next fetch to skip.
+func (c *Checkpoints) Advance(hostname string, to, latest time.Time, written map[string]time.Time, lookback time.Duration) {
+	e := c.Hosts[hostname]
+	if latest.After(e.MaxTimestamp) {
+		e.MaxTimestamp = latest.UTC()
+	}
+	if to.After(e.To) {
+		e.To = to.UTC()
+	}
+
+	recent := make(map[string]time.Time)
+	if lookback > 0 {
+		since := e.MaxTimestamp.Add(-lookback)
+		for _, ids := range []map[string]time.Time{e.Recent, written} {
+			for id, ts := range ids {
+				if !ts.Before(since) {
+					recent[id] = ts.UTC()
+				}
+			}
+		}
+	}
+	e.Recent = recent
+
+	// the last day ending at or before to is complete
+	day := time.Date(e.To.Year(), e.To.Month(), e.To.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	e.Partition = fmt.Sprintf("%d/%d/%d", day.Year(), int(day.Month()), day.Day())
+
+	e.UpdatedAt = time.Now().UTC()
+	c.Hosts[hostname] = e
+}
+
+// Save writes the checkpoints through a temporary file, so an interrupted
+// save leaves the previous checkpoint intact
+func (c *Checkpoints) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(c.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.Path)
+}
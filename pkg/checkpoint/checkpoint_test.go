@@ -0,0 +1,100 @@
+package checkpoint
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	hostA = "d111111abcdef8.cloudfront.net"
+	hostB = "d222222abcdef8.cloudfront.net"
+)
+
+var day = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+func TestResume(t *testing.T) {
+	latest := day.Add(10*time.Hour + 123*time.Millisecond)
+	for _, tc := range []struct {
+		name     string
+		entry    Entry
+		lookback time.Duration
+		want     time.Time
+	}{
+		{"lookback", Entry{MaxTimestamp: latest, To: day.Add(24 * time.Hour)}, time.Hour, latest.Add(-time.Hour)},
+		{"no lookback", Entry{MaxTimestamp: latest, To: day.Add(24 * time.Hour)}, 0, latest.Add(time.Millisecond)},
+		// nothing written yet: look back from the end of the range
+		{"no records", Entry{To: day.Add(24 * time.Hour)}, time.Hour, day.Add(23 * time.Hour)},
+		{"no records or lookback", Entry{To: day.Add(24 * time.Hour)}, 0, day.Add(24 * time.Hour)},
+	} {
+		if got := tc.entry.Resume(tc.lookback); !got.Equal(tc.want) {
+			t.Errorf("%s: resume at %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "out.ndjson.checkpoint.json")
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(hostA); ok {
+		t.Fatal("entry found in a missing checkpoint file")
+	}
+
+	// The first fetch keeps the IDs within the lookback of its newest record
+	c.Advance(hostA, day.Add(36*time.Hour), day.Add(32*time.Hour), map[string]time.Time{
+		"req-06": day.Add(24 * time.Hour),
+		"req-07": day.Add(28 * time.Hour),
+		"req-08": day.Add(32 * time.Hour),
+	}, 5*time.Hour)
+	// A fetch of another host with nothing new leaves hostA alone
+	c.Advance(hostB, day.Add(12*time.Hour), time.Time{}, nil, 5*time.Hour)
+
+	a, _ := c.Get(hostA)
+	if !a.MaxTimestamp.Equal(day.Add(32*time.Hour)) || !a.To.Equal(day.Add(36*time.Hour)) || a.Partition != "2023/11/14" {
+		t.Errorf("host A entry %+v", a)
+	}
+	if !a.Written("req-07") || !a.Written("req-08") || a.Written("req-06") {
+		t.Errorf("host A recent %v, want req-07 and req-08", a.Recent)
+	}
+	b, _ := c.Get(hostB)
+	if !b.MaxTimestamp.IsZero() || !b.To.Equal(day.Add(12*time.Hour)) || len(b.Recent) != 0 || b.Partition != "2023/11/13" {
+		t.Errorf("host B entry %+v", b)
+	}
+
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Hosts[hostA].Recent, a.Recent) || !loaded.Hosts[hostA].MaxTimestamp.Equal(a.MaxTimestamp) {
+		t.Errorf("loaded %+v, saved %+v", loaded.Hosts[hostA], a)
+	}
+
+	// The next fetch overlapping the last one merges the IDs, drops those
+	// that fell out of the lookback and never moves the checkpoint back
+	loaded.Advance(hostA, day.Add(30*time.Hour), day.Add(34*time.Hour), map[string]time.Time{
+		"req-09": day.Add(34 * time.Hour),
+	}, 5*time.Hour)
+	a, _ = loaded.Get(hostA)
+	if !a.MaxTimestamp.Equal(day.Add(34*time.Hour)) || !a.To.Equal(day.Add(36*time.Hour)) {
+		t.Errorf("host A entry %+v after the overlapping fetch", a)
+	}
+	want := map[string]time.Time{"req-08": day.Add(32 * time.Hour), "req-09": day.Add(34 * time.Hour)}
+	if !reflect.DeepEqual(a.Recent, want) {
+		t.Errorf("host A recent %v, want %v", a.Recent, want)
+	}
+
+	// Without a lookback no IDs are kept
+	loaded.Advance(hostA, day.Add(48*time.Hour), day.Add(40*time.Hour), map[string]time.Time{
+		"req-10": day.Add(40 * time.Hour),
+	}, 0)
+	if a, _ = loaded.Get(hostA); len(a.Recent) != 0 {
+		t.Errorf("host A recent %v without a lookback", a.Recent)
+	}
+}
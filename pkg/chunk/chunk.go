@@ -0,0 +1,152 @@
+package chunk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/writer"
+)
+
+// manifestFile names the description of the fetch a chunk directory belongs to
+const manifestFile = "manifest.json"
+
+// Range is the half-open time range [From, To)
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Split divides [from, to) into ranges whose boundaries fall on multiples of
+// size, so the same chunk covers the same hours however the range was given
+func Split(from, to time.Time, size time.Duration) []Range {
+	from = from.UTC()
+	to = to.UTC()
+
+	var ranges []Range
+	for start := from; start.Before(to); {
+		end := start.Truncate(size).Add(size)
+		if end.After(to) {
+			end = to
+		}
+		ranges = append(ranges, Range{From: start, To: end})
+		start = end
+	}
+	return ranges
+}
+
+// Manifest describes a chunked fetch. Chunks are only reused by a fetch with
+// the same manifest.
+type Manifest struct {
+	Hostname      string    `json:"hostname"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Size          string    `json:"size"`
+	Status        []int     `json:"status,omitempty"`
+	Methods       []string  `json:"methods,omitempty"`
+	EdgeLocations []string  `json:"edge_locations,omitempty"`
+	Fields        []string  `json:"fields,omitempty"`
+}
+
+// Dir holds the committed chunks of one fetch
+type Dir struct {
+	Path     string
+	Manifest Manifest
+}
+
+// LoadManifest returns the manifest of the chunk directory at path, or nil if there is none
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(path, manifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Open returns the chunk directory at path, creating it for m if needed.
+// An existing directory made for a different fetch is an error rather than
+// being cleared, since its chunks may be the only copy of that data.
+func Open(path string, m Manifest) (*Dir, error) {
+	existing, err := LoadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		if !sameManifest(existing, &m) {
+			return nil, fmt.Errorf("%s holds chunks of a different fetch (%s to %s); finish that fetch or remove the directory",
+				path, existing.From.Format(time.RFC3339), existing.To.Format(time.RFC3339))
+		}
+		return &Dir{Path: path, Manifest: *existing}, nil
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(path, manifestFile), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return &Dir{Path: path, Manifest: m}, nil
+}
+
+// sameManifest compares manifests, treating empty and nil lists alike
+func sameManifest(a, b *Manifest) bool {
+	norm := func(m *Manifest) Manifest {
+		n := *m
+		n.From = n.From.UTC()
+		n.To = n.To.UTC()
+		if len(n.Status) == 0 {
+			n.Status = nil
+		}
+		if len(n.Methods) == 0 {
+			n.Methods = nil
+		}
+		if len(n.EdgeLocations) == 0 {
+			n.EdgeLocations = nil
+		}
+		if len(n.Fields) == 0 {
+			n.Fields = nil
+		}
+		return n
+	}
+	return reflect.DeepEqual(norm(a), norm(b))
+}
+
+// File returns the path of the chunk holding r
+func (d *Dir) File(r Range) string {
+	return filepath.Join(d.Path, r.From.UTC().Format("20060102T150405Z")+"."+writer.FormatGob)
+}
+
+// Done reports whether the chunk holding r has been committed
+func (d *Dir) Done(r Range) bool {
+	_, err := os.Stat(d.File(r))
+	return err == nil
+}
+
+// Create returns a writer for the chunk holding r.
+// The chunk only appears once the writer is closed.
+func (d *Dir) Create(r Range) (*writer.File, error) {
+	return writer.Create(d.File(r), writer.FormatGob)
+}
+
+// Remove deletes the directory and every chunk in it
+func (d *Dir) Remove() error {
+	return os.RemoveAll(d.Path)
+}
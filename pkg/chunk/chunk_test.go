@@ -0,0 +1,117 @@
+package chunk
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+func TestSplit(t *testing.T) {
+	day := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+	ranges := Split(day.Add(90*time.Minute), day.Add(5*time.Hour), 2*time.Hour)
+	want := []Range{
+		{day.Add(90 * time.Minute), day.Add(2 * time.Hour)},
+		{day.Add(2 * time.Hour), day.Add(4 * time.Hour)},
+		{day.Add(4 * time.Hour), day.Add(5 * time.Hour)},
+	}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("got %v, want %v", ranges, want)
+	}
+	if ranges := Split(day, day, time.Hour); len(ranges) != 0 {
+		t.Errorf("empty range split into %v", ranges)
+	}
+}
+
+func TestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson.parts")
+	day := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+	m := Manifest{
+		Hostname: "d111111abcdef8.cloudfront.net",
+		From:     day,
+		To:       day.Add(72 * time.Hour),
+		Size:     "24h0m0s",
+		Status:   []int{404},
+	}
+	ranges := Split(m.From, m.To, 24*time.Hour)
+
+	dir, err := Open(path, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first chunk is committed
+	w, err := dir.Create(ranges[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&rtl.Record{EdgeRequestID: "req-00", Timestamp: day}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second fails part way through
+	w, err = dir.Create(ranges[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&rtl.Record{EdgeRequestID: "req-06", Timestamp: day.Add(24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if dir.Done(ranges[1]) {
+		t.Error("chunk done before its writer was closed")
+	}
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"20231114T000000Z.gob", manifestFile}; !reflect.DeepEqual(names, want) {
+		t.Errorf("chunk directory holds %v, want %v", names, want)
+	}
+
+	// A rerun of the same fetch, however its times and lists were given,
+	// reuses the committed chunk and redoes the partial one
+	again := m
+	again.From = day.In(time.FixedZone("EST", -5*60*60))
+	again.Methods = []string{}
+	dir, err = Open(path, again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, false, false} {
+		if got := dir.Done(ranges[i]); got != want {
+			t.Errorf("chunk %d done %t, want %t", i, got, want)
+		}
+	}
+
+	// A different fetch is refused and leaves the chunks alone
+	other := m
+	other.Status = nil
+	if _, err := Open(path, other); err == nil || !strings.Contains(err.Error(), "different fetch") {
+		t.Errorf("got %v, want a different fetch error", err)
+	}
+	if !dir.Done(ranges[0]) {
+		t.Error("committed chunk removed by a different fetch")
+	}
+
+	if err := dir.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := LoadManifest(path); err != nil || loaded != nil {
+		t.Errorf("manifest %v, %v after Remove", loaded, err)
+	}
+}
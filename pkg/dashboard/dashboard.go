@@ -0,0 +1,28 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// static holds the single page app. It has no external dependencies so the
+// dashboard works without network access.
+//
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard at / and passes /api/ and /healthz to api
+func Handler(api http.Handler) http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// the embedded tree is fixed at build time
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", api)
+	mux.Handle("/healthz", api)
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	return mux
+}
@@ -0,0 +1,237 @@
+// Dashboard for the rtl-trino-analysis summary API. Everything is drawn with
+// plain SVG so the page works offline.
+(function () {
+  "use strict";
+
+  var SVGNS = "http://www.w3.org/2000/svg";
+  var FILTERS = ["from", "to", "host", "country", "status", "uri"];
+
+  // Rough continent outlines as [longitude, latitude] pairs, enough to place
+  // the country markers in context.
+  var LAND = [
+    [[-166, 68], [-156, 71], [-130, 70], [-110, 73], [-85, 70], [-80, 63], [-95, 60], [-90, 57], [-78, 55], [-65, 60], [-55, 52], [-65, 45], [-70, 42], [-76, 35], [-81, 31], [-80, 25], [-83, 29], [-90, 30], [-97, 27], [-97, 21], [-87, 21], [-88, 15], [-83, 10], [-78, 8], [-80, 8], [-86, 12], [-92, 15], [-105, 20], [-110, 24], [-115, 30], [-118, 34], [-124, 40], [-124, 48], [-130, 55], [-140, 60], [-150, 60], [-165, 55], [-160, 60], [-166, 62]],
+    [[-73, 78], [-60, 82], [-30, 83], [-20, 78], [-22, 70], [-40, 65], [-44, 60], [-52, 64], [-56, 72], [-68, 76]],
+    [[-78, 8], [-72, 12], [-62, 10], [-52, 5], [-50, 0], [-35, -5], [-38, -13], [-40, -22], [-48, -26], [-53, -34], [-58, -38], [-65, -42], [-68, -52], [-72, -52], [-75, -45], [-73, -37], [-71, -25], [-70, -18], [-76, -14], [-81, -5], [-80, 0]],
+    [[-10, 36], [-9, 43], [-2, 44], [-4, 48], [2, 51], [5, 53], [8, 57], [5, 62], [10, 64], [15, 69], [25, 71], [32, 70], [40, 67], [45, 68], [60, 68], [60, 50], [50, 45], [40, 42], [28, 41], [26, 38], [22, 37], [20, 40], [14, 41], [16, 38], [12, 38], [12, 44], [8, 44], [3, 43], [-5, 36]],
+    [[-5, 50], [1, 51], [2, 53], [-2, 56], [-3, 58], [-6, 58], [-5, 55], [-3, 54], [-5, 52]],
+    [[-17, 15], [-17, 21], [-13, 28], [-9, 32], [-6, 36], [10, 37], [11, 33], [20, 32], [25, 32], [32, 31], [34, 28], [43, 12], [51, 12], [42, 0], [40, -10], [40, -16], [35, -24], [32, -29], [27, -34], [20, -35], [18, -32], [12, -18], [13, -9], [9, -1], [9, 4], [5, 6], [-4, 5], [-8, 4], [-13, 8], [-17, 12]],
+    [[44, -25], [47, -25], [50, -15], [49, -12], [44, -17]],
+    [[26, 41], [36, 36], [35, 32], [43, 13], [52, 16], [57, 19], [60, 23], [67, 25], [72, 21], [77, 8], [80, 15], [88, 22], [92, 21], [98, 16], [98, 8], [103, 1], [104, 10], [109, 12], [108, 21], [115, 22], [122, 30], [120, 37], [126, 38], [130, 42], [140, 47], [142, 54], [135, 55], [142, 59], [155, 59], [163, 63], [178, 65], [180, 69], [160, 70], [140, 73], [113, 74], [100, 78], [80, 73], [68, 73], [60, 68], [60, 50], [50, 45], [40, 42]],
+    [[130, 31], [135, 34], [140, 35], [141, 38], [142, 43], [145, 44], [141, 45], [139, 40], [136, 37], [132, 35]],
+    [[95, 5], [106, -6], [114, -8], [120, -9], [125, -8], [119, -4], [117, 1], [118, 7], [110, 2], [104, 1]],
+    [[114, -22], [114, -34], [118, -35], [124, -34], [131, -31], [138, -35], [141, -38], [147, -38], [150, -37], [153, -32], [153, -25], [146, -19], [142, -11], [137, -12], [136, -15], [130, -12], [126, -14], [122, -18]],
+    [[172, -34], [178, -38], [175, -42], [171, -46], [167, -46], [172, -41]]
+  ];
+
+  function $(id) { return document.getElementById(id); }
+
+  function el(name, attrs, parent) {
+    var node = document.createElementNS(SVGNS, name);
+    for (var k in attrs) { node.setAttribute(k, attrs[k]); }
+    if (parent) { parent.appendChild(node); }
+    return node;
+  }
+
+  function clear(node) {
+    while (node.firstChild) { node.removeChild(node.firstChild); }
+  }
+
+  function fmtNumber(n) {
+    return Number(n).toLocaleString();
+  }
+
+  function fmtBytes(n) {
+    var units = ["B", "KB", "MB", "GB", "TB", "PB"];
+    var i = 0;
+    while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+    return n.toFixed(i ? 1 : 0) + " " + units[i];
+  }
+
+  function fmtPercent(r) {
+    return (r * 100).toFixed(2) + "%";
+  }
+
+  function fmtTime(t) {
+    return t.replace("T", " ").replace(/:00Z$|Z$/, "");
+  }
+
+  // query returns the filters in the page URL as API query parameters
+  function query() {
+    var params = new URLSearchParams(location.search);
+    var out = new URLSearchParams();
+    FILTERS.forEach(function (k) {
+      var v = params.get(k);
+      if (v) { out.set(k, v); }
+    });
+    out.set("n", "10");
+    return out;
+  }
+
+  // chart draws values as a line with a shaded area and min/max labels
+  function chart(svg, series, value, format, max) {
+    clear(svg);
+    var w = 900, h = 220, pad = 18;
+    el("line", { x1: 0, y1: h - pad, x2: w, y2: h - pad, "class": "axis" }, svg);
+    if (!series.length) { return; }
+
+    var values = series.map(value);
+    if (max === undefined) { max = Math.max.apply(null, values) || 1; }
+    var step = series.length > 1 ? w / (series.length - 1) : 0;
+    var points = values.map(function (v, i) {
+      return [i * step, h - pad - (v / max) * (h - 2 * pad)];
+    });
+
+    var line = points.map(function (p) { return p[0].toFixed(1) + "," + p[1].toFixed(1); }).join(" ");
+    el("polygon", { points: "0," + (h - pad) + " " + line + " " + (points[points.length - 1][0]).toFixed(1) + "," + (h - pad), "class": "area" }, svg);
+    el("polyline", { points: line, "class": "line" }, svg);
+
+    el("text", { x: 4, y: pad - 4 }, svg).textContent = format(max);
+    el("text", { x: 4, y: h - 4 }, svg).textContent = fmtTime(series[0].time);
+    el("text", { x: w - 4, y: h - 4, "text-anchor": "end" }, svg).textContent = fmtTime(series[series.length - 1].time);
+  }
+
+  // statusChart draws the share of each status class as stacked areas
+  function statusChart(svg, series) {
+    clear(svg);
+    var w = 900, h = 220, pad = 18;
+    if (!series.length) { return; }
+
+    var classes = ["status_2xx", "status_3xx", "status_4xx", "status_5xx"];
+    var step = series.length > 1 ? w / (series.length - 1) : w;
+    var lower = series.map(function () { return 0; });
+    classes.forEach(function (c) {
+      var upper = series.map(function (p, i) {
+        return lower[i] + (p.requests ? p[c] / p.requests : 0);
+      });
+      var y = function (share) { return h - pad - share * (h - 2 * pad); };
+      var top = upper.map(function (s, i) { return (i * step).toFixed(1) + "," + y(s).toFixed(1); });
+      var bottom = lower.map(function (s, i) { return (i * step).toFixed(1) + "," + y(s).toFixed(1); }).reverse();
+      el("polygon", { points: top.concat(bottom).join(" "), "class": "s" + c.slice(7) }, svg);
+      lower = upper;
+    });
+
+    el("text", { x: 4, y: h - 4 }, svg).textContent = fmtTime(series[0].time);
+    el("text", { x: w - 4, y: h - 4, "text-anchor": "end" }, svg).textContent = fmtTime(series[series.length - 1].time);
+  }
+
+  function project(lon, lat) {
+    return [(lon + 180) / 360 * 1000, (90 - lat) / 180 * 500];
+  }
+
+  // worldMap plots each country at the mean location of its clients
+  function worldMap(svg, countries) {
+    clear(svg);
+    for (var lon = -150; lon <= 150; lon += 30) {
+      var x = project(lon, 0)[0];
+      el("line", { x1: x, y1: 0, x2: x, y2: 500, "class": "grid" }, svg);
+    }
+    for (var lat = -60; lat <= 60; lat += 30) {
+      var y = project(0, lat)[1];
+      el("line", { x1: 0, y1: y, x2: 1000, y2: y, "class": "grid" }, svg);
+    }
+    LAND.forEach(function (shape) {
+      el("polygon", {
+        points: shape.map(function (p) { return project(p[0], p[1]).join(","); }).join(" "),
+        "class": "land"
+      }, svg);
+    });
+
+    var located = countries.filter(function (c) { return c.latitude || c.longitude; });
+    if (!located.length) {
+      el("text", { x: 500, y: 250, "text-anchor": "middle" }, svg).textContent = "No GeoIP locations in this data";
+      return;
+    }
+    var max = Math.max.apply(null, located.map(function (c) { return c.requests; }));
+    located.forEach(function (c) {
+      var p = project(c.longitude, c.latitude);
+      var r = 4 + 26 * Math.sqrt(c.requests / max);
+      var point = el("circle", { cx: p[0], cy: p[1], r: r, "class": "point" }, svg);
+      el("title", {}, point).textContent = c.country + ": " + fmtNumber(c.requests) + " requests";
+      el("text", { x: p[0], y: p[1] + 4, "text-anchor": "middle", "class": "label" }, svg).textContent = c.country;
+    });
+  }
+
+  function table(id, rows, cells) {
+    var body = $(id).tBodies[0];
+    while (body.rows.length) { body.deleteRow(0); }
+    rows.forEach(function (row) {
+      var tr = body.insertRow();
+      cells(row).forEach(function (v) { tr.insertCell().textContent = v; });
+    });
+  }
+
+  function render(s) {
+    $("requests").textContent = fmtNumber(s.requests);
+    $("bytes").textContent = fmtBytes(s.bytes);
+    $("error-rate").textContent = fmtPercent(s.status.error_rate);
+    $("hit-ratio").textContent = fmtPercent(s.cache.hit_ratio + s.cache.refresh_hit_ratio);
+    $("bucket").textContent = "per " + s.bucket;
+
+    var series = s.series || [];
+    chart($("volume"), series, function (p) { return p.requests; }, fmtNumber);
+    statusChart($("status"), series);
+    chart($("cache"), series, function (p) { return p.hit_ratio; }, fmtPercent, 1);
+
+    var countries = s.countries || [];
+    worldMap($("map"), countries);
+    table("countries", countries, function (c) {
+      return [c.country || "(none)", fmtNumber(c.requests), fmtPercent(s.requests ? c.requests / s.requests : 0)];
+    });
+    table("uris", s.top_uris || [], function (u) {
+      return [u.key, fmtNumber(u.requests), fmtPercent(u.requests_share), fmtBytes(u.bytes)];
+    });
+  }
+
+  function load() {
+    $("message").textContent = "Loading...";
+    fetch("api/v1/summary?" + query().toString())
+      .then(function (res) {
+        return res.json().then(function (body) {
+          if (!res.ok) { throw new Error(body.error || res.statusText); }
+          return body;
+        });
+      })
+      .then(function (summary) {
+        $("message").textContent = "";
+        render(summary);
+      })
+      .catch(function (err) {
+        $("message").textContent = "Error: " + err.message;
+      });
+  }
+
+  function init() {
+    var form = $("filters");
+    var params = new URLSearchParams(location.search);
+    FILTERS.forEach(function (k) { form.elements[k].value = params.get(k) || ""; });
+
+    // Filters live in the URL so a link reproduces the view
+    form.addEventListener("submit", function (e) {
+      e.preventDefault();
+      var next = new URLSearchParams();
+      FILTERS.forEach(function (k) {
+        var v = form.elements[k].value.trim();
+        if (v) { next.set(k, v); }
+      });
+      history.pushState(null, "", "?" + next.toString());
+      load();
+    });
+    window.addEventListener("popstate", function () {
+      var params = new URLSearchParams(location.search);
+      FILTERS.forEach(function (k) { form.elements[k].value = params.get(k) || ""; });
+      load();
+    });
+
+    $("share").addEventListener("click", function () {
+      if (navigator.clipboard) {
+        navigator.clipboard.writeText(location.href);
+      } else {
+        window.prompt("Copy this link", location.href);
+      }
+    });
+
+    load();
+  }
+
+  init();
+})();
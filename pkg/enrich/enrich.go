@@ -0,0 +1,124 @@
+package enrich
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+)
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// enricher configs
+type Config struct {
+	geo *geoip.Config
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// geoip must be set
+	if config.geo == nil {
+		return nil, fmt.Errorf("geoip is required")
+	}
+
+	return config, nil
+}
+
+// SetGeoIP sets the GeoIP database used for client lookups
+func SetGeoIP(geo *geoip.Config) Option {
+	return func(c *Config) {
+		c.geo = geo
+	}
+}
+
+// Record converts a raw Trino entry into a typed and enriched record
+func (c *Config) Record(entry *fetch.Entry) (*rtl.Record, error) {
+	// Convert the timestamp string to a time.Time
+	epoch, err := fetch.Millis(entry.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := time.UnixMilli(epoch)
+
+	// Convert the year, month, and day strings to ints
+	year, err := strconv.Atoi(entry.Year)
+	if err != nil {
+		return nil, err
+	}
+	month, err := strconv.Atoi(entry.Month)
+	if err != nil {
+		return nil, err
+	}
+	day, err := strconv.Atoi(entry.Day)
+	if err != nil {
+		return nil, err
+	}
+
+	geodata, err := c.geo.Lookup(net.ParseIP(entry.ClientIP))
+	if err != nil {
+		return nil, err
+	}
+
+	uaparser, err := useragent.Parse(entry.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rtl.Record{
+		Timestamp:                timestamp,
+		ClientIPAddr:             entry.ClientIP,
+		Status:                   entry.Status,
+		Bytes:                    entry.Bytes,
+		Method:                   entry.Method,
+		Protocol:                 entry.Protocol,
+		Host:                     entry.Host,
+		UriStem:                  entry.UriStem,
+		EdgeLocation:             entry.EdgeLocation,
+		EdgeRequestID:            entry.EdgeRequestID,
+		HostHeader:               entry.HostHeader,
+		TimeTaken:                entry.TimeTaken,
+		ProtoVersion:             entry.ProtoVersion,
+		IPVersion:                entry.IPVersion,
+		Referer:                  entry.Referer,
+		Cookie:                   entry.Cookie,
+		UriQuery:                 entry.UriQuery,
+		EdgeResponseResultType:   entry.EdgeResponseResultType,
+		SslProtocol:              entry.SslProtocol,
+		SslCipher:                entry.SslCipher,
+		EdgeResultType:           entry.EdgeResultType,
+		ContentType:              entry.ContentType,
+		ContentLength:            entry.ContentLength,
+		EdgeDetailedResultType:   entry.EdgeDetailedResultType,
+		Country:                  entry.Country,
+		CacheBehaviorPathPattern: entry.CacheBehaviorPathPattern,
+		Year:                     year,
+		Month:                    month,
+		Day:                      day,
+		TimeToFirstByte:          entry.TimeToFirstByte,
+		OriginFBL:                entry.OriginFBL,
+		OriginLBL:                entry.OriginLBL,
+		ClientPort:               entry.ClientPort,
+		ASN:                      entry.ASN,
+		RangeStart:               entry.RangeStart,
+		RangeEnd:                 entry.RangeEnd,
+		AcceptEncoding:           entry.AcceptEncoding,
+		Accept:                   entry.Accept,
+		HeadersCount:             entry.HeadersCount,
+		ClientIP:                 geodata,
+		UserAgent:                uaparser,
+		Extra:                    entry.Extra,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package enrich
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip/geoiptest"
+)
+
+func TestRecordTimestamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := geoiptest.Write(path, geoiptest.City{Network: "192.0.2.0/24", Country: "US"}); err != nil {
+		t.Fatal(err)
+	}
+	geo, err := geoip.New(geoip.SetGeoDB(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer geo.Close()
+	c, err := New(SetGeoIP(geo))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Unix(1650000000, 0)
+	for _, tc := range []struct {
+		timestamp string
+		want      time.Time
+	}{
+		{"1650000000.123", base.Add(123 * time.Millisecond)},
+		// log files do not always carry three fractional digits
+		{"1650000000.5", base.Add(500 * time.Millisecond)},
+		{"1650000000.05", base.Add(50 * time.Millisecond)},
+		{"1650000000", base},
+		{"1650000000.123456", base.Add(123 * time.Millisecond)},
+	} {
+		record, err := c.Record(&fetch.Entry{
+			Timestamp: tc.timestamp,
+			ClientIP:  "192.0.2.1",
+			Year:      "2022",
+			Month:     "4",
+			Day:       "15",
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tc.timestamp, err)
+			continue
+		}
+		if !record.Timestamp.Equal(tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.timestamp, record.Timestamp.UTC(), tc.want.UTC())
+		}
+	}
+
+	if _, err := c.Record(&fetch.Entry{Timestamp: "yesterday", Year: "2022", Month: "4", Day: "15"}); err == nil {
+		t.Error("expected an error for a malformed timestamp")
+	}
+}
@@ -39,6 +39,21 @@ type Entry struct {
 	Year                     string  `db:"year"`
 	Month                    string  `db:"month"`
 	Day                      string  `db:"day"`
+
+	// Fields from newer real-time log configurations, zero when not logged
+	TimeToFirstByte float64 `db:"time_to_first_byte"`
+	OriginFBL       float64 `db:"origin_fbl"`
+	OriginLBL       float64 `db:"origin_lbl"`
+	ClientPort      int     `db:"client_port"`
+	ASN             int64   `db:"asn"`
+	RangeStart      int64   `db:"range_start"`
+	RangeEnd        int64   `db:"range_end"`
+	AcceptEncoding  string  `db:"accept_encoding"`
+	Accept          string  `db:"accept"`
+	HeadersCount    int     `db:"headers_count"`
+
+	// Extra holds the mapped fields Entry has no field for, by column
+	Extra map[string]string `db:"-"`
 }
 
 // Used to manage varidic options
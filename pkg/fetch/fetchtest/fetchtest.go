@@ -0,0 +1,434 @@
+// Package fetchtest provides an in-process stand-in for a Trino coordinator,
+// for testing code that fetches real-time log entries without a cluster.
+//
+// The server speaks enough of the Trino client protocol for the
+// trino-go-client driver: a POST to /v1/statement starts a query and each
+// response links the next page of rows through nextUri until the result is
+// exhausted. Queries return the columns they select, with values taken from
+// the matching fetch.Entry fields or, failing that, from Entry.Extra.
+package fetchtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+)
+
+// DefaultPageSize is the number of rows returned per page
+const DefaultPageSize = 100
+
+// Query is a statement received by the server
+type Query struct {
+	// SQL is the statement text, with ? placeholders when arguments were bound
+	SQL string
+	// Args are the bound arguments as the client serialized them,
+	// e.g. 1700000000.000 or '%example.com'
+	Args []string
+}
+
+// Arg returns bound argument i without the quoting of string literals
+func (q *Query) Arg(i int) string {
+	if i >= len(q.Args) {
+		return ""
+	}
+	arg := q.Args[i]
+	if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+		return strings.ReplaceAll(arg[1:len(arg)-1], "''", "'")
+	}
+	return arg
+}
+
+// Server is a fake Trino coordinator serving fixture rows
+type Server struct {
+	// URL is the base URL of the server
+	URL string
+
+	// PageSize is the number of rows per page
+	PageSize int
+
+	// Select picks the rows answering a query. When it is nil every row is
+	// returned; when it returns an error the query fails with that message.
+	Select func(q *Query, rows []fetch.Entry) ([]fetch.Entry, error)
+
+	rows    []fetch.Entry
+	srv     *httptest.Server
+	mu      sync.Mutex
+	queries []Query
+	results map[string]*result
+	seq     int
+}
+
+// result is the state of a running query
+type result struct {
+	columns []column
+	rows    []fetch.Entry
+	err     error
+}
+
+// NewServer starts a server holding rows. The caller should Close it when finished.
+func NewServer(rows []fetch.Entry) *Server {
+	s := &Server{
+		PageSize: DefaultPageSize,
+		rows:     rows,
+		results:  make(map[string]*result),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/statement", s.statement)
+	mux.HandleFunc("/v1/statement/executing/", s.executing)
+	mux.HandleFunc("/v1/query/", s.cancel)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+
+	return s
+}
+
+// DSN returns a trino-go-client connection string for the server
+func (s *Server) DSN() string {
+	u, _ := url.Parse(s.URL)
+	u.User = url.User("test")
+	u.RawQuery = "catalog=hive&schema=cfrtl"
+	return u.String()
+}
+
+// Queries returns the statements received so far, in order
+func (s *Server) Queries() []Query {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Query(nil), s.queries...)
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Range is a Select answering queries built by fetch.Query the way the real
+// table would: a row is kept when its timestamp lies in the bound time range
+// and its host is the bound hostname or one of its subdomains. Other predicates are ignored.
+func Range(q *Query, rows []fetch.Entry) ([]fetch.Entry, error) {
+	if len(q.Args) < 2 {
+		return nil, fmt.Errorf("query has no time range: %s", q.SQL)
+	}
+	from, err := fetch.Millis(q.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	to, err := fetch.Millis(q.Arg(1))
+	if err != nil {
+		return nil, err
+	}
+	var host string
+	if strings.Contains(q.SQL, "host = ?") {
+		host = q.Arg(2)
+	}
+
+	var selected []fetch.Entry
+	for _, row := range rows {
+		ts, err := fetch.Millis(row.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if ts >= from && ts < to && fetch.MatchHost(row.Host, host) {
+			selected = append(selected, row)
+		}
+	}
+	return selected, nil
+}
+
+// statement starts a query and links its first page
+func (s *Server) statement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q, err := parse(string(body), r.Header.Values("X-Trino-Prepared-Statement"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := &result{rows: s.rows}
+	if res.columns, err = selected(q.SQL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.Select != nil {
+		res.rows, res.err = s.Select(q, s.rows)
+	}
+
+	s.mu.Lock()
+	s.queries = append(s.queries, *q)
+	s.seq++
+	id := fmt.Sprintf("fetchtest_%d", s.seq)
+	s.results[id] = res
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"id":      id,
+		"infoUri": s.URL + "/ui/query.html?" + id,
+		"nextUri": s.page(id, 0),
+		"stats":   map[string]interface{}{"state": "QUEUED"},
+	})
+}
+
+// executing serves one page of a running query
+func (s *Server) executing(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/statement/executing/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	id := parts[0]
+	token, err := strconv.Atoi(parts[1])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	res, ok := s.results[id]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"id":      id,
+		"infoUri": s.URL + "/ui/query.html?" + id,
+	}
+
+	if res.err != nil {
+		resp["stats"] = map[string]interface{}{"state": "FAILED"}
+		resp["error"] = map[string]interface{}{
+			"message":     res.err.Error(),
+			"errorName":   "GENERIC_INTERNAL_ERROR",
+			"errorCode":   65536,
+			"failureInfo": map[string]interface{}{"type": "fetchtest.Failure"},
+		}
+		s.forget(id)
+		writeJSON(w, resp)
+		return
+	}
+
+	size := s.PageSize
+	if size < 1 {
+		size = DefaultPageSize
+	}
+	start := token * size
+	if start > len(res.rows) {
+		start = len(res.rows)
+	}
+	end := start + size
+	if end > len(res.rows) {
+		end = len(res.rows)
+	}
+
+	data := make([][]interface{}, 0, end-start)
+	for i := range res.rows[start:end] {
+		data = append(data, values(&res.rows[start+i], res.columns))
+	}
+
+	resp["columns"] = res.columns
+	resp["data"] = data
+	if end < len(res.rows) {
+		resp["nextUri"] = s.page(id, token+1)
+		resp["stats"] = map[string]interface{}{"state": "RUNNING"}
+	} else {
+		resp["stats"] = map[string]interface{}{"state": "FINISHED"}
+		s.forget(id)
+	}
+	writeJSON(w, resp)
+}
+
+// cancel acknowledges a client closing its result early
+func (s *Server) cancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.forget(strings.TrimPrefix(r.URL.Path, "/v1/query/"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) page(id string, token int) string {
+	return fmt.Sprintf("%s/v1/statement/executing/%s/%d", s.URL, id, token)
+}
+
+func (s *Server) forget(id string) {
+	s.mu.Lock()
+	delete(s.results, id)
+	s.mu.Unlock()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// parse recovers the statement and its arguments from a request body.
+// With bound arguments the client sends EXECUTE _trino_go USING ... and
+// passes the statement itself in the prepared statement header.
+func parse(body string, prepared []string) (*Query, error) {
+	const execute = "EXECUTE _trino_go USING "
+	if !strings.HasPrefix(body, execute) {
+		return &Query{SQL: body}, nil
+	}
+
+	q := &Query{}
+	for _, header := range prepared {
+		for _, stmt := range strings.Split(header, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(stmt), "=")
+			if !ok || name != "_trino_go" {
+				continue
+			}
+			sql, err := url.QueryUnescape(value)
+			if err != nil {
+				return nil, err
+			}
+			q.SQL = sql
+		}
+	}
+	if q.SQL == "" {
+		return nil, fmt.Errorf("EXECUTE without a prepared statement")
+	}
+
+	args, err := splitArgs(strings.TrimPrefix(body, execute))
+	if err != nil {
+		return nil, err
+	}
+	q.Args = args
+	return q, nil
+}
+
+// splitArgs splits a comma separated argument list, keeping quoted strings whole
+func splitArgs(list string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	quoted := false
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+			arg.WriteByte(c)
+		case c == ',' && !quoted:
+			args = append(args, strings.TrimSpace(arg.String()))
+			arg.Reset()
+		default:
+			arg.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated string in %q", list)
+	}
+	return append(args, strings.TrimSpace(arg.String())), nil
+}
+
+// column describes a result column the way Trino does
+type column struct {
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	TypeSignature typeSignature `json:"typeSignature"`
+}
+
+type typeSignature struct {
+	RawType   string        `json:"rawType"`
+	Arguments []interface{} `json:"arguments"`
+}
+
+// selected returns the columns a statement selects. SELECT * selects the
+// columns of fetch.Entry.
+func selected(sql string) ([]column, error) {
+	list, _, ok := strings.Cut(strings.TrimPrefix(sql, "SELECT "), " FROM ")
+	if !ok || list == sql {
+		return nil, fmt.Errorf("unsupported statement %q", sql)
+	}
+
+	var names []string
+	if list == "*" {
+		t := reflect.TypeOf(fetch.Entry{})
+		for i := 0; i < t.NumField(); i++ {
+			if tag := t.Field(i).Tag.Get("db"); tag != "-" {
+				names = append(names, tag)
+			}
+		}
+	} else {
+		for _, name := range strings.Split(list, ",") {
+			names = append(names, strings.Trim(strings.TrimSpace(name), `"`))
+		}
+	}
+
+	columns := make([]column, 0, len(names))
+	for _, name := range names {
+		typ := fetch.Varchar
+		if f, ok := fetch.LookupField(name); ok && f.Column == name {
+			typ = f.Type
+		} else if !isPartition(name) {
+			return nil, fmt.Errorf("column %q cannot be resolved", name)
+		}
+		columns = append(columns, column{
+			Name:          name,
+			Type:          string(typ),
+			TypeSignature: typeSignature{RawType: string(typ), Arguments: []interface{}{}},
+		})
+	}
+	return columns, nil
+}
+
+func isPartition(name string) bool {
+	for _, p := range fetch.PartitionColumns {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// entryFields maps columns to the position of the fetch.Entry field holding them
+var entryFields = func() map[string]int {
+	index := map[string]int{}
+	t := reflect.TypeOf(fetch.Entry{})
+	for i := 0; i < t.NumField(); i++ {
+		index[t.Field(i).Tag.Get("db")] = i
+	}
+	return index
+}()
+
+// values returns the row for entry in column order. Extra values are text,
+// so numeric ones are sent as JSON numbers the way Trino sends them.
+func values(entry *fetch.Entry, columns []column) []interface{} {
+	v := reflect.ValueOf(entry).Elem()
+	row := make([]interface{}, len(columns))
+	for i, c := range columns {
+		if index, ok := entryFields[c.Name]; ok {
+			row[i] = v.Field(index).Interface()
+			continue
+		}
+		value, ok := entry.Extra[c.Name]
+		switch {
+		case !ok:
+		case c.Type == string(fetch.Varchar):
+			row[i] = value
+		default:
+			row[i] = json.Number(value)
+		}
+	}
+	return row
+}
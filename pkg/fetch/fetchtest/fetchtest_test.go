@@ -0,0 +1,197 @@
+package fetchtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+)
+
+func entries(n int) []fetch.Entry {
+	rows := make([]fetch.Entry, n)
+	for i := range rows {
+		rows[i] = fetch.Entry{
+			Timestamp:     fmt.Sprintf("%d.%03d", 1700000000+i*60, i),
+			ClientIP:      "192.0.2.1",
+			Status:        200 + i,
+			Bytes:         int64(1000 * i),
+			Method:        "GET",
+			Host:          "d111111abcdef8.example.com",
+			UriStem:       fmt.Sprintf("/page/%d", i),
+			EdgeRequestID: fmt.Sprintf("req-%d", i),
+			TimeTaken:     0.125 * float64(i),
+			UserAgent:     "it's, \"quoted\"",
+			ContentLength: int64(i),
+			Year:          "2023",
+			Month:         "11",
+			Day:           "14",
+		}
+	}
+	return rows
+}
+
+func query(t *testing.T, s *Server, q *fetch.Query) ([]fetch.Entry, error) {
+	t.Helper()
+	db, err := fetch.New(fetch.SetDSN(s.DSN()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Rows(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var got []fetch.Entry
+	for rows.Next() {
+		var entry fetch.Entry
+		if err := rows.StructScan(&entry); err != nil {
+			return nil, err
+		}
+		got = append(got, entry)
+	}
+	return got, rows.Err()
+}
+
+var window = &fetch.Query{
+	From:     time.Unix(1700000000, 0),
+	To:       time.Unix(1700000000+5*60, 0),
+	Hostname: "example.com",
+}
+
+func TestPaging(t *testing.T) {
+	rows := entries(7)
+	s := NewServer(rows)
+	defer s.Close()
+	s.PageSize = 3
+
+	got, err := query(t, s, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("got %+v\nwant %+v", got, rows)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+
+	if _, err := query(t, s, window); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := s.Queries()
+	if len(queries) != 1 {
+		t.Fatalf("got %d queries, want 1", len(queries))
+	}
+	q := queries[0]
+	if !strings.HasPrefix(q.SQL, "SELECT ") || !strings.Contains(q.SQL, " FROM hive.cfrtl.rtl WHERE ") {
+		t.Errorf("unexpected statement %s", q.SQL)
+	}
+	want := []string{"1700000000.000", "1700000300.000", "'example.com'", "'%.example.com'"}
+	if !reflect.DeepEqual(q.Args, want) {
+		t.Errorf("args: got %v, want %v", q.Args, want)
+	}
+	if q.Arg(3) != "%.example.com" {
+		t.Errorf("Arg(3) = %q", q.Arg(3))
+	}
+}
+
+func TestRange(t *testing.T) {
+	rows := entries(10)
+	rows[2].Host = "evil-example.com"
+	s := NewServer(rows)
+	defer s.Close()
+	s.Select = Range
+
+	got, err := query(t, s, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fetch.Entry{rows[0], rows[1], rows[3], rows[4]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestSelectError(t *testing.T) {
+	s := NewServer(entries(3))
+	defer s.Close()
+	s.Select = func(q *Query, rows []fetch.Entry) ([]fetch.Entry, error) {
+		return nil, errors.New("worker lost")
+	}
+
+	if _, err := query(t, s, window); err == nil || !strings.Contains(err.Error(), "worker lost") {
+		t.Errorf("got error %v, want the query failure", err)
+	}
+}
+
+func TestMapping(t *testing.T) {
+	rows := entries(2)
+	rows[0].HeadersCount = 14
+	rows[0].OriginFBL = 0.031
+	rows[0].Extra = map[string]string{"forwarded_for": "198.51.100.7"}
+	s := NewServer(rows)
+	defer s.Close()
+
+	// The table has columns Entry lacks and is missing some Entry has
+	mapping, err := fetch.NewMapping("timestamp", "c-ip", "sc-status", "x-forwarded-for", "cs-headers-count", "origin-fbl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := *window
+	q.Mapping = mapping
+
+	got, err := query(t, s, &q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fetch.Entry{
+		{
+			Timestamp:    rows[0].Timestamp,
+			ClientIP:     rows[0].ClientIP,
+			Status:       rows[0].Status,
+			Year:         "2023",
+			Month:        "11",
+			Day:          "14",
+			HeadersCount: 14,
+			OriginFBL:    0.031,
+			Extra:        rows[0].Extra,
+		},
+		{
+			Timestamp: rows[1].Timestamp,
+			ClientIP:  rows[1].ClientIP,
+			Status:    rows[1].Status,
+			Year:      "2023",
+			Month:     "11",
+			Day:       "14",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	got, err := splitArgs(`1.5, 'a, b', 'it''s', 7`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1.5", "'a, b'", "'it''s'", "7"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := splitArgs(`'open`); err == nil {
+		t.Error("expected an error for an unterminated string")
+	}
+}
@@ -0,0 +1,318 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Type is the Trino type of a real-time log column
+type Type string
+
+const (
+	Varchar Type = "varchar"
+	Integer Type = "integer"
+	Bigint  Type = "bigint"
+	Double  Type = "double"
+)
+
+// Field describes a CloudFront real-time log field
+type Field struct {
+	// Name is the field name in the real-time log configuration, e.g. c-ip
+	Name string
+	// Column is the column holding the field in the Trino table, e.g. client_ip
+	Column string
+	Type   Type
+	// Description is a short summary of the field from the CloudFront documentation
+	Description string
+
+	// index is the position of the Entry field holding the column, or -1
+	// when the value is kept in Entry.Extra
+	index int
+}
+
+// Fields lists every CloudFront real-time log field, in the order CloudFront
+// writes the fields a configuration selects
+var Fields = []*Field{
+	{Name: "timestamp", Column: "timestamp", Type: Varchar, Description: "Time the edge server finished responding, in epoch seconds with milliseconds"},
+	{Name: "c-ip", Column: "client_ip", Type: Varchar, Description: "IP address of the viewer"},
+	{Name: "time-to-first-byte", Column: "time_to_first_byte", Type: Double, Description: "Seconds between receiving the request and writing the first byte of the response"},
+	{Name: "sc-status", Column: "status", Type: Integer, Description: "HTTP status code of the response"},
+	{Name: "sc-bytes", Column: "bytes", Type: Bigint, Description: "Bytes served to the viewer, including headers"},
+	{Name: "cs-method", Column: "method", Type: Varchar, Description: "HTTP request method"},
+	{Name: "cs-protocol", Column: "protocol", Type: Varchar, Description: "Protocol of the viewer request (http, https, ws, wss)"},
+	{Name: "cs-host", Column: "host", Type: Varchar, Description: "Domain name of the distribution"},
+	{Name: "cs-uri-stem", Column: "uri_stem", Type: Varchar, Description: "Request URL path, without the query string"},
+	{Name: "cs-bytes", Column: "request_bytes", Type: Bigint, Description: "Bytes of the viewer request, including headers"},
+	{Name: "x-edge-location", Column: "edge_location", Type: Varchar, Description: "Edge location that served the request"},
+	{Name: "x-edge-request-id", Column: "edge_request_id", Type: Varchar, Description: "Unique identifier of the request"},
+	{Name: "x-host-header", Column: "host_header", Type: Varchar, Description: "Value of the viewer's Host header"},
+	{Name: "time-taken", Column: "time_taken", Type: Double, Description: "Seconds between receiving the request and writing the last byte of the response"},
+	{Name: "cs-protocol-version", Column: "proto_version", Type: Varchar, Description: "HTTP version of the viewer request"},
+	{Name: "c-ip-version", Column: "ip_version", Type: Varchar, Description: "IP version of the viewer (IPv4 or IPv6)"},
+	{Name: "cs-user-agent", Column: "user_agent", Type: Varchar, Description: "Value of the User-Agent header"},
+	{Name: "cs-referer", Column: "referer", Type: Varchar, Description: "Value of the Referer header"},
+	{Name: "cs-cookie", Column: "cookie", Type: Varchar, Description: "Value of the Cookie header"},
+	{Name: "cs-uri-query", Column: "uri_query", Type: Varchar, Description: "Query string of the request URL"},
+	{Name: "x-edge-response-result-type", Column: "edge_response_result_type", Type: Varchar, Description: "How the server classified the response just before returning it"},
+	{Name: "x-forwarded-for", Column: "forwarded_for", Type: Varchar, Description: "Value of the X-Forwarded-For header when the viewer used a proxy"},
+	{Name: "ssl-protocol", Column: "ssl_protocol", Type: Varchar, Description: "TLS protocol negotiated with the viewer"},
+	{Name: "ssl-cipher", Column: "ssl_cipher", Type: Varchar, Description: "TLS cipher negotiated with the viewer"},
+	{Name: "x-edge-result-type", Column: "edge_result_type", Type: Varchar, Description: "How the server classified the response after the last byte left"},
+	{Name: "fle-encrypted-fields", Column: "fle_encrypted_fields", Type: Varchar, Description: "Number of field-level encryption fields forwarded to the origin"},
+	{Name: "fle-status", Column: "fle_status", Type: Varchar, Description: "Whether field-level encryption processed the request body"},
+	{Name: "sc-content-type", Column: "content_type", Type: Varchar, Description: "Value of the response Content-Type header"},
+	{Name: "sc-content-len", Column: "content_length", Type: Bigint, Description: "Value of the response Content-Length header"},
+	{Name: "sc-range-start", Column: "range_start", Type: Bigint, Description: "First byte served for a range request"},
+	{Name: "sc-range-end", Column: "range_end", Type: Bigint, Description: "Last byte served for a range request"},
+	{Name: "c-port", Column: "client_port", Type: Integer, Description: "Port number of the viewer request"},
+	{Name: "x-edge-detailed-result-type", Column: "edge_detailed_result_type", Type: Varchar, Description: "Result type with more detail for errors and origin shield"},
+	{Name: "c-country", Column: "country", Type: Varchar, Description: "Country of the viewer, as determined by CloudFront"},
+	{Name: "cs-accept-encoding", Column: "accept_encoding", Type: Varchar, Description: "Value of the Accept-Encoding header"},
+	{Name: "cs-accept", Column: "accept", Type: Varchar, Description: "Value of the Accept header"},
+	{Name: "cache-behavior-path-pattern", Column: "cache_behavior_path_pattern", Type: Varchar, Description: "Path pattern of the cache behavior that matched the request"},
+	{Name: "cs-headers", Column: "headers", Type: Varchar, Description: "Request headers, names and values"},
+	{Name: "cs-header-names", Column: "header_names", Type: Varchar, Description: "Request header names"},
+	{Name: "cs-headers-count", Column: "headers_count", Type: Integer, Description: "Number of request headers"},
+	{Name: "primary-distribution-id", Column: "primary_distribution_id", Type: Varchar, Description: "ID of the primary distribution in a continuous deployment"},
+	{Name: "primary-distribution-dns-name", Column: "primary_distribution_dns_name", Type: Varchar, Description: "Domain name of the primary distribution in a continuous deployment"},
+	{Name: "origin-fbl", Column: "origin_fbl", Type: Double, Description: "Seconds of first-byte latency between CloudFront and the origin"},
+	{Name: "origin-lbl", Column: "origin_lbl", Type: Double, Description: "Seconds of last-byte latency between CloudFront and the origin"},
+	{Name: "asn", Column: "asn", Type: Bigint, Description: "Autonomous system number of the viewer"},
+	{Name: "sr-reason", Column: "sr_reason", Type: Varchar, Description: "Reason CloudFront served an error or redirect of its own, such as a failed origin request"},
+}
+
+// PartitionColumns are the table's partition columns. They are not log fields;
+// Firehose writes them into the S3 prefix.
+var PartitionColumns = []string{"year", "month", "day"}
+
+// DefaultFields are the fields of the configuration the table was created
+// with, which fetch.Entry was modelled on
+var DefaultFields = []string{
+	"timestamp", "c-ip", "sc-status", "sc-bytes", "cs-method", "cs-protocol",
+	"cs-host", "cs-uri-stem", "x-edge-location", "x-edge-request-id",
+	"x-host-header", "time-taken", "cs-protocol-version", "c-ip-version",
+	"cs-user-agent", "cs-referer", "cs-cookie", "cs-uri-query",
+	"x-edge-response-result-type", "ssl-protocol", "ssl-cipher",
+	"x-edge-result-type", "sc-content-type", "sc-content-len",
+	"x-edge-detailed-result-type", "c-country", "cache-behavior-path-pattern",
+}
+
+// fieldsByName indexes Fields by both field name and column
+var fieldsByName = func() map[string]*Field {
+	index := entryIndex()
+	byName := map[string]*Field{}
+	for _, f := range Fields {
+		f.index = -1
+		if i, ok := index[f.Column]; ok {
+			f.index = i
+		}
+		byName[f.Name] = f
+		byName[f.Column] = f
+	}
+	return byName
+}()
+
+// partitions holds the partition columns, which are not registry fields
+var partitions = func() map[string]*Field {
+	index := entryIndex()
+	byColumn := map[string]*Field{}
+	for _, column := range PartitionColumns {
+		byColumn[column] = &Field{Name: column, Column: column, Type: Varchar, index: index[column]}
+	}
+	return byColumn
+}()
+
+// entryIndex returns the position of each Entry field by column
+func entryIndex() map[string]int {
+	index := map[string]int{}
+	t := reflect.TypeOf(Entry{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("db"); tag != "" && tag != "-" {
+			index[tag] = i
+		}
+	}
+	return index
+}
+
+// LookupField returns the field with the given CloudFront name or table column
+func LookupField(name string) (*Field, bool) {
+	f, ok := fieldsByName[name]
+	return f, ok
+}
+
+// column returns the field or partition stored in a table column
+func column(name string) (*Field, bool) {
+	if f, ok := partitions[name]; ok {
+		return f, true
+	}
+	f, ok := fieldsByName[name]
+	if !ok || f.Column != name {
+		return nil, false
+	}
+	return f, true
+}
+
+// set stores a value in entry. Trino values arrive typed; log file values
+// arrive as text. nil leaves the zero value.
+func (f *Field) set(entry *Entry, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	if f.index < 0 {
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(v)
+		}
+		if entry.Extra == nil {
+			entry.Extra = make(map[string]string)
+		}
+		entry.Extra[f.Column] = s
+		return nil
+	}
+
+	field := reflect.ValueOf(entry).Elem().Field(f.index)
+	switch field.Kind() {
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			field.SetString(v)
+		case []byte:
+			field.SetString(string(v))
+		default:
+			field.SetString(fmt.Sprint(v))
+		}
+
+	case reflect.Int, reflect.Int64:
+		switch v := value.(type) {
+		case int64:
+			field.SetInt(v)
+		case int32:
+			field.SetInt(int64(v))
+		case int:
+			field.SetInt(int64(v))
+		case float64:
+			field.SetInt(int64(v))
+		default:
+			n, err := strconv.ParseInt(text(v), 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			field.SetInt(n)
+		}
+
+	case reflect.Float64:
+		switch v := value.(type) {
+		case float64:
+			field.SetFloat(v)
+		case int64:
+			field.SetFloat(float64(v))
+		case int32:
+			field.SetFloat(float64(v))
+		default:
+			n, err := strconv.ParseFloat(text(v), 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			field.SetFloat(n)
+		}
+	}
+	return nil
+}
+
+// text returns the textual form of a value that is not already a Go number
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Mapping lists the fields a real-time log configuration emits, in order.
+// It decides the columns queried from Trino and the layout of log file lines.
+type Mapping struct {
+	Fields []*Field
+}
+
+// NewMapping returns the mapping for the named fields, given as CloudFront
+// field names or table columns. Without names it returns DefaultFields.
+func NewMapping(names ...string) (*Mapping, error) {
+	if len(names) == 0 {
+		names = DefaultFields
+	}
+
+	m := &Mapping{}
+	seen := map[*Field]bool{}
+	for _, name := range names {
+		f, ok := LookupField(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown real-time log field %q", name)
+		}
+		if seen[f] {
+			return nil, fmt.Errorf("duplicate real-time log field %q", name)
+		}
+		seen[f] = true
+		m.Fields = append(m.Fields, f)
+	}
+
+	// Queries and filters select on the timestamp
+	if !seen[fieldsByName["timestamp"]] {
+		return nil, fmt.Errorf("the timestamp field is required")
+	}
+
+	return m, nil
+}
+
+// DefaultMapping is the mapping of DefaultFields
+var DefaultMapping = func() *Mapping {
+	m, err := NewMapping()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}()
+
+// Columns returns the quoted column list selecting the mapped fields and the partitions
+func (m *Mapping) Columns() string {
+	columns := make([]string, 0, len(m.Fields)+len(PartitionColumns))
+	for _, f := range m.Fields {
+		columns = append(columns, `"`+f.Column+`"`)
+	}
+	for _, c := range PartitionColumns {
+		columns = append(columns, `"`+c+`"`)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// Parse fills entry from the values of a log file line, in mapping order.
+// CloudFront writes - for empty values.
+func (m *Mapping) Parse(entry *Entry, values []string) error {
+	if len(values) != len(m.Fields) {
+		return fmt.Errorf("got %d fields, want %d", len(values), len(m.Fields))
+	}
+	for i, value := range values {
+		if value == "-" {
+			continue
+		}
+		if err := m.Fields[i].set(entry, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package fetch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	seen := map[string]bool{}
+	for _, f := range Fields {
+		if seen[f.Name] || seen[f.Column] {
+			t.Errorf("%s: name or column %s registered twice", f.Name, f.Column)
+		}
+		seen[f.Name], seen[f.Column] = true, true
+	}
+
+	// The registry covers every field CloudFront can log, in its order
+	var names []string
+	for _, f := range Fields {
+		names = append(names, f.Name)
+	}
+	want := []string{
+		"timestamp", "c-ip", "time-to-first-byte", "sc-status", "sc-bytes",
+		"cs-method", "cs-protocol", "cs-host", "cs-uri-stem", "cs-bytes",
+		"x-edge-location", "x-edge-request-id", "x-host-header", "time-taken",
+		"cs-protocol-version", "c-ip-version", "cs-user-agent", "cs-referer",
+		"cs-cookie", "cs-uri-query", "x-edge-response-result-type",
+		"x-forwarded-for", "ssl-protocol", "ssl-cipher", "x-edge-result-type",
+		"fle-encrypted-fields", "fle-status", "sc-content-type", "sc-content-len",
+		"sc-range-start", "sc-range-end", "c-port", "x-edge-detailed-result-type",
+		"c-country", "cs-accept-encoding", "cs-accept", "cache-behavior-path-pattern",
+		"cs-headers", "cs-header-names", "cs-headers-count",
+		"primary-distribution-id", "primary-distribution-dns-name",
+		"origin-fbl", "origin-lbl", "asn", "sr-reason",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got fields %v\nwant %v", names, want)
+	}
+	if f, ok := LookupField("sr-reason"); !ok || f.Column != "sr_reason" {
+		t.Errorf("LookupField(sr-reason) = %+v, %v", f, ok)
+	}
+
+	// Every Entry column is a registry field or a partition
+	for name := range entryIndex() {
+		if _, ok := column(name); !ok {
+			t.Errorf("Entry column %s is not registered", name)
+		}
+	}
+}
+
+func TestNewMapping(t *testing.T) {
+	m, err := NewMapping("timestamp", "client_ip", "cs-headers-count", "origin-fbl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Columns(), `"timestamp", "client_ip", "headers_count", "origin_fbl", "year", "month", "day"`; got != want {
+		t.Errorf("Columns() = %s, want %s", got, want)
+	}
+
+	for name, fields := range map[string][]string{
+		"unknown":      {"timestamp", "c-ipp"},
+		"duplicate":    {"timestamp", "c-ip", "client_ip"},
+		"no timestamp": {"c-ip"},
+	} {
+		if _, err := NewMapping(fields...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if len(DefaultMapping.Fields) != len(DefaultFields) {
+		t.Errorf("default mapping has %d fields, want %d", len(DefaultMapping.Fields), len(DefaultFields))
+	}
+}
+
+func TestParse(t *testing.T) {
+	m, err := NewMapping("timestamp", "sc-status", "sc-bytes", "time-taken", "cs-headers-count", "x-forwarded-for", "cs-cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry Entry
+	if err := m.Parse(&entry, []string{"1700000000.123", "206", "1024", "0.25", "12", "198.51.100.7", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	want := Entry{
+		Timestamp:    "1700000000.123",
+		Status:       206,
+		Bytes:        1024,
+		TimeTaken:    0.25,
+		HeadersCount: 12,
+		Extra:        map[string]string{"forwarded_for": "198.51.100.7"},
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("got %+v, want %+v", entry, want)
+	}
+
+	if err := m.Parse(&entry, []string{"1700000000.123", "200"}); err == nil {
+		t.Error("expected an error for a short line")
+	}
+	if err := m.Parse(&entry, []string{"1700000000.123", "OK", "1", "1", "1", "-", "-"}); err == nil {
+		t.Error("expected an error for a malformed status")
+	}
+}
@@ -0,0 +1,205 @@
+package fetch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trinodb/trino-go-client/trino"
+)
+
+// DefaultTable is the Trino table holding the CloudFront real-time logs
+const DefaultTable = "hive.cfrtl.rtl"
+
+// Query describes a parameterized query against the real-time log table
+type Query struct {
+	Table         string
+	From          time.Time
+	To            time.Time
+	Hostname      string
+	Status        []int
+	Methods       []string
+	EdgeLocations []string
+	Limit         int
+
+	// Mapping selects the columns to fetch; nil selects DefaultMapping
+	Mapping *Mapping
+}
+
+// Build returns the SQL statement and its bound arguments.
+// The time range is expanded into year/month/day partition predicates so
+// Trino only scans the partitions that can hold matching rows.
+// Hostname selects that host and its subdomains.
+func (q *Query) Build() (string, []interface{}, error) {
+	if q.From.IsZero() || q.To.IsZero() {
+		return "", nil, fmt.Errorf("from and to are required")
+	}
+	if !q.To.After(q.From) {
+		return "", nil, fmt.Errorf("to (%s) must be after from (%s)", q.To, q.From)
+	}
+
+	table := q.Table
+	if table == "" {
+		table = DefaultTable
+	}
+
+	var where []string
+	var args []interface{}
+
+	where = append(where, "("+strings.Join(Partitions(q.From, q.To), " OR ")+")")
+
+	// The timestamp column is epoch seconds with a millisecond fraction
+	where = append(where, `CAST("timestamp" AS double) >= ?`, `CAST("timestamp" AS double) < ?`)
+	args = append(args, epoch(q.From), epoch(q.To))
+
+	if q.Hostname != "" {
+		where = append(where, `(host = ? OR host LIKE ? ESCAPE '\')`)
+		args = append(args, q.Hostname, "%."+likeEscaper.Replace(q.Hostname))
+	}
+
+	if len(q.Status) > 0 {
+		where = append(where, "status IN ("+placeholders(len(q.Status))+")")
+		for _, s := range q.Status {
+			args = append(args, s)
+		}
+	}
+
+	if len(q.Methods) > 0 {
+		where = append(where, "method IN ("+placeholders(len(q.Methods))+")")
+		for _, m := range q.Methods {
+			args = append(args, strings.ToUpper(m))
+		}
+	}
+
+	if len(q.EdgeLocations) > 0 {
+		where = append(where, "edge_location IN ("+placeholders(len(q.EdgeLocations))+")")
+		for _, e := range q.EdgeLocations {
+			args = append(args, e)
+		}
+	}
+
+	mapping := q.Mapping
+	if mapping == nil {
+		mapping = DefaultMapping
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", mapping.Columns(), table, strings.Join(where, " AND "))
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	return query, args, nil
+}
+
+// likeEscaper escapes the LIKE metacharacters for an ESCAPE '\' clause
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// MatchHost reports whether host is hostname or one of its subdomains.
+// An empty hostname matches every host.
+func MatchHost(host, hostname string) bool {
+	return hostname == "" || host == hostname || strings.HasSuffix(host, "."+hostname)
+}
+
+// Match reports whether entry satisfies the query's predicates. It applies
+// the same conditions as Build for sources that are not read through Trino;
+// the row limit is left to the caller.
+func (q *Query) Match(entry *Entry) (bool, error) {
+	ms, err := Millis(entry.Timestamp)
+	if err != nil {
+		return false, err
+	}
+	if ms < q.From.UnixMilli() || ms >= q.To.UnixMilli() {
+		return false, nil
+	}
+
+	if !MatchHost(entry.Host, q.Hostname) {
+		return false, nil
+	}
+
+	if len(q.Status) > 0 && !contains(q.Status, entry.Status) {
+		return false, nil
+	}
+
+	if len(q.Methods) > 0 {
+		found := false
+		for _, m := range q.Methods {
+			if strings.EqualFold(m, entry.Method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	if len(q.EdgeLocations) > 0 && !contains(q.EdgeLocations, entry.EdgeLocation) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Millis parses a timestamp column value, epoch seconds with a millisecond
+// fraction, into epoch milliseconds
+func Millis(timestamp string) (int64, error) {
+	sec, frac, _ := strings.Cut(timestamp, ".")
+	if len(frac) > 3 {
+		frac = frac[:3]
+	}
+	ms, err := strconv.ParseInt(sec+frac+strings.Repeat("0", 3-len(frac)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	return ms, nil
+}
+
+func contains[T comparable](values []T, v T) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Partitions returns the partition predicates covering [from, to).
+// Whole months collapse to a year/month predicate; partial months list their days.
+func Partitions(from, to time.Time) []string {
+	from = from.UTC()
+	to = to.UTC()
+
+	var preds []string
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	for day.Before(to) {
+		monthStart := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		nextMonth := monthStart.AddDate(0, 1, 0)
+
+		// Whole month inside the range
+		if day.Equal(monthStart) && !nextMonth.After(to) {
+			preds = append(preds, fmt.Sprintf("(year='%d' AND month='%d')", day.Year(), int(day.Month())))
+			day = nextMonth
+			continue
+		}
+
+		var days []string
+		for day.Before(to) && day.Before(nextMonth) {
+			days = append(days, "'"+strconv.Itoa(day.Day())+"'")
+			day = day.AddDate(0, 0, 1)
+		}
+		preds = append(preds, fmt.Sprintf("(year='%d' AND month='%d' AND day IN (%s))",
+			monthStart.Year(), int(monthStart.Month()), strings.Join(days, ",")))
+	}
+
+	return preds
+}
+
+// epoch formats t the way the timestamp column stores it
+func epoch(t time.Time) trino.Numeric {
+	return trino.Numeric(fmt.Sprintf("%d.%03d", t.Unix(), t.Nanosecond()/int(time.Millisecond)))
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
@@ -0,0 +1,148 @@
+package fetch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trinodb/trino-go-client/trino"
+)
+
+func TestBuild(t *testing.T) {
+	q := &Query{
+		From:          time.Date(2023, 11, 30, 12, 0, 0, 0, time.UTC),
+		To:            time.Date(2023, 12, 1, 6, 30, 0, 250*int(time.Millisecond), time.UTC),
+		Hostname:      "example.com",
+		Status:        []int{200, 404},
+		Methods:       []string{"get"},
+		EdgeLocations: []string{"IAD89-C1"},
+		Limit:         10,
+	}
+
+	sql, args, err := q.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `SELECT ` + DefaultMapping.Columns() + ` FROM hive.cfrtl.rtl WHERE ((year='2023' AND month='11' AND day IN ('30')) OR (year='2023' AND month='12' AND day IN ('1'))) AND CAST("timestamp" AS double) >= ? AND CAST("timestamp" AS double) < ? AND (host = ? OR host LIKE ? ESCAPE '\') AND status IN (?,?) AND method IN (?) AND edge_location IN (?) LIMIT 10`
+	if sql != want {
+		t.Errorf("sql:\n got %s\nwant %s", sql, want)
+	}
+
+	wantArgs := []interface{}{
+		trino.Numeric("1701345600.000"),
+		trino.Numeric("1701412200.250"),
+		"example.com", "%.example.com",
+		200, 404,
+		"GET",
+		"IAD89-C1",
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args: got %v, want %v", args, wantArgs)
+	}
+}
+
+func TestBuildHostname(t *testing.T) {
+	q := &Query{
+		From:     time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		Hostname: `my_site%.example.com`,
+	}
+	_, args, err := q.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args[3]; got != `%.my\_site\%.example.com` {
+		t.Errorf("got pattern %v, want the metacharacters escaped", got)
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	for _, tc := range []struct {
+		host, hostname string
+		want           bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", true},
+		{"evil-example.com", "example.com", false},
+		{"exampleXcom", "example.com", false},
+		{"example.com.evil.net", "example.com", false},
+		{"anything.test", "", true},
+	} {
+		if got := MatchHost(tc.host, tc.hostname); got != tc.want {
+			t.Errorf("MatchHost(%q, %q) = %v, want %v", tc.host, tc.hostname, got, tc.want)
+		}
+	}
+}
+
+func TestBuildTable(t *testing.T) {
+	q := &Query{
+		Table: "other.logs",
+		From:  time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	sql, args, err := q.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql, " FROM other.logs WHERE ") || strings.Contains(sql, "LIMIT") {
+		t.Errorf("unexpected sql %s", sql)
+	}
+	if len(args) != 2 {
+		t.Errorf("got %d args, want the time range only", len(args))
+	}
+}
+
+func TestBuildRange(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, q := range map[string]*Query{
+		"no from":  {To: now},
+		"no to":    {From: now},
+		"empty":    {From: now, To: now},
+		"reversed": {From: now, To: now.Add(-time.Hour)},
+	} {
+		if _, _, err := q.Build(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPartitions(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		want     []string
+	}{
+		{
+			from: "2023-03-05T10:00:00Z",
+			to:   "2023-03-05T11:00:00Z",
+			want: []string{"(year='2023' AND month='3' AND day IN ('5'))"},
+		},
+		{
+			// the end is exclusive, so midnight does not pull in the next day
+			from: "2023-03-05T00:00:00Z",
+			to:   "2023-03-07T00:00:00Z",
+			want: []string{"(year='2023' AND month='3' AND day IN ('5','6'))"},
+		},
+		{
+			from: "2023-01-30T00:00:00Z",
+			to:   "2023-03-02T12:00:00Z",
+			want: []string{
+				"(year='2023' AND month='1' AND day IN ('30','31'))",
+				"(year='2023' AND month='2')",
+				"(year='2023' AND month='3' AND day IN ('1','2'))",
+			},
+		},
+		{
+			from: "2022-12-01T00:00:00Z",
+			to:   "2023-01-01T00:00:00Z",
+			want: []string{"(year='2022' AND month='12')"},
+		},
+	} {
+		from, _ := time.Parse(time.RFC3339, tc.from)
+		to, _ := time.Parse(time.RFC3339, tc.to)
+		if got := Partitions(from, to); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Partitions(%s, %s):\n got %v\nwant %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
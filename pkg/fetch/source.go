@@ -0,0 +1,78 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Rows iterates over the entries answering a query. StructScan fills an *Entry.
+type Rows interface {
+	Next() bool
+	StructScan(dest interface{}) error
+	Err() error
+	Close() error
+}
+
+// Source is somewhere raw log entries can be read from: Trino through Config,
+// or CloudFront real-time log files through rtlfile.Config
+type Source interface {
+	Rows(ctx context.Context, query *Query) (Rows, error)
+	Close() error
+}
+
+// Rows runs query against Trino and returns the result rows
+func (c *Config) Rows(ctx context.Context, query *Query) (Rows, error) {
+	sql, args, err := query.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.DB.QueryxContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{Rows: result}, nil
+}
+
+// rows scans Trino result rows into entries by column name, so the query
+// may select columns that Entry has no field for
+type rows struct {
+	*sqlx.Rows
+	fields []*Field
+}
+
+// StructScan fills dest, which must be an *Entry, from the current row
+func (r *rows) StructScan(dest interface{}) error {
+	entry, ok := dest.(*Entry)
+	if !ok {
+		return fmt.Errorf("cannot scan into %T", dest)
+	}
+
+	if r.fields == nil {
+		columns, err := r.Columns()
+		if err != nil {
+			return err
+		}
+		fields := make([]*Field, len(columns))
+		for i, name := range columns {
+			if fields[i], ok = column(name); !ok {
+				return fmt.Errorf("unknown column %q", name)
+			}
+		}
+		r.fields = fields
+	}
+
+	values, err := r.SliceScan()
+	if err != nil {
+		return err
+	}
+	*entry = Entry{}
+	for i, v := range values {
+		if err := r.fields[i].set(entry, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package geoip
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"strings"
 
@@ -14,11 +13,15 @@ type Option func(c *Config)
 
 // database configs
 type Config struct {
-	geodb string
-	db    *maxminddb.Reader
-}
+	geodbs []string
 
-var ()
+	// one reader per kind of database, nil when not configured
+	city       *maxminddb.Reader
+	asn        *maxminddb.Reader
+	isp        *maxminddb.Reader
+	anonymous  *maxminddb.Reader
+	connection *maxminddb.Reader
+}
 
 // Record defines the fields to fetch from the GeoIP database.
 type Record struct {
@@ -51,7 +54,37 @@ type Record struct {
 	} `maxminddb:"subdivisions"`
 }
 
+// ASNRecord defines the fields to fetch from a GeoLite2-ASN database.
+type ASNRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// ISPRecord defines the fields to fetch from a GeoIP2-ISP database.
+type ISPRecord struct {
+	ASNNumber       uint   `maxminddb:"autonomous_system_number"`
+	ASNOrganization string `maxminddb:"autonomous_system_organization"`
+	ISP             string `maxminddb:"isp"`
+	Organization    string `maxminddb:"organization"`
+}
+
+// AnonymousIPRecord defines the fields to fetch from a GeoIP2-Anonymous-IP database.
+type AnonymousIPRecord struct {
+	IsAnonymous        bool `maxminddb:"is_anonymous"`
+	IsAnonymousVPN     bool `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider  bool `maxminddb:"is_hosting_provider"`
+	IsPublicProxy      bool `maxminddb:"is_public_proxy"`
+	IsResidentialProxy bool `maxminddb:"is_residential_proxy"`
+	IsTorExitNode      bool `maxminddb:"is_tor_exit_node"`
+}
+
+// ConnectionTypeRecord defines the fields to fetch from a GeoIP2-Connection-Type database.
+type ConnectionTypeRecord struct {
+	ConnectionType string `maxminddb:"connection_type"`
+}
+
 // GeoIPData represents the data returned.
+// The network fields are only set when their databases are configured.
 type GeoIPData struct {
 	IP          net.IP  `json:"ip"`
 	City        string  `json:"city_name"`
@@ -63,6 +96,14 @@ type GeoIPData struct {
 	TimeZone    string  `json:"time_zone"`
 	PostalCode  string  `json:"postal_code"`
 	Subdivision string  `json:"subdivision_code"`
+
+	ASN               uint   `json:"asn,omitempty"`
+	ASNOrg            string `json:"asn_org,omitempty"`
+	ISP               string `json:"isp,omitempty"`
+	IsHostingProvider bool   `json:"is_hosting_provider,omitempty"`
+	IsTorExit         bool   `json:"is_tor_exit,omitempty"`
+	IsVPN             bool   `json:"is_vpn,omitempty"`
+	ConnectionType    string `json:"connection_type,omitempty"`
 }
 
 // New returns a new Config with the given options
@@ -74,56 +115,142 @@ func New(opts ...func(*Config)) (*Config, error) {
 		opt(config)
 	}
 
-	// dns must be set
-	if config.geodb == "" {
+	// at least one database must be set
+	if len(config.geodbs) == 0 {
 		return nil, fmt.Errorf("geodb is required")
 	}
 
-	db, err := maxminddb.Open(config.geodb)
-	if err != nil {
-		log.Fatal(err)
+	for _, geodb := range config.geodbs {
+		if err := config.open(geodb); err != nil {
+			config.Close()
+			return nil, err
+		}
 	}
-	config.db = db
 
 	return config, nil
 }
 
-// SetGeoDB sets the database location
-func SetGeoDB(geodb string) Option {
+// SetGeoDB sets the database locations. Each database's type is read from
+// its metadata: a City or Country database for the location, plus optional
+// ASN, ISP, Anonymous-IP and Connection-Type databases.
+func SetGeoDB(geodbs ...string) Option {
 	return func(c *Config) {
-		c.geodb = geodb
+		c.geodbs = geodbs
+	}
+}
+
+// open opens a database and keeps it by the kind of data it holds
+func (c *Config) open(geodb string) error {
+	db, err := maxminddb.Open(geodb)
+	if err != nil {
+		return err
+	}
+
+	var slot **maxminddb.Reader
+	dbType := db.Metadata.DatabaseType
+	switch {
+	case strings.HasSuffix(dbType, "-ASN"):
+		slot = &c.asn
+	case strings.HasSuffix(dbType, "-ISP"):
+		slot = &c.isp
+	case strings.HasSuffix(dbType, "-Anonymous-IP"):
+		slot = &c.anonymous
+	case strings.HasSuffix(dbType, "-Connection-Type"):
+		slot = &c.connection
+	case strings.Contains(dbType, "City"), strings.Contains(dbType, "Country"), strings.Contains(dbType, "Enterprise"):
+		slot = &c.city
+	default:
+		db.Close()
+		return fmt.Errorf("%s: unsupported database type %q", geodb, dbType)
+	}
+
+	if *slot != nil {
+		db.Close()
+		return fmt.Errorf("%s: more than one %s database", geodb, dbType)
 	}
+	*slot = db
+	return nil
 }
 
-// Close closes the database connection
+// Close closes the database connections
 func (c *Config) Close() error {
-	return c.db.Close()
+	var firstErr error
+	for _, db := range []*maxminddb.Reader{c.city, c.asn, c.isp, c.anonymous, c.connection} {
+		if db == nil {
+			continue
+		}
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
-// Lookip GeoIP data for the given IP address.
+// Lookip GeoIP data for the given IP address, merged across the databases.
 func (c *Config) Lookup(ip net.IP) (*GeoIPData, error) {
-	var data Record = Record{}
+	geo := &GeoIPData{IP: ip}
 
-	err := c.db.Lookup(ip, &data)
-	if err != nil {
-		return nil, err
+	if c.city != nil {
+		var data Record = Record{}
+		if err := c.city.Lookup(ip, &data); err != nil {
+			return nil, err
+		}
+
+		subdivs := []string{}
+		for _, s := range data.Subdivisions {
+			subdivs = append(subdivs, s.IsoCode)
+		}
+
+		geo.City = data.City.Names["en"]
+		geo.Continent = data.Continent.Code
+		geo.Country = data.Country.IsoCode
+		geo.Latitude = data.Location.Latitude
+		geo.Longitude = data.Location.Longitude
+		geo.MetroCode = data.Location.MetroCode
+		geo.TimeZone = data.Location.TimeZone
+		geo.PostalCode = data.Postal.Code
+		geo.Subdivision = strings.Join(subdivs, ";")
+	}
+
+	// The ISP database carries the AS as well; the ASN database wins when both are set
+	if c.isp != nil {
+		var data ISPRecord
+		if err := c.isp.Lookup(ip, &data); err != nil {
+			return nil, err
+		}
+		geo.ASN = data.ASNNumber
+		geo.ASNOrg = data.ASNOrganization
+		geo.ISP = data.ISP
+	}
+
+	if c.asn != nil {
+		var data ASNRecord
+		if err := c.asn.Lookup(ip, &data); err != nil {
+			return nil, err
+		}
+		if data.Number != 0 {
+			geo.ASN = data.Number
+			geo.ASNOrg = data.Organization
+		}
+	}
+
+	if c.anonymous != nil {
+		var data AnonymousIPRecord
+		if err := c.anonymous.Lookup(ip, &data); err != nil {
+			return nil, err
+		}
+		geo.IsHostingProvider = data.IsHostingProvider
+		geo.IsTorExit = data.IsTorExitNode
+		geo.IsVPN = data.IsAnonymousVPN
 	}
 
-	subdivs := []string{}
-	for _, s := range data.Subdivisions {
-		subdivs = append(subdivs, s.IsoCode)
+	if c.connection != nil {
+		var data ConnectionTypeRecord
+		if err := c.connection.Lookup(ip, &data); err != nil {
+			return nil, err
+		}
+		geo.ConnectionType = data.ConnectionType
 	}
 
-	return &GeoIPData{
-		IP:          ip,
-		City:        data.City.Names["en"],
-		Continent:   data.Continent.Code,
-		Country:     data.Country.IsoCode,
-		Latitude:    data.Location.Latitude,
-		Longitude:   data.Location.Longitude,
-		MetroCode:   data.Location.MetroCode,
-		TimeZone:    data.Location.TimeZone,
-		PostalCode:  data.Postal.Code,
-		Subdivision: strings.Join(subdivs, ";"),
-	}, nil
+	return geo, nil
 }
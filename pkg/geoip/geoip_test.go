@@ -0,0 +1,185 @@
+package geoip_test
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip/geoiptest"
+)
+
+func TestLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	err := geoiptest.Write(path,
+		geoiptest.City{
+			Network:      "192.0.2.0/24",
+			City:         "Ashburn",
+			Continent:    "NA",
+			Country:      "US",
+			Latitude:     39.0469,
+			Longitude:    -77.4903,
+			MetroCode:    511,
+			TimeZone:     "America/New_York",
+			PostalCode:   "20149",
+			Subdivisions: []string{"VA"},
+		},
+		geoiptest.City{
+			Network:   "2001:db8::/32",
+			Continent: "EU",
+			Country:   "DE",
+			TimeZone:  "Europe/Berlin",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	geo, err := geoip.New(geoip.SetGeoDB(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer geo.Close()
+
+	for _, want := range []geoip.GeoIPData{
+		{
+			IP:          net.ParseIP("192.0.2.44"),
+			City:        "Ashburn",
+			Continent:   "NA",
+			Country:     "US",
+			Latitude:    39.0469,
+			Longitude:   -77.4903,
+			MetroCode:   511,
+			TimeZone:    "America/New_York",
+			PostalCode:  "20149",
+			Subdivision: "VA",
+		},
+		{
+			IP:        net.ParseIP("2001:db8::1"),
+			Continent: "EU",
+			Country:   "DE",
+			TimeZone:  "Europe/Berlin",
+		},
+		{
+			// addresses outside every network come back empty
+			IP: net.ParseIP("198.51.100.1"),
+		},
+	} {
+		got, err := geo.Lookup(want.IP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("Lookup(%s):\n got %+v\nwant %+v", want.IP, *got, want)
+		}
+	}
+}
+
+func TestLookupNetworks(t *testing.T) {
+	dir := t.TempDir()
+	city := filepath.Join(dir, "city.mmdb")
+	asn := filepath.Join(dir, "asn.mmdb")
+	isp := filepath.Join(dir, "isp.mmdb")
+	anonymous := filepath.Join(dir, "anonymous.mmdb")
+	connection := filepath.Join(dir, "connection.mmdb")
+
+	for _, err := range []error{
+		geoiptest.Write(city, geoiptest.City{Network: "192.0.2.0/24", Country: "US"}),
+		geoiptest.WriteASN(asn,
+			geoiptest.ASN{Network: "192.0.2.0/25", Number: 64500, Organization: "Example Hosting"},
+		),
+		geoiptest.WriteISP(isp,
+			geoiptest.ISP{Network: "192.0.2.0/24", ASN: 64501, ASNOrganization: "Example Transit", ISP: "Example ISP", Organization: "Example Org"},
+		),
+		geoiptest.WriteAnonymousIP(anonymous,
+			geoiptest.AnonymousIP{Network: "192.0.2.0/26", IsAnonymous: true, IsHostingProvider: true},
+			geoiptest.AnonymousIP{Network: "192.0.2.64/26", IsAnonymous: true, IsAnonymousVPN: true},
+			geoiptest.AnonymousIP{Network: "192.0.2.128/26", IsAnonymous: true, IsTorExitNode: true},
+		),
+		geoiptest.WriteConnectionType(connection,
+			geoiptest.ConnectionType{Network: "192.0.2.0/24", ConnectionType: "Corporate"},
+		),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The type of each database comes from its metadata, not the order
+	geo, err := geoip.New(geoip.SetGeoDB(connection, asn, city, anonymous, isp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer geo.Close()
+
+	for _, want := range []geoip.GeoIPData{
+		{
+			IP:                net.ParseIP("192.0.2.10"),
+			Country:           "US",
+			ASN:               64500,
+			ASNOrg:            "Example Hosting",
+			ISP:               "Example ISP",
+			IsHostingProvider: true,
+			ConnectionType:    "Corporate",
+		},
+		{
+			IP:             net.ParseIP("192.0.2.70"),
+			Country:        "US",
+			ASN:            64500,
+			ASNOrg:         "Example Hosting",
+			ISP:            "Example ISP",
+			IsVPN:          true,
+			ConnectionType: "Corporate",
+		},
+		{
+			// outside the ASN database, the ISP database's AS is used
+			IP:             net.ParseIP("192.0.2.130"),
+			Country:        "US",
+			ASN:            64501,
+			ASNOrg:         "Example Transit",
+			ISP:            "Example ISP",
+			IsTorExit:      true,
+			ConnectionType: "Corporate",
+		},
+		{
+			IP: net.ParseIP("198.51.100.1"),
+		},
+	} {
+		got, err := geo.Lookup(want.IP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("Lookup(%s):\n got %+v\nwant %+v", want.IP, *got, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	asn := filepath.Join(dir, "asn.mmdb")
+	if err := geoiptest.WriteASN(asn, geoiptest.ASN{Network: "192.0.2.0/24", Number: 64500}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A location database is not required
+	geo, err := geoip.New(geoip.SetGeoDB(asn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := geo.Lookup(net.ParseIP("192.0.2.1")); err != nil || got.ASN != 64500 || got.Country != "" {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	geo.Close()
+
+	for name, paths := range map[string][]string{
+		"none":      nil,
+		"missing":   {filepath.Join(dir, "missing.mmdb")},
+		"duplicate": {asn, asn},
+	} {
+		if _, err := geoip.New(geoip.SetGeoDB(paths...)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
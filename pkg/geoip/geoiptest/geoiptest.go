@@ -0,0 +1,228 @@
+// Package geoiptest builds small GeoIP2 City, ASN, ISP, Anonymous-IP and
+// Connection-Type databases for tests.
+package geoiptest
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// City is the location recorded for a network
+type City struct {
+	Network      string // CIDR, e.g. 203.0.113.0/24
+	City         string
+	Continent    string
+	Country      string
+	Latitude     float64
+	Longitude    float64
+	MetroCode    uint16
+	TimeZone     string
+	PostalCode   string
+	Subdivisions []string
+}
+
+// ASN is the autonomous system recorded for a network
+type ASN struct {
+	Network      string
+	Number       uint32
+	Organization string
+}
+
+// ISP is the provider recorded for a network
+type ISP struct {
+	Network         string
+	ASN             uint32
+	ASNOrganization string
+	ISP             string
+	Organization    string
+}
+
+// AnonymousIP is the anonymizer classification recorded for a network
+type AnonymousIP struct {
+	Network           string
+	IsAnonymous       bool
+	IsAnonymousVPN    bool
+	IsHostingProvider bool
+	IsPublicProxy     bool
+	IsTorExitNode     bool
+}
+
+// ConnectionType is the connection type recorded for a network
+type ConnectionType struct {
+	Network        string
+	ConnectionType string // e.g. Cable/DSL, Cellular, Corporate
+}
+
+// fixture is a network and its database record
+type fixture interface {
+	network() string
+	record() mmdbtype.Map
+}
+
+// Write writes a City database holding cities to path.
+// Reserved and documentation networks are allowed, so fixtures can use
+// addresses such as 192.0.2.0/24 and 2001:db8::/32.
+func Write(path string, cities ...City) error {
+	fixtures := make([]fixture, len(cities))
+	for i := range cities {
+		fixtures[i] = &cities[i]
+	}
+	return write(path, "GeoIP2-City", fixtures)
+}
+
+// WriteASN writes a GeoLite2-ASN database holding asns to path
+func WriteASN(path string, asns ...ASN) error {
+	fixtures := make([]fixture, len(asns))
+	for i := range asns {
+		fixtures[i] = &asns[i]
+	}
+	return write(path, "GeoLite2-ASN", fixtures)
+}
+
+// WriteISP writes a GeoIP2-ISP database holding isps to path
+func WriteISP(path string, isps ...ISP) error {
+	fixtures := make([]fixture, len(isps))
+	for i := range isps {
+		fixtures[i] = &isps[i]
+	}
+	return write(path, "GeoIP2-ISP", fixtures)
+}
+
+// WriteAnonymousIP writes a GeoIP2-Anonymous-IP database holding ips to path
+func WriteAnonymousIP(path string, ips ...AnonymousIP) error {
+	fixtures := make([]fixture, len(ips))
+	for i := range ips {
+		fixtures[i] = &ips[i]
+	}
+	return write(path, "GeoIP2-Anonymous-IP", fixtures)
+}
+
+// WriteConnectionType writes a GeoIP2-Connection-Type database holding types to path
+func WriteConnectionType(path string, types ...ConnectionType) error {
+	fixtures := make([]fixture, len(types))
+	for i := range types {
+		fixtures[i] = &types[i]
+	}
+	return write(path, "GeoIP2-Connection-Type", fixtures)
+}
+
+// write writes a database of the given type holding fixtures to path
+func write(path, databaseType string, fixtures []fixture) error {
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            databaseType,
+		Description:             map[string]string{"en": "geoiptest fixture"},
+		Languages:               []string{"en"},
+		IncludeReservedNetworks: true,
+		RecordSize:              24,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fixtures {
+		_, network, err := net.ParseCIDR(f.network())
+		if err != nil {
+			return err
+		}
+		if err := tree.Insert(network, f.record()); err != nil {
+			return fmt.Errorf("%s: %w", f.network(), err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := tree.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *City) network() string { return c.Network }
+
+// record returns the City database record for c
+func (c *City) record() mmdbtype.Map {
+	subdivisions := mmdbtype.Slice{}
+	for _, s := range c.Subdivisions {
+		subdivisions = append(subdivisions, mmdbtype.Map{"iso_code": mmdbtype.String(s)})
+	}
+
+	return mmdbtype.Map{
+		"city": mmdbtype.Map{
+			"names": mmdbtype.Map{"en": mmdbtype.String(c.City)},
+		},
+		"continent": mmdbtype.Map{
+			"code": mmdbtype.String(c.Continent),
+		},
+		"country": mmdbtype.Map{
+			"iso_code": mmdbtype.String(c.Country),
+		},
+		"location": mmdbtype.Map{
+			"latitude":   mmdbtype.Float64(c.Latitude),
+			"longitude":  mmdbtype.Float64(c.Longitude),
+			"metro_code": mmdbtype.Uint16(c.MetroCode),
+			"time_zone":  mmdbtype.String(c.TimeZone),
+		},
+		"postal": mmdbtype.Map{
+			"code": mmdbtype.String(c.PostalCode),
+		},
+		"subdivisions": subdivisions,
+	}
+}
+
+func (a *ASN) network() string { return a.Network }
+
+// record returns the ASN database record for a
+func (a *ASN) record() mmdbtype.Map {
+	return mmdbtype.Map{
+		"autonomous_system_number":       mmdbtype.Uint32(a.Number),
+		"autonomous_system_organization": mmdbtype.String(a.Organization),
+	}
+}
+
+func (i *ISP) network() string { return i.Network }
+
+// record returns the ISP database record for i
+func (i *ISP) record() mmdbtype.Map {
+	return mmdbtype.Map{
+		"autonomous_system_number":       mmdbtype.Uint32(i.ASN),
+		"autonomous_system_organization": mmdbtype.String(i.ASNOrganization),
+		"isp":                            mmdbtype.String(i.ISP),
+		"organization":                   mmdbtype.String(i.Organization),
+	}
+}
+
+func (a *AnonymousIP) network() string { return a.Network }
+
+// record returns the Anonymous-IP database record for a.
+// Like MaxMind's databases, only the flags that are set are stored.
+func (a *AnonymousIP) record() mmdbtype.Map {
+	record := mmdbtype.Map{}
+	for key, set := range map[string]bool{
+		"is_anonymous":        a.IsAnonymous,
+		"is_anonymous_vpn":    a.IsAnonymousVPN,
+		"is_hosting_provider": a.IsHostingProvider,
+		"is_public_proxy":     a.IsPublicProxy,
+		"is_tor_exit_node":    a.IsTorExitNode,
+	} {
+		if set {
+			record[mmdbtype.String(key)] = mmdbtype.Bool(true)
+		}
+	}
+	return record
+}
+
+func (c *ConnectionType) network() string { return c.Network }
+
+// record returns the Connection-Type database record for c
+func (c *ConnectionType) record() mmdbtype.Map {
+	return mmdbtype.Map{
+		"connection_type": mmdbtype.String(c.ConnectionType),
+	}
+}
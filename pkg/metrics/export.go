@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ServeHTTP writes the metrics, in OpenMetrics when the scraper asks for it
+func (c *Config) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format, contentType := FormatText, ContentTypeText
+	if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		format, contentType = FormatOpenMetrics, ContentTypeOpenMetrics
+	}
+	w.Header().Set("Content-Type", contentType)
+	if err := c.Write(w, format); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// WriteFile writes the metrics to path by way of a temporary file in the same
+// directory, so a collector reading the file never sees it half written
+func (c *Config) WriteFile(path, format string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := c.Write(tmp, format); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Exposition formats
+const (
+	FormatText        = "text"
+	FormatOpenMetrics = "openmetrics"
+)
+
+// Content types of the exposition formats
+const (
+	ContentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// DefaultNamespace prefixes every metric name
+const DefaultNamespace = "cloudfront_rtl"
+
+// DefaultBuckets are the time taken histogram bounds in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestLabels are the labels of the request and byte counters
+type requestLabels struct {
+	host         string
+	status       string
+	edgeLocation string
+	cacheResult  string
+}
+
+// histogram is a cumulative-on-write Prometheus histogram
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// metrics configs
+type Config struct {
+	namespace string
+	buckets   []float64
+
+	mu        sync.Mutex
+	requests  map[requestLabels]uint64
+	bytes     map[requestLabels]uint64
+	timeTaken map[string]*histogram
+	latest    float64
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{
+		namespace: DefaultNamespace,
+		buckets:   DefaultBuckets,
+		requests:  make(map[requestLabels]uint64),
+		bytes:     make(map[requestLabels]uint64),
+		timeTaken: make(map[string]*histogram),
+	}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if config.namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+
+	if !sort.Float64sAreSorted(config.buckets) {
+		return nil, fmt.Errorf("buckets must be in increasing order")
+	}
+
+	return config, nil
+}
+
+// SetNamespace sets the prefix of every metric name
+func SetNamespace(namespace string) Option {
+	return func(c *Config) {
+		c.namespace = namespace
+	}
+}
+
+// SetBuckets sets the time taken histogram bounds in seconds
+func SetBuckets(buckets []float64) Option {
+	return func(c *Config) {
+		c.buckets = buckets
+	}
+}
+
+// Add counts the record
+func (c *Config) Add(r *rtl.Record) {
+	labels := requestLabels{
+		host:         r.Host,
+		status:       strconv.Itoa(r.Status),
+		edgeLocation: r.EdgeLocation,
+		cacheResult:  r.EdgeResultType,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[labels]++
+	if r.Bytes > 0 {
+		c.bytes[labels] += uint64(r.Bytes)
+	}
+
+	h, ok := c.timeTaken[r.Host]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.timeTaken[r.Host] = h
+	}
+	for i, bound := range c.buckets {
+		if r.TimeTaken <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += r.TimeTaken
+
+	if ts := float64(r.Timestamp.UnixMilli()) / 1000; ts > c.latest {
+		c.latest = ts
+	}
+}
+
+// Write writes every metric in the given exposition format
+func (c *Config) Write(w io.Writer, format string) error {
+	if format != FormatText && format != FormatOpenMetrics {
+		return fmt.Errorf("unknown metrics format %q", format)
+	}
+	openMetrics := format == FormatOpenMetrics
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+
+	c.writeCounter(&b, openMetrics, "requests", "Requests served by CloudFront.", c.requests)
+	c.writeCounter(&b, openMetrics, "response_bytes", "Bytes served to viewers.", c.bytes)
+
+	name := c.namespace + "_time_taken_seconds"
+	fmt.Fprintf(&b, "# HELP %s Seconds from the edge receiving a request to sending the last byte.\n", name)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+	if openMetrics {
+		fmt.Fprintf(&b, "# UNIT %s seconds\n", name)
+	}
+	for _, host := range sortedKeys(c.timeTaken) {
+		h := c.timeTaken[host]
+		for i, bound := range c.buckets {
+			fmt.Fprintf(&b, "%s_bucket{host=%s,le=\"%s\"} %d\n", name, quote(host), formatFloat(bound), h.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{host=%s,le=\"+Inf\"} %d\n", name, quote(host), h.count)
+		fmt.Fprintf(&b, "%s_sum{host=%s} %s\n", name, quote(host), formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count{host=%s} %d\n", name, quote(host), h.count)
+	}
+
+	name = c.namespace + "_last_request_timestamp_seconds"
+	fmt.Fprintf(&b, "# HELP %s Time of the newest request counted.\n", name)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+	if openMetrics {
+		fmt.Fprintf(&b, "# UNIT %s seconds\n", name)
+	}
+	fmt.Fprintf(&b, "%s %s\n", name, formatFloat(c.latest))
+
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeCounter writes a counter family labelled by requestLabels.
+// OpenMetrics names the family without the _total suffix its samples carry.
+func (c *Config) writeCounter(b *strings.Builder, openMetrics bool, name, help string, values map[requestLabels]uint64) {
+	family := c.namespace + "_" + name + "_total"
+	if openMetrics {
+		family = c.namespace + "_" + name
+	}
+	fmt.Fprintf(b, "# HELP %s %s\n", family, help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", family)
+
+	keys := make([]requestLabels, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.status != b.status {
+			return a.status < b.status
+		}
+		if a.edgeLocation != b.edgeLocation {
+			return a.edgeLocation < b.edgeLocation
+		}
+		return a.cacheResult < b.cacheResult
+	})
+
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s_%s_total{host=%s,status=%s,edge_location=%s,cache_result=%s} %d\n",
+			c.namespace, name, quote(k.host), quote(k.status), quote(k.edgeLocation), quote(k.cacheResult), values[k])
+	}
+}
+
+// quote returns a label value in double quotes with the exposition format escapes
+func quote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,248 @@
+package mysql
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaMigration records a migration that has been applied
+type SchemaMigration struct {
+	ID        string `gorm:"primaryKey;size:128"`
+	AppliedAt time.Time
+}
+
+// migration is a single, named schema change
+type migration struct {
+	id      string
+	migrate func(tx *gorm.DB) error
+}
+
+// migrations are applied in order and never edited once released.
+// New schema changes must be appended as new entries. Each migration
+// migrates frozen copies of the tables as its version changed them, never
+// the current models, so a fresh database goes through the same steps as
+// one created by an older release. Changes to existing tables only add
+// columns, so they go through addColumns rather than AutoMigrate, which
+// would also alter the columns it is given.
+var migrations = []migration{
+	{
+		id: "0001_create_records",
+		migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&recordV1{})
+		},
+	},
+	{
+		id: "0002_create_user_agent_and_geo_location_dimensions",
+		migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&userAgentV2{}, &geoLocationV2{}); err != nil {
+				return err
+			}
+			// adds the foreign key columns and constraints to records
+			return addColumns(tx, &recordV2{})
+		},
+	},
+	{
+		id: "0003_add_user_agent_bot_classification",
+		migrate: func(tx *gorm.DB) error {
+			return addColumns(tx, &userAgentV3{})
+		},
+	},
+	{
+		id: "0004_add_origin_latency_and_request_fields",
+		migrate: func(tx *gorm.DB) error {
+			return addColumns(tx, &recordV4{})
+		},
+	},
+	{
+		id: "0005_add_geo_location_network_fields",
+		migrate: func(tx *gorm.DB) error {
+			return addColumns(tx, &geoLocationV5{})
+		},
+	},
+}
+
+// recordV1 is the records table as 0001 created it
+type recordV1 struct {
+	gorm.Model
+	EdgeRequestID            string    `gorm:"size:64;uniqueIndex"`
+	Timestamp                time.Time `gorm:"index"`
+	ClientIPAddr             string    `gorm:"size:45"`
+	Status                   int
+	Bytes                    int64
+	Method                   string `gorm:"size:16"`
+	Protocol                 string `gorm:"size:16"`
+	Host                     string `gorm:"size:255;index"`
+	UriStem                  string `gorm:"type:text"`
+	EdgeLocation             string `gorm:"size:32"`
+	HostHeader               string `gorm:"size:255"`
+	TimeTaken                float64
+	ProtoVersion             string `gorm:"size:16"`
+	IPVersion                string `gorm:"size:8"`
+	Referer                  string `gorm:"type:text"`
+	Cookie                   string `gorm:"type:text"`
+	UriQuery                 string `gorm:"type:text"`
+	EdgeResponseResultType   string `gorm:"size:32"`
+	SslProtocol              string `gorm:"size:32"`
+	SslCipher                string `gorm:"size:64"`
+	EdgeResultType           string `gorm:"size:32"`
+	ContentType              string `gorm:"size:255"`
+	ContentLength            int64
+	EdgeDetailedResultType   string `gorm:"size:64"`
+	Country                  string `gorm:"size:8"`
+	CacheBehaviorPathPattern string `gorm:"size:255"`
+	Year                     int
+	Month                    int
+	Day                      int
+}
+
+func (recordV1) TableName() string { return "records" }
+
+// userAgentV2 is the user_agents table as 0002 created it
+type userAgentV2 struct {
+	ID                   uint   `gorm:"primaryKey"`
+	Hash                 string `gorm:"size:64;uniqueIndex"`
+	Raw                  string `gorm:"type:text"`
+	BrowserEngine        string `gorm:"size:64"`
+	BrowserEngineVersion string `gorm:"size:64"`
+	BrowserName          string `gorm:"size:64;index"`
+	BrowserVersion       string `gorm:"size:64"`
+	Mozilla              string `gorm:"size:16"`
+	Platform             string `gorm:"size:64"`
+	OS                   string `gorm:"size:128"`
+	Localization         string `gorm:"size:32"`
+	Bot                  bool   `gorm:"index"`
+	Mobile               bool
+}
+
+func (userAgentV2) TableName() string { return "user_agents" }
+
+// geoLocationV2 is the geo_locations table as 0002 created it
+type geoLocationV2 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Hash        string `gorm:"size:64;uniqueIndex"`
+	City        string `gorm:"size:128"`
+	Continent   string `gorm:"size:2"`
+	Country     string `gorm:"size:2;index"`
+	Latitude    float64
+	Longitude   float64
+	MetroCode   uint
+	TimeZone    string `gorm:"size:64"`
+	PostalCode  string `gorm:"size:32"`
+	Subdivision string `gorm:"size:64"`
+}
+
+func (geoLocationV2) TableName() string { return "geo_locations" }
+
+// recordV2 holds the dimension keys 0002 added to records
+type recordV2 struct {
+	UserAgentID   *uint          `gorm:"index"`
+	UserAgent     *userAgentV2   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	GeoLocationID *uint          `gorm:"index"`
+	GeoLocation   *geoLocationV2 `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+}
+
+func (recordV2) TableName() string { return "records" }
+
+// userAgentV3 holds the bot classification columns 0003 added to user_agents
+type userAgentV3 struct {
+	BotName     string `gorm:"size:64;index"`
+	BotCategory string `gorm:"size:16"`
+}
+
+func (userAgentV3) TableName() string { return "user_agents" }
+
+// recordV4 holds the real-time log columns 0004 added to records
+type recordV4 struct {
+	TimeToFirstByte float64
+	OriginFBL       float64
+	OriginLBL       float64
+	ClientPort      int
+	ASN             int64
+	RangeStart      int64
+	RangeEnd        int64
+	AcceptEncoding  string `gorm:"size:255"`
+	Accept          string `gorm:"type:text"`
+	HeadersCount    int
+}
+
+func (recordV4) TableName() string { return "records" }
+
+// geoLocationV5 holds the network columns 0005 added to geo_locations
+type geoLocationV5 struct {
+	ASN               uint   `gorm:"index"`
+	ASNOrg            string `gorm:"size:255"`
+	ISP               string `gorm:"size:255"`
+	IsHostingProvider bool
+	IsTorExit         bool
+	IsVPN             bool
+	ConnectionType    string `gorm:"size:32"`
+}
+
+func (geoLocationV5) TableName() string { return "geo_locations" }
+
+// addColumns adds the columns of model the table lacks, then the model's
+// indexes and foreign key constraints
+func addColumns(tx *gorm.DB, model interface{}) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	m := tx.Migrator()
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || m.HasColumn(model, field.DBName) {
+			continue
+		}
+		if err := m.AddColumn(model, field.Name); err != nil {
+			return err
+		}
+	}
+	for _, idx := range stmt.Schema.ParseIndexes() {
+		if m.HasIndex(model, idx.Name) {
+			continue
+		}
+		if err := m.CreateIndex(model, idx.Name); err != nil {
+			return err
+		}
+	}
+	for _, rel := range stmt.Schema.Relationships.Relations {
+		if rel.ParseConstraint() == nil || m.HasConstraint(model, rel.Name) {
+			continue
+		}
+		if err := m.CreateConstraint(model, rel.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate applies any migrations that have not been applied yet
+func (c *Config) Migrate() error {
+	if err := c.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+
+	var applied []SchemaMigration
+	if err := c.db.Find(&applied).Error; err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, m := range applied {
+		done[m.ID] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.id] {
+			continue
+		}
+		if err := m.migrate(c.db); err != nil {
+			return err
+		}
+		if err := c.db.Create(&SchemaMigration{ID: m.id, AppliedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
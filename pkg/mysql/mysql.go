@@ -1,16 +1,177 @@
 package mysql
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"time"
 
 	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/store"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// DefaultBatchSize is the number of records written per transaction
+const DefaultBatchSize = 1000
+
+// Record is a single request row, keyed on the CloudFront edge request ID.
+// Parsed user agents and GeoIP locations live in their own dimension tables.
 type Record struct {
 	gorm.Model
-	Record *rtl.Record `gorm:"embedded"`
+	EdgeRequestID            string    `gorm:"size:64;uniqueIndex"`
+	Timestamp                time.Time `gorm:"index"`
+	ClientIPAddr             string    `gorm:"size:45"`
+	Status                   int
+	Bytes                    int64
+	Method                   string `gorm:"size:16"`
+	Protocol                 string `gorm:"size:16"`
+	Host                     string `gorm:"size:255;index"`
+	UriStem                  string `gorm:"type:text"`
+	EdgeLocation             string `gorm:"size:32"`
+	HostHeader               string `gorm:"size:255"`
+	TimeTaken                float64
+	ProtoVersion             string `gorm:"size:16"`
+	IPVersion                string `gorm:"size:8"`
+	Referer                  string `gorm:"type:text"`
+	Cookie                   string `gorm:"type:text"`
+	UriQuery                 string `gorm:"type:text"`
+	EdgeResponseResultType   string `gorm:"size:32"`
+	SslProtocol              string `gorm:"size:32"`
+	SslCipher                string `gorm:"size:64"`
+	EdgeResultType           string `gorm:"size:32"`
+	ContentType              string `gorm:"size:255"`
+	ContentLength            int64
+	EdgeDetailedResultType   string `gorm:"size:64"`
+	Country                  string `gorm:"size:8"`
+	CacheBehaviorPathPattern string `gorm:"size:255"`
+	Year                     int
+	Month                    int
+	Day                      int
+	TimeToFirstByte          float64
+	OriginFBL                float64
+	OriginLBL                float64
+	ClientPort               int
+	ASN                      int64
+	RangeStart               int64
+	RangeEnd                 int64
+	AcceptEncoding           string `gorm:"size:255"`
+	Accept                   string `gorm:"type:text"`
+	HeadersCount             int
+	UserAgentID              *uint        `gorm:"index"`
+	UserAgent                *UserAgent   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	GeoLocationID            *uint        `gorm:"index"`
+	GeoLocation              *GeoLocation `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+}
+
+// NewRecord converts an rtl.Record into a database row.
+// The dimension rows are attached but their IDs are resolved on write.
+func NewRecord(r *rtl.Record) *Record {
+	record := &Record{
+		EdgeRequestID:            r.EdgeRequestID,
+		Timestamp:                r.Timestamp,
+		ClientIPAddr:             r.ClientIPAddr,
+		Status:                   r.Status,
+		Bytes:                    r.Bytes,
+		Method:                   r.Method,
+		Protocol:                 r.Protocol,
+		Host:                     r.Host,
+		UriStem:                  r.UriStem,
+		EdgeLocation:             r.EdgeLocation,
+		HostHeader:               r.HostHeader,
+		TimeTaken:                r.TimeTaken,
+		ProtoVersion:             r.ProtoVersion,
+		IPVersion:                r.IPVersion,
+		Referer:                  r.Referer,
+		Cookie:                   r.Cookie,
+		UriQuery:                 r.UriQuery,
+		EdgeResponseResultType:   r.EdgeResponseResultType,
+		SslProtocol:              r.SslProtocol,
+		SslCipher:                r.SslCipher,
+		EdgeResultType:           r.EdgeResultType,
+		ContentType:              r.ContentType,
+		ContentLength:            r.ContentLength,
+		EdgeDetailedResultType:   r.EdgeDetailedResultType,
+		Country:                  r.Country,
+		CacheBehaviorPathPattern: r.CacheBehaviorPathPattern,
+		Year:                     r.Year,
+		Month:                    r.Month,
+		Day:                      r.Day,
+		TimeToFirstByte:          r.TimeToFirstByte,
+		OriginFBL:                r.OriginFBL,
+		OriginLBL:                r.OriginLBL,
+		ClientPort:               r.ClientPort,
+		ASN:                      r.ASN,
+		RangeStart:               r.RangeStart,
+		RangeEnd:                 r.RangeEnd,
+		AcceptEncoding:           r.AcceptEncoding,
+		Accept:                   r.Accept,
+		HeadersCount:             r.HeadersCount,
+	}
+
+	if r.UserAgent != nil {
+		record.UserAgent = NewUserAgent(r.UserAgent)
+	}
+	if r.ClientIP != nil {
+		record.GeoLocation = NewGeoLocation(r.ClientIP)
+	}
+
+	return record
+}
+
+// Record converts a database row, with its dimensions loaded, back into an rtl.Record
+func (r *Record) Record() *rtl.Record {
+	record := &rtl.Record{
+		Timestamp:                r.Timestamp,
+		ClientIPAddr:             r.ClientIPAddr,
+		Status:                   r.Status,
+		Bytes:                    r.Bytes,
+		Method:                   r.Method,
+		Protocol:                 r.Protocol,
+		Host:                     r.Host,
+		UriStem:                  r.UriStem,
+		EdgeLocation:             r.EdgeLocation,
+		EdgeRequestID:            r.EdgeRequestID,
+		HostHeader:               r.HostHeader,
+		TimeTaken:                r.TimeTaken,
+		ProtoVersion:             r.ProtoVersion,
+		IPVersion:                r.IPVersion,
+		Referer:                  r.Referer,
+		Cookie:                   r.Cookie,
+		UriQuery:                 r.UriQuery,
+		EdgeResponseResultType:   r.EdgeResponseResultType,
+		SslProtocol:              r.SslProtocol,
+		SslCipher:                r.SslCipher,
+		EdgeResultType:           r.EdgeResultType,
+		ContentType:              r.ContentType,
+		ContentLength:            r.ContentLength,
+		EdgeDetailedResultType:   r.EdgeDetailedResultType,
+		Country:                  r.Country,
+		CacheBehaviorPathPattern: r.CacheBehaviorPathPattern,
+		Year:                     r.Year,
+		Month:                    r.Month,
+		Day:                      r.Day,
+		TimeToFirstByte:          r.TimeToFirstByte,
+		OriginFBL:                r.OriginFBL,
+		OriginLBL:                r.OriginLBL,
+		ClientPort:               r.ClientPort,
+		ASN:                      r.ASN,
+		RangeStart:               r.RangeStart,
+		RangeEnd:                 r.RangeEnd,
+		AcceptEncoding:           r.AcceptEncoding,
+		Accept:                   r.Accept,
+		HeadersCount:             r.HeadersCount,
+	}
+
+	if r.UserAgent != nil {
+		record.UserAgent = r.UserAgent.Record()
+	}
+	if r.GeoLocation != nil {
+		record.ClientIP = r.GeoLocation.Data(net.ParseIP(r.ClientIPAddr))
+	}
+
+	return record
 }
 
 // Used to manage varidic options
@@ -18,13 +179,23 @@ type Option func(c *Config)
 
 // database configs
 type Config struct {
-	dsn string
-	db  *gorm.DB
+	dsn       string
+	batchSize int
+	db        *gorm.DB
+	pending   []*Record
+
+	// dimension IDs by hash, to avoid looking up known rows every batch
+	userAgents   map[string]uint
+	geoLocations map[string]uint
 }
 
 // New returns a new Config with the given options
 func New(opts ...func(*Config)) (*Config, error) {
-	config := &Config{}
+	config := &Config{
+		batchSize:    DefaultBatchSize,
+		userAgents:   make(map[string]uint),
+		geoLocations: make(map[string]uint),
+	}
 
 	// apply options
 	for _, opt := range opts {
@@ -36,12 +207,19 @@ func New(opts ...func(*Config)) (*Config, error) {
 		return nil, fmt.Errorf("dsn is required")
 	}
 
+	if config.batchSize < 1 {
+		return nil, fmt.Errorf("batch size must be positive")
+	}
+
 	// connect to database
 	if db, err := gorm.Open(mysql.Open(config.dsn)); err != nil {
 		return nil, err
 	} else {
 		config.db = db
-		db.AutoMigrate(&Record{})
+	}
+
+	if err := config.Migrate(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
@@ -54,7 +232,230 @@ func SetDSN(dsn string) Option {
 	}
 }
 
+// SetBatchSize sets the number of records written per transaction
+func SetBatchSize(size int) Option {
+	return func(c *Config) {
+		c.batchSize = size
+	}
+}
+
 // Insert inserts a record into the database
 func (c *Config) Insert(record *Record) error {
-	return c.db.Create(record).Error
+	return c.write([]*Record{record})
+}
+
+// Write queues a record and writes the queue once a batch is full
+func (c *Config) Write(record *rtl.Record) error {
+	c.pending = append(c.pending, NewRecord(record))
+	if len(c.pending) >= c.batchSize {
+		return c.Flush()
+	}
+	return nil
+}
+
+// Flush writes all queued records in a single transaction
+func (c *Config) Flush() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+
+	if err := c.write(c.pending); err != nil {
+		return err
+	}
+
+	c.pending = c.pending[:0]
+	return nil
+}
+
+// Each calls fn for every stored record matching filter, in insertion order.
+// Rows are paged by primary key, which FindInBatches requires; ordering by
+// anything else would skip rows whose IDs are out of that order.
+func (c *Config) Each(ctx context.Context, filter *store.Filter, fn func(record *rtl.Record) error) error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	where, args := filter.Conditions()
+	query := c.db.WithContext(ctx).Preload("UserAgent").Preload("GeoLocation").Where(where, args...)
+	if filter != nil && filter.Country != "" {
+		query = query.Where("geo_location_id IN (?)", c.db.Model(&GeoLocation{}).Select("id").Where("country = ?", filter.Country))
+	}
+
+	var rows []*Record
+	return query.FindInBatches(&rows, c.batchSize, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			record := row.Record()
+			if !filter.Match(record) {
+				continue
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// Close flushes queued records and closes the database connection
+func (c *Config) Close() error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	db, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// dimensionIDs are dimension row IDs by hash
+type dimensionIDs struct {
+	userAgents   map[string]uint
+	geoLocations map[string]uint
+}
+
+// write upserts records in a single transaction. Dimension IDs resolved in
+// the transaction are cached only once it commits, so a rollback does not
+// leave IDs of rows that were never written.
+func (c *Config) write(records []*Record) error {
+	resolved := &dimensionIDs{
+		userAgents:   make(map[string]uint),
+		geoLocations: make(map[string]uint),
+	}
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		return c.upsert(tx, records, resolved)
+	})
+	if err != nil {
+		return err
+	}
+
+	for hash, id := range resolved.userAgents {
+		c.userAgents[hash] = id
+	}
+	for hash, id := range resolved.geoLocations {
+		c.geoLocations[hash] = id
+	}
+	return nil
+}
+
+// upsert inserts records, replacing existing rows with the same edge request ID
+// so that reloading the same data does not duplicate rows
+func (c *Config) upsert(tx *gorm.DB, records []*Record, resolved *dimensionIDs) error {
+	if err := c.resolveUserAgents(tx, records, resolved.userAgents); err != nil {
+		return err
+	}
+	if err := c.resolveGeoLocations(tx, records, resolved.geoLocations); err != nil {
+		return err
+	}
+
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "edge_request_id"}},
+		UpdateAll: true,
+	}).CreateInBatches(records, c.batchSize).Error
+}
+
+// resolveUserAgents upserts the user agents not yet cached, adding their IDs
+// to resolved, and sets UserAgentID on each record. Upserting refreshes the
+// bot classification stored by an earlier run; user agents already cached
+// by this process are not written again.
+func (c *Config) resolveUserAgents(tx *gorm.DB, records []*Record, resolved map[string]uint) error {
+	missing := map[string]*UserAgent{}
+	for _, r := range records {
+		if r.UserAgent == nil {
+			continue
+		}
+		if _, ok := lookupID(r.UserAgent.Hash, c.userAgents, resolved); !ok {
+			missing[r.UserAgent.Hash] = r.UserAgent
+		}
+	}
+
+	if len(missing) > 0 {
+		rows := make([]*UserAgent, 0, len(missing))
+		hashes := make([]string, 0, len(missing))
+		for h, ua := range missing {
+			rows = append(rows, ua)
+			hashes = append(hashes, h)
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "hash"}},
+			DoUpdates: clause.AssignmentColumns([]string{"bot", "bot_name", "bot_category"}),
+		}).CreateInBatches(rows, c.batchSize).Error
+		if err != nil {
+			return err
+		}
+
+		// the insert does not return the IDs of existing rows, so read back every ID
+		var found []UserAgent
+		if err := tx.Select("id", "hash").Where("hash IN ?", hashes).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, ua := range found {
+			resolved[ua.Hash] = ua.ID
+		}
+	}
+
+	for _, r := range records {
+		if r.UserAgent == nil {
+			continue
+		}
+		if id, ok := lookupID(r.UserAgent.Hash, c.userAgents, resolved); ok {
+			r.UserAgentID = &id
+		}
+	}
+	return nil
+}
+
+// resolveGeoLocations inserts unseen locations, adding their IDs to resolved,
+// and sets GeoLocationID on each record
+func (c *Config) resolveGeoLocations(tx *gorm.DB, records []*Record, resolved map[string]uint) error {
+	missing := map[string]*GeoLocation{}
+	for _, r := range records {
+		if r.GeoLocation == nil {
+			continue
+		}
+		if _, ok := lookupID(r.GeoLocation.Hash, c.geoLocations, resolved); !ok {
+			missing[r.GeoLocation.Hash] = r.GeoLocation
+		}
+	}
+
+	if len(missing) > 0 {
+		rows := make([]*GeoLocation, 0, len(missing))
+		hashes := make([]string, 0, len(missing))
+		for h, loc := range missing {
+			rows = append(rows, loc)
+			hashes = append(hashes, h)
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, c.batchSize).Error; err != nil {
+			return err
+		}
+
+		// existing rows are skipped by the insert, so read back every ID
+		var found []GeoLocation
+		if err := tx.Select("id", "hash").Where("hash IN ?", hashes).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, loc := range found {
+			resolved[loc.Hash] = loc.ID
+		}
+	}
+
+	for _, r := range records {
+		if r.GeoLocation == nil {
+			continue
+		}
+		if id, ok := lookupID(r.GeoLocation.Hash, c.geoLocations, resolved); ok {
+			r.GeoLocationID = &id
+		}
+	}
+	return nil
+}
+
+// lookupID returns the ID of hash from the cache or from the current transaction
+func lookupID(hash string, cached, resolved map[string]uint) (uint, bool) {
+	if id, ok := cached[hash]; ok {
+		return id, true
+	}
+	id, ok := resolved[hash]
+	return id, ok
 }
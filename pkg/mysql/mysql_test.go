@@ -0,0 +1,215 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/store"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statements records the SQL gorm would run
+type statements struct {
+	logger.Interface
+	sql []string
+}
+
+func (s *statements) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	s.sql = append(s.sql, sql)
+}
+
+// dryRun returns a Config that builds statements without a server
+func dryRun(t *testing.T) (*Config, *statements) {
+	t.Helper()
+	log := &statements{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Config{
+		batchSize:    DefaultBatchSize,
+		db:           db,
+		userAgents:   make(map[string]uint),
+		geoLocations: make(map[string]uint),
+	}, log
+}
+
+func TestResolveUserAgentsRefreshesBots(t *testing.T) {
+	c, log := dryRun(t)
+	ua := NewUserAgent(&useragent.Record{Raw: "Googlebot/2.1", Bot: true, BotName: "Googlebot", BotCategory: "search"})
+
+	if err := c.resolveUserAgents(c.db, []*Record{{UserAgent: ua}}, map[string]uint{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var insert string
+	for _, sql := range log.sql {
+		if strings.HasPrefix(sql, "INSERT INTO `user_agents`") {
+			insert = sql
+		}
+	}
+	for _, want := range []string{"ON DUPLICATE KEY UPDATE", "`bot`=VALUES(`bot`)", "`bot_name`=VALUES(`bot_name`)", "`bot_category`=VALUES(`bot_category`)"} {
+		if !strings.Contains(insert, want) {
+			t.Errorf("insert %q lacks %s", insert, want)
+		}
+	}
+}
+
+// local returns a Config backed by SQLite with the current schema. SQLite
+// drops indexes when the migrations add constraints, so the models are
+// migrated directly.
+func local(t *testing.T, batchSize int) *Config {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "rtl.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		batchSize:    batchSize,
+		db:           db,
+		userAgents:   make(map[string]uint),
+		geoLocations: make(map[string]uint),
+	}
+	if err := db.AutoMigrate(&Record{}, &UserAgent{}, &GeoLocation{}); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEach(t *testing.T) {
+	c := local(t, 2)
+	start := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+	// Written unordered, so primary key and timestamp order disagree
+	offsets := []int{5, 1, 4, 0, 3, 2, 6}
+	for i, m := range offsets {
+		err := c.Write(&rtl.Record{
+			EdgeRequestID: fmt.Sprintf("req-%d", i),
+			Timestamp:     start.Add(time.Duration(m) * time.Minute),
+			Host:          "a.example.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := map[string]bool{}
+	err := c.Each(context.Background(), &store.Filter{To: start.Add(6 * time.Minute)}, func(r *rtl.Record) error {
+		seen[r.EdgeRequestID] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(offsets)-1 {
+		t.Errorf("got %d records in batches of 2, want %d: %v", len(seen), len(offsets)-1, seen)
+	}
+}
+
+func TestRollbackKeepsCacheClean(t *testing.T) {
+	c := local(t, DefaultBatchSize)
+	record := &rtl.Record{
+		EdgeRequestID: "req-1",
+		Timestamp:     time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC),
+		ClientIPAddr:  "192.0.2.1",
+		UserAgent:     &useragent.Record{Raw: "curl/8.4.0", Bot: true, BotName: "curl", BotCategory: "tool"},
+		ClientIP:      &geoip.GeoIPData{Country: "US", City: "Ashburn"},
+	}
+	if err := c.Write(record); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dimension rows are written before the fact insert fails
+	if err := c.db.Migrator().DropTable(&Record{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err == nil {
+		t.Fatal("expected the flush to fail without a records table")
+	}
+	if len(c.userAgents) != 0 || len(c.geoLocations) != 0 {
+		t.Errorf("cached IDs from a rolled back transaction: %v %v", c.userAgents, c.geoLocations)
+	}
+
+	if err := c.db.AutoMigrate(&Record{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var got []*rtl.Record
+	err := c.Each(context.Background(), nil, func(r *rtl.Record) error {
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].UserAgent == nil || got[0].ClientIP == nil || got[0].ClientIP.Country != "US" {
+		t.Errorf("got %+v, want the record with its dimensions", got)
+	}
+	if len(c.userAgents) != 1 || len(c.geoLocations) != 1 {
+		t.Errorf("got %d user agents and %d locations cached, want 1 each", len(c.userAgents), len(c.geoLocations))
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	// The migrations only use portable schema changes, so SQLite stands in for MySQL
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "rtl.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{db: db}
+	if err := c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying the versions builds the schema the current models describe
+	for _, model := range []interface{}{&Record{}, &UserAgent{}, &GeoLocation{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("%s.%s was not created by any migration", stmt.Schema.Table, field.DBName)
+			}
+		}
+		// SQLite rebuilds a table to add a constraint and loses its indexes
+		// doing so, so only the constraints are checked
+		for _, rel := range stmt.Schema.Relationships.Relations {
+			if rel.ParseConstraint() != nil && !db.Migrator().HasConstraint(model, rel.Name) {
+				t.Errorf("%s: constraint for %s was not created by any migration", stmt.Schema.Table, rel.Name)
+			}
+		}
+	}
+
+	var applied int64
+	if err := db.Model(&SchemaMigration{}).Count(&applied).Error; err != nil {
+		t.Fatal(err)
+	}
+	if applied != int64(len(migrations)) {
+		t.Errorf("%d migrations recorded, want %d", applied, len(migrations))
+	}
+	if err := c.Migrate(); err != nil {
+		t.Errorf("rerunning the migrations: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+)
+
+// UserAgent is a distinct parsed user agent string
+type UserAgent struct {
+	ID                   uint   `gorm:"primaryKey"`
+	Hash                 string `gorm:"size:64;uniqueIndex"`
+	Raw                  string `gorm:"type:text"`
+	BrowserEngine        string `gorm:"size:64"`
+	BrowserEngineVersion string `gorm:"size:64"`
+	BrowserName          string `gorm:"size:64;index"`
+	BrowserVersion       string `gorm:"size:64"`
+	Mozilla              string `gorm:"size:16"`
+	Platform             string `gorm:"size:64"`
+	OS                   string `gorm:"size:128"`
+	Localization         string `gorm:"size:32"`
+	Bot                  bool   `gorm:"index"`
+	BotName              string `gorm:"size:64;index"`
+	BotCategory          string `gorm:"size:16"`
+	Mobile               bool
+}
+
+// NewUserAgent converts a parsed user agent into a dimension row
+func NewUserAgent(ua *useragent.Record) *UserAgent {
+	return &UserAgent{
+		Hash:                 hash(ua.Raw),
+		Raw:                  ua.Raw,
+		BrowserEngine:        ua.BrowserEngine,
+		BrowserEngineVersion: ua.BrowserEngineVersion,
+		BrowserName:          ua.BrowserName,
+		BrowserVersion:       ua.BrowserVersion,
+		Mozilla:              ua.Mozilla,
+		Platform:             ua.Platform,
+		OS:                   ua.OS,
+		Localization:         ua.Localization,
+		Bot:                  ua.Bot,
+		BotName:              ua.BotName,
+		BotCategory:          ua.BotCategory,
+		Mobile:               ua.Mobile,
+	}
+}
+
+// Record converts the dimension row back into a parsed user agent
+func (ua *UserAgent) Record() *useragent.Record {
+	return &useragent.Record{
+		Raw:                  ua.Raw,
+		BrowserEngine:        ua.BrowserEngine,
+		BrowserEngineVersion: ua.BrowserEngineVersion,
+		BrowserName:          ua.BrowserName,
+		BrowserVersion:       ua.BrowserVersion,
+		Mozilla:              ua.Mozilla,
+		Platform:             ua.Platform,
+		OS:                   ua.OS,
+		Localization:         ua.Localization,
+		Bot:                  ua.Bot,
+		BotName:              ua.BotName,
+		BotCategory:          ua.BotCategory,
+		Mobile:               ua.Mobile,
+	}
+}
+
+// GeoLocation is a distinct GeoIP location and network.
+// The client IP itself stays on the request row so locations are shared.
+type GeoLocation struct {
+	ID                uint   `gorm:"primaryKey"`
+	Hash              string `gorm:"size:64;uniqueIndex"`
+	City              string `gorm:"size:128"`
+	Continent         string `gorm:"size:2"`
+	Country           string `gorm:"size:2;index"`
+	Latitude          float64
+	Longitude         float64
+	MetroCode         uint
+	TimeZone          string `gorm:"size:64"`
+	PostalCode        string `gorm:"size:32"`
+	Subdivision       string `gorm:"size:64"`
+	ASN               uint   `gorm:"index"`
+	ASNOrg            string `gorm:"size:255"`
+	ISP               string `gorm:"size:255"`
+	IsHostingProvider bool
+	IsTorExit         bool
+	IsVPN             bool
+	ConnectionType    string `gorm:"size:32"`
+}
+
+// NewGeoLocation converts GeoIP data into a dimension row
+func NewGeoLocation(g *geoip.GeoIPData) *GeoLocation {
+	loc := &GeoLocation{
+		City:              g.City,
+		Continent:         g.Continent,
+		Country:           g.Country,
+		Latitude:          g.Latitude,
+		Longitude:         g.Longitude,
+		MetroCode:         g.MetroCode,
+		TimeZone:          g.TimeZone,
+		PostalCode:        g.PostalCode,
+		Subdivision:       g.Subdivision,
+		ASN:               g.ASN,
+		ASNOrg:            g.ASNOrg,
+		ISP:               g.ISP,
+		IsHostingProvider: g.IsHostingProvider,
+		IsTorExit:         g.IsTorExit,
+		IsVPN:             g.IsVPN,
+		ConnectionType:    g.ConnectionType,
+	}
+	key := fmt.Sprintf("%s|%s|%s|%f|%f|%d|%s|%s|%s",
+		loc.City, loc.Continent, loc.Country, loc.Latitude, loc.Longitude,
+		loc.MetroCode, loc.TimeZone, loc.PostalCode, loc.Subdivision)
+	// Locations without network data keep the hash they had before it existed
+	if loc.ASN != 0 || loc.ASNOrg != "" || loc.ISP != "" || loc.IsHostingProvider || loc.IsTorExit || loc.IsVPN || loc.ConnectionType != "" {
+		key += fmt.Sprintf("|%d|%s|%s|%t|%t|%t|%s",
+			loc.ASN, loc.ASNOrg, loc.ISP, loc.IsHostingProvider, loc.IsTorExit, loc.IsVPN, loc.ConnectionType)
+	}
+	loc.Hash = hash(key)
+	return loc
+}
+
+// Data converts the dimension row back into GeoIP data for ip
+func (loc *GeoLocation) Data(ip net.IP) *geoip.GeoIPData {
+	return &geoip.GeoIPData{
+		IP:                ip,
+		City:              loc.City,
+		Continent:         loc.Continent,
+		Country:           loc.Country,
+		Latitude:          loc.Latitude,
+		Longitude:         loc.Longitude,
+		MetroCode:         loc.MetroCode,
+		TimeZone:          loc.TimeZone,
+		PostalCode:        loc.PostalCode,
+		Subdivision:       loc.Subdivision,
+		ASN:               loc.ASN,
+		ASNOrg:            loc.ASNOrg,
+		ISP:               loc.ISP,
+		IsHostingProvider: loc.IsHostingProvider,
+		IsTorExit:         loc.IsTorExit,
+		IsVPN:             loc.IsVPN,
+		ConnectionType:    loc.ConnectionType,
+	}
+}
+
+// hash returns the natural key used to deduplicate dimension rows
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,270 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/enrich"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Rows is the row iterator feeding the pipeline. *sqlx.Rows satisfies it.
+type Rows interface {
+	Next() bool
+	StructScan(dest interface{}) error
+	Err() error
+}
+
+// Sink receives enriched records one at a time
+type Sink interface {
+	Write(record *rtl.Record) error
+}
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// pipeline configs
+type Config struct {
+	enricher *enrich.Config
+	buffer   int
+	workers  int
+	ordered  bool
+	progress func(count int64)
+}
+
+// item is an entry tagged with its position in the result set
+type item struct {
+	seq   int64
+	entry *fetch.Entry
+}
+
+// result is an enriched record tagged with the position of its entry
+type result struct {
+	seq    int64
+	record *rtl.Record
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{
+		buffer:  1000,
+		workers: runtime.NumCPU(),
+	}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// enricher must be set
+	if config.enricher == nil {
+		return nil, fmt.Errorf("enricher is required")
+	}
+
+	if config.buffer < 1 {
+		return nil, fmt.Errorf("buffer must be positive")
+	}
+
+	if config.workers < 1 {
+		return nil, fmt.Errorf("workers must be positive")
+	}
+
+	return config, nil
+}
+
+// SetEnricher sets the enricher used to build records
+func SetEnricher(enricher *enrich.Config) Option {
+	return func(c *Config) {
+		c.enricher = enricher
+	}
+}
+
+// SetBuffer sets the capacity of the channels between stages
+func SetBuffer(buffer int) Option {
+	return func(c *Config) {
+		c.buffer = buffer
+	}
+}
+
+// SetWorkers sets the number of concurrent enrichment workers
+func SetWorkers(workers int) Option {
+	return func(c *Config) {
+		c.workers = workers
+	}
+}
+
+// SetOrdered makes the sink receive records in the order the rows were read
+func SetOrdered(ordered bool) Option {
+	return func(c *Config) {
+		c.ordered = ordered
+	}
+}
+
+// SetProgress sets a callback invoked every 1000 written records
+func SetProgress(progress func(count int64)) Option {
+	return func(c *Config) {
+		c.progress = progress
+	}
+}
+
+// Run streams rows through the reader, enricher and sink stages.
+// The reader and each enrichment worker run on their own goroutines and the
+// bounded channels between them apply back-pressure to the row iterator, so
+// memory use does not grow with the result size. In ordered mode at most
+// buffer records are in flight, which also bounds the reorder buffer.
+// The first error from any stage stops the pipeline and is returned.
+func (c *Config) Run(ctx context.Context, rows Rows, sink Sink) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	failure := &firstError{cancel: cancel}
+	items := make(chan item, c.buffer)
+	results := make(chan result, c.buffer)
+
+	// window limits the records in flight when the output must be reordered
+	var window chan struct{}
+	if c.ordered {
+		window = make(chan struct{}, c.buffer)
+	}
+
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		defer close(items)
+		failure.set(read(ctx, rows, items, window))
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			failure.set(c.enrich(ctx, items, results))
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	var count int64
+	write := func(record *rtl.Record) {
+		if failure.failed() {
+			// drain so upstream stages can exit
+			return
+		}
+		if err := sink.Write(record); err != nil {
+			failure.set(err)
+			return
+		}
+		count++
+		if c.progress != nil && count%1000 == 0 {
+			c.progress(count)
+		}
+	}
+
+	if c.ordered {
+		var next int64
+		pending := make(map[int64]*rtl.Record)
+		for res := range results {
+			pending[res.seq] = res.record
+			for {
+				record, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				write(record)
+				<-window
+			}
+		}
+	} else {
+		for res := range results {
+			write(res.record)
+		}
+	}
+	readers.Wait()
+
+	return count, failure.get()
+}
+
+// read scans rows into entries until the iterator is exhausted.
+// A non-nil window must have room before each entry is sent.
+func read(ctx context.Context, rows Rows, out chan<- item, window chan struct{}) error {
+	var seq int64
+	for rows.Next() {
+		// fetch.Entry is a struct that is compatible with the data returned from Trino
+		entry := &fetch.Entry{}
+		if err := rows.StructScan(entry); err != nil {
+			return err
+		}
+
+		if window != nil {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case out <- item{seq: seq, entry: entry}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		seq++
+	}
+	return rows.Err()
+}
+
+// enrich converts entries into typed records.
+// maxminddb readers are safe for concurrent use, so workers share the enricher.
+func (c *Config) enrich(ctx context.Context, in <-chan item, out chan<- result) error {
+	for it := range in {
+		record, err := c.enricher.Record(it.entry)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case out <- result{seq: it.seq, record: record}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// firstError keeps the first error reported by any stage and stops the rest
+type firstError struct {
+	mu     sync.Mutex
+	err    error
+	cancel context.CancelFunc
+}
+
+func (f *firstError) set(err error) {
+	if err == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+		f.cancel()
+	}
+}
+
+func (f *firstError) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *firstError) failed() bool {
+	return f.get() != nil
+}
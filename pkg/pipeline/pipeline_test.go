@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/enrich"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip/geoiptest"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// rows iterates over entries, failing with err once they run out
+type rows struct {
+	entries []fetch.Entry
+	next    int
+	err     error
+}
+
+func (r *rows) Next() bool {
+	if r.next >= len(r.entries) {
+		return false
+	}
+	r.next++
+	return true
+}
+
+func (r *rows) StructScan(dest interface{}) error {
+	*dest.(*fetch.Entry) = r.entries[r.next-1]
+	return nil
+}
+
+func (r *rows) Err() error {
+	return r.err
+}
+
+// sink collects the request IDs written, failing on the record with failOn
+type sink struct {
+	ids    []string
+	failOn string
+}
+
+func (s *sink) Write(record *rtl.Record) error {
+	if record.EdgeRequestID == s.failOn {
+		return fmt.Errorf("sink failed on %s", s.failOn)
+	}
+	s.ids = append(s.ids, record.EdgeRequestID)
+	return nil
+}
+
+// testEntries returns n entries one second apart
+func testEntries(n int) []fetch.Entry {
+	entries := make([]fetch.Entry, n)
+	for i := range entries {
+		entries[i] = fetch.Entry{
+			Timestamp:     fmt.Sprintf("%d.000", 1700000000+i),
+			ClientIP:      "192.0.2.1",
+			EdgeRequestID: fmt.Sprintf("req-%04d", i),
+			Year:          "2023",
+			Month:         "11",
+			Day:           "14",
+		}
+	}
+	return entries
+}
+
+// testIDs returns the request IDs of testEntries(n)
+func testIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("req-%04d", i)
+	}
+	return ids
+}
+
+// testPipeline returns a pipeline enriching against a fixture GeoIP database
+func testPipeline(t *testing.T, opts ...func(*Config)) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := geoiptest.Write(path, geoiptest.City{Network: "192.0.2.0/24", Country: "US"}); err != nil {
+		t.Fatal(err)
+	}
+	geo, err := geoip.New(geoip.SetGeoDB(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { geo.Close() })
+	enricher, err := enrich.New(enrich.SetGeoIP(geo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(append([]func(*Config){SetEnricher(enricher)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRun(t *testing.T) {
+	const n = 2500
+	for _, tc := range []struct {
+		name    string
+		workers int
+		buffer  int
+		ordered bool
+	}{
+		{"ordered", 8, 4, true},
+		// a window of one record serialises the workers
+		{"ordered window of one", 8, 1, true},
+		{"ordered one worker", 1, 16, true},
+		{"unordered", 8, 4, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var progress []int64
+			c := testPipeline(t,
+				SetWorkers(tc.workers),
+				SetBuffer(tc.buffer),
+				SetOrdered(tc.ordered),
+				SetProgress(func(count int64) { progress = append(progress, count) }),
+			)
+			out := &sink{}
+			count, err := c.Run(context.Background(), &rows{entries: testEntries(n)}, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != n {
+				t.Errorf("count %d, want %d", count, n)
+			}
+			if !tc.ordered {
+				sort.Strings(out.ids)
+			}
+			if !reflect.DeepEqual(out.ids, testIDs(n)) {
+				t.Errorf("wrote %d records out of order or incomplete", len(out.ids))
+			}
+			if len(progress) != 2 || progress[0] != 1000 || progress[1] != 2000 {
+				t.Errorf("progress %v, want [1000 2000]", progress)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	const n = 500
+	rowsErr := errors.New("connection reset")
+
+	for _, tc := range []struct {
+		name    string
+		rows    func() *rows
+		failOn  string
+		want    string
+		ordered bool
+	}{
+		{
+			name:    "iterator error",
+			rows:    func() *rows { return &rows{entries: testEntries(n), err: rowsErr} },
+			want:    rowsErr.Error(),
+			ordered: true,
+		},
+		{
+			name: "enrich error",
+			rows: func() *rows {
+				entries := testEntries(n)
+				entries[250].Timestamp = "yesterday"
+				return &rows{entries: entries}
+			},
+			want:    "yesterday",
+			ordered: true,
+		},
+		{
+			name:    "sink error",
+			rows:    func() *rows { return &rows{entries: testEntries(n)} },
+			failOn:  "req-0100",
+			want:    "sink failed on req-0100",
+			ordered: true,
+		},
+		{
+			name:   "unordered sink error",
+			rows:   func() *rows { return &rows{entries: testEntries(n)} },
+			failOn: "req-0100",
+			want:   "sink failed on req-0100",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testPipeline(t, SetWorkers(4), SetBuffer(8), SetOrdered(tc.ordered))
+			out := &sink{failOn: tc.failOn}
+			count, err := c.Run(context.Background(), tc.rows(), out)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got error %v, want %q", err, tc.want)
+			}
+			if count != int64(len(out.ids)) {
+				t.Errorf("count %d, but the sink has %d records", count, len(out.ids))
+			}
+			// nothing reaches the sink after the failing record
+			if tc.ordered && tc.failOn != "" && !reflect.DeepEqual(out.ids, testIDs(100)) {
+				t.Errorf("wrote %d records, want the 100 before the failure", len(out.ids))
+			}
+		})
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	c := testPipeline(t, SetWorkers(2), SetBuffer(2), SetOrdered(true))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Run(ctx, &rows{entries: testEntries(100)}, &sink{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
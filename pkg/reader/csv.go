@@ -0,0 +1,118 @@
+package reader
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// CSV reads flattened records written with a header row
+type CSV struct {
+	r *csv.Reader
+	// fields maps each CSV column to its rtl.Flat field index, -1 if unknown
+	fields []int
+}
+
+// NewCSV returns a CSV reader
+func NewCSV(r io.Reader) *CSV {
+	return &CSV{r: csv.NewReader(r)}
+}
+
+// Read parses the next row
+func (r *CSV) Read() (*rtl.Record, error) {
+	if r.fields == nil {
+		header, err := r.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		r.fields = flatFields(header)
+	}
+
+	row, err := r.r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	flat := rtl.Flat{}
+	v := reflect.ValueOf(&flat).Elem()
+	for i, value := range row {
+		if i >= len(r.fields) || r.fields[i] < 0 || value == "" {
+			continue
+		}
+		if err := setField(v.Field(r.fields[i]), value); err != nil {
+			return nil, fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+
+	return flat.Record(), nil
+}
+
+// flatFields resolves column names to rtl.Flat field indexes via their json tags
+func flatFields(header []string) []int {
+	byName := map[string]int{}
+	t := reflect.TypeOf(rtl.Flat{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		byName[name] = i
+	}
+
+	fields := make([]int, len(header))
+	for i, column := range header {
+		if idx, ok := byName[column]; ok {
+			fields[i] = idx
+		} else {
+			fields[i] = -1
+		}
+	}
+	return fields
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case time.Time:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package reader
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Gob reads a stream of gob-encoded records
+type Gob struct {
+	dec *gob.Decoder
+}
+
+// NewGob returns a gob stream reader
+func NewGob(r io.Reader) *Gob {
+	return &Gob{dec: gob.NewDecoder(bufio.NewReader(r))}
+}
+
+// Read decodes the next record
+func (r *Gob) Read() (*rtl.Record, error) {
+	record := &rtl.Record{}
+	if err := r.dec.Decode(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
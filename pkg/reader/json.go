@@ -0,0 +1,64 @@
+package reader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// JSON reads the elements of a JSON array one at a time
+type JSON struct {
+	dec     *json.Decoder
+	started bool
+}
+
+// NewJSON returns a JSON array reader
+func NewJSON(r io.Reader) *JSON {
+	return &JSON{dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+// Read decodes the next array element
+func (r *JSON) Read() (*rtl.Record, error) {
+	if !r.started {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return nil, fmt.Errorf("expected a JSON array")
+		}
+		r.started = true
+	}
+
+	if !r.dec.More() {
+		return nil, io.EOF
+	}
+
+	record := &rtl.Record{}
+	if err := r.dec.Decode(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// NDJSON reads one JSON record per line
+type NDJSON struct {
+	dec *json.Decoder
+}
+
+// NewNDJSON returns a newline-delimited JSON reader
+func NewNDJSON(r io.Reader) *NDJSON {
+	return &NDJSON{dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+// Read decodes the next line
+func (r *NDJSON) Read() (*rtl.Record, error) {
+	record := &rtl.Record{}
+	if err := r.dec.Decode(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
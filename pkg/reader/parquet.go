@@ -0,0 +1,55 @@
+package reader
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Parquet reads flattened records from a Parquet file
+type Parquet struct {
+	r    *parquet.GenericReader[rtl.Flat]
+	rows []rtl.Flat
+	pos  int
+	n    int
+}
+
+// NewParquet returns a Parquet reader
+func NewParquet(r interface {
+	io.ReaderAt
+	io.Seeker
+}) (*Parquet, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Parquet{
+		r:    parquet.NewGenericReader[rtl.Flat](file),
+		rows: make([]rtl.Flat, 1024),
+	}, nil
+}
+
+// Read returns the next row
+func (r *Parquet) Read() (*rtl.Record, error) {
+	if r.pos == r.n {
+		n, err := r.r.Read(r.rows)
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		r.pos, r.n = 0, n
+	}
+
+	record := r.rows[r.pos].Record()
+	r.pos++
+	return record, nil
+}
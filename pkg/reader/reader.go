@@ -0,0 +1,100 @@
+package reader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/writer"
+)
+
+// Reader reads records written by the writer package one at a time.
+// Read returns io.EOF once the input is exhausted.
+type Reader interface {
+	Read() (*rtl.Record, error)
+}
+
+// New returns a Reader for the given format.
+// Parquet needs random access, so r must also be an io.ReaderAt and io.Seeker.
+func New(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case writer.FormatJSON:
+		return NewJSON(r), nil
+	case writer.FormatNDJSON:
+		return NewNDJSON(r), nil
+	case writer.FormatCSV:
+		return NewCSV(r), nil
+	case writer.FormatGob:
+		return NewGob(r), nil
+	case writer.FormatParquet:
+		ra, ok := r.(interface {
+			io.ReaderAt
+			io.Seeker
+		})
+		if !ok {
+			return nil, fmt.Errorf("parquet input must support random access")
+		}
+		return NewParquet(ra)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// File is a Reader backed by a file it owns
+type File struct {
+	Reader
+	Path string
+	f    *os.File
+}
+
+// Open opens the file at path and returns a Reader for it.
+// An empty format is inferred from the file extension.
+func Open(path string, format string) (*File, error) {
+	if format == "" {
+		var err error
+		if format, err = writer.FormatFromPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	fqpn, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fqpn)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := New(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &File{Reader: r, Path: fqpn, f: f}, nil
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Each calls fn for every record in r until the input is exhausted or fn fails
+func Each(r Reader, fn func(record *rtl.Record) error) error {
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
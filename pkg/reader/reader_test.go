@@ -0,0 +1,178 @@
+package reader
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/writer"
+)
+
+// testRecords returns records with every column the writers keep set,
+// including values CSV has to quote
+func testRecords() []*rtl.Record {
+	base := time.Date(2023, 11, 14, 22, 13, 20, 123*int(time.Millisecond), time.UTC)
+	return []*rtl.Record{
+		{
+			Timestamp:                base,
+			ClientIPAddr:             "192.0.2.1",
+			Status:                   200,
+			Bytes:                    5120,
+			Method:                   "GET",
+			Protocol:                 "https",
+			Host:                     "d111111abcdef8.cloudfront.net",
+			UriStem:                  "/index.html",
+			EdgeLocation:             "IAD89-C1",
+			EdgeRequestID:            "req-00",
+			HostHeader:               "www.example.com",
+			TimeTaken:                0.052,
+			ProtoVersion:             "HTTP/2.0",
+			IPVersion:                "IPv4",
+			Referer:                  "https://www.example.com/?a=1,b=\"2\"",
+			Cookie:                   "session=abc; theme=dark",
+			UriQuery:                 "q=a%2Cb",
+			EdgeResponseResultType:   "Hit",
+			SslProtocol:              "TLSv1.3",
+			SslCipher:                "TLS_AES_128_GCM_SHA256",
+			EdgeResultType:           "Hit",
+			ContentType:              "text/html",
+			ContentLength:            5000,
+			EdgeDetailedResultType:   "Hit",
+			Country:                  "US",
+			CacheBehaviorPathPattern: "*",
+			Year:                     2023,
+			Month:                    11,
+			Day:                      14,
+			TimeToFirstByte:          0.031,
+			OriginFBL:                0.02,
+			OriginLBL:                0.025,
+			ClientPort:               51234,
+			ASN:                      64500,
+			RangeStart:               0,
+			RangeEnd:                 1023,
+			AcceptEncoding:           "gzip, br",
+			Accept:                   "text/html",
+			HeadersCount:             12,
+			ClientIP: &geoip.GeoIPData{
+				IP:                net.ParseIP("192.0.2.1"),
+				City:              "Ashburn",
+				Continent:         "NA",
+				Country:           "US",
+				Latitude:          39.0469,
+				Longitude:         -77.4903,
+				MetroCode:         511,
+				TimeZone:          "America/New_York",
+				PostalCode:        "20149",
+				Subdivision:       "VA",
+				ASN:               64500,
+				ASNOrg:            "Example Hosting",
+				ISP:               "Example ISP",
+				IsHostingProvider: true,
+				ConnectionType:    "Corporate",
+			},
+			UserAgent: &useragent.Record{
+				Raw:                  "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0 Safari/537.36",
+				BrowserEngine:        "AppleWebKit",
+				BrowserEngineVersion: "537.36",
+				BrowserName:          "Chrome",
+				BrowserVersion:       "119.0",
+				Mozilla:              "5.0",
+				Platform:             "X11",
+				OS:                   "Linux x86_64",
+				Mobile:               false,
+			},
+		},
+		{
+			Timestamp:     base.Add(time.Second),
+			ClientIPAddr:  "2001:db8::2",
+			Status:        404,
+			Method:        "POST",
+			Host:          "d111111abcdef8.cloudfront.net",
+			UriStem:       "/xmlrpc.php",
+			EdgeRequestID: "req-01",
+			Year:          2023,
+			Month:         11,
+			Day:           14,
+			ClientIP: &geoip.GeoIPData{
+				IP:        net.ParseIP("2001:db8::2"),
+				Country:   "DE",
+				IsTorExit: true,
+				IsVPN:     true,
+			},
+			UserAgent: &useragent.Record{
+				Raw:         "Googlebot/2.1 (+http://www.google.com/bot.html)",
+				Bot:         true,
+				BotName:     "Googlebot",
+				BotCategory: "search",
+				Mobile:      true,
+			},
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []string{writer.FormatJSON, writer.FormatNDJSON, writer.FormatCSV, writer.FormatGob, writer.FormatParquet} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(dir, "records."+format)
+			want := testRecords()
+
+			w, err := writer.Create(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range want {
+				if err := w.Write(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the format is inferred from the extension
+			in, err := Open(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+			var got []*rtl.Record
+			if err := Each(in, func(record *rtl.Record) error {
+				got = append(got, record)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("read %d records, want %d", len(got), len(want))
+			}
+			for i := range want {
+				got[i].Timestamp = got[i].Timestamp.UTC()
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Errorf("record %d:\n got %+v %+v %+v\nwant %+v %+v %+v", i,
+						got[i], got[i].ClientIP, got[i].UserAgent, want[i], want[i].ClientIP, want[i].UserAgent)
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	// parquet needs random access
+	if _, err := New(&bytes.Buffer{}, writer.FormatParquet); err == nil {
+		t.Error("expected an error for parquet from a plain reader")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "records.txt"), ""); err == nil {
+		t.Error("expected an error for an unknown extension")
+	}
+}
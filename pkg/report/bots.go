@@ -0,0 +1,256 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+)
+
+// VerifyFunc checks whether ip really belongs to the named bot and returns
+// one of the useragent.Verify* results
+type VerifyFunc func(name, ip string) string
+
+// botStats counts traffic for one bot
+type botStats struct {
+	category string
+	tally
+	verified int64
+	spoofed  int64
+}
+
+// botHost counts all and bot traffic for one host
+type botHost struct {
+	all  tally
+	bots tally
+}
+
+// Bots reports the share of crawler and automated traffic
+type Bots struct {
+	verify     VerifyFunc
+	total      tally
+	botTotal   tally
+	hosts      map[string]*botHost
+	bots       map[string]*botStats
+	categories tallies
+}
+
+// BotShare is bot traffic against all traffic for a scope
+type BotShare struct {
+	Host             string  `json:"host,omitempty"`
+	Requests         int64   `json:"requests"`
+	Bytes            int64   `json:"bytes"`
+	BotRequests      int64   `json:"bot_requests"`
+	BotBytes         int64   `json:"bot_bytes"`
+	BotRequestsShare float64 `json:"bot_requests_share"`
+	BotBytesShare    float64 `json:"bot_bytes_share"`
+}
+
+// BotEntry is the traffic of a single bot
+type BotEntry struct {
+	Name          string  `json:"name"`
+	Category      string  `json:"category"`
+	Requests      int64   `json:"requests"`
+	Bytes         int64   `json:"bytes"`
+	RequestsShare float64 `json:"requests_share"`
+	BytesShare    float64 `json:"bytes_share"`
+	Verified      int64   `json:"verified,omitempty"`
+	Spoofed       int64   `json:"spoofed,omitempty"`
+}
+
+// BotCategory is the traffic of a bot category
+type BotCategory struct {
+	Category      string  `json:"category"`
+	Requests      int64   `json:"requests"`
+	Bytes         int64   `json:"bytes"`
+	RequestsShare float64 `json:"requests_share"`
+	BytesShare    float64 `json:"bytes_share"`
+}
+
+// BotsResult is the JSON form of the bots report
+type BotsResult struct {
+	Overall    BotShare      `json:"overall"`
+	Hosts      []BotShare    `json:"hosts"`
+	Bots       []BotEntry    `json:"bots"`
+	Categories []BotCategory `json:"categories"`
+}
+
+// NewBots returns a bots report. A nil verify skips reverse DNS verification.
+func NewBots(verify VerifyFunc) *Bots {
+	return &Bots{
+		verify:     verify,
+		hosts:      make(map[string]*botHost),
+		bots:       make(map[string]*botStats),
+		categories: tallies{},
+	}
+}
+
+// classifyBot classifies the record's user agent, falling back to the parser's bot flag
+func classifyBot(r *rtl.Record) *useragent.Bot {
+	if r.UserAgent == nil {
+		return nil
+	}
+	if bot := useragent.Classify(r.UserAgent.Raw); bot != nil {
+		return bot
+	}
+	if r.UserAgent.Bot {
+		return &useragent.Bot{Name: "unknown", Category: useragent.CategoryOther}
+	}
+	return nil
+}
+
+// Add classifies the record and counts it
+func (b *Bots) Add(r *rtl.Record) {
+	b.total.add(r)
+
+	host, ok := b.hosts[r.Host]
+	if !ok {
+		host = &botHost{}
+		b.hosts[r.Host] = host
+	}
+	host.all.add(r)
+
+	bot := classifyBot(r)
+	if bot == nil {
+		return
+	}
+
+	b.botTotal.add(r)
+	host.bots.add(r)
+	b.categories.add(bot.Category, r)
+
+	stats, ok := b.bots[bot.Name]
+	if !ok {
+		stats = &botStats{category: bot.Category}
+		b.bots[bot.Name] = stats
+	}
+	stats.add(r)
+
+	if b.verify != nil {
+		switch b.verify(bot.Name, r.ClientIPAddr) {
+		case useragent.VerifyVerified:
+			stats.verified++
+		case useragent.VerifySpoofed:
+			stats.spoofed++
+		}
+	}
+}
+
+func (b *Bots) share(name string, all, bots tally) BotShare {
+	return BotShare{
+		Host:             name,
+		Requests:         all.Requests,
+		Bytes:            all.Bytes,
+		BotRequests:      bots.Requests,
+		BotBytes:         bots.Bytes,
+		BotRequestsShare: ratio(bots.Requests, all.Requests),
+		BotBytesShare:    ratio(bots.Bytes, all.Bytes),
+	}
+}
+
+// Result returns the bot shares, busiest first
+func (b *Bots) Result() interface{} {
+	res := &BotsResult{Overall: b.share("", b.total, b.botTotal)}
+
+	for name, h := range b.hosts {
+		res.Hosts = append(res.Hosts, b.share(name, h.all, h.bots))
+	}
+	sort.Slice(res.Hosts, func(i, j int) bool {
+		if res.Hosts[i].Requests != res.Hosts[j].Requests {
+			return res.Hosts[i].Requests > res.Hosts[j].Requests
+		}
+		return res.Hosts[i].Host < res.Hosts[j].Host
+	})
+
+	for name, s := range b.bots {
+		res.Bots = append(res.Bots, BotEntry{
+			Name:          name,
+			Category:      s.category,
+			Requests:      s.Requests,
+			Bytes:         s.Bytes,
+			RequestsShare: ratio(s.Requests, b.total.Requests),
+			BytesShare:    ratio(s.Bytes, b.total.Bytes),
+			Verified:      s.verified,
+			Spoofed:       s.spoofed,
+		})
+	}
+	sort.Slice(res.Bots, func(i, j int) bool {
+		if res.Bots[i].Requests != res.Bots[j].Requests {
+			return res.Bots[i].Requests > res.Bots[j].Requests
+		}
+		return res.Bots[i].Name < res.Bots[j].Name
+	})
+
+	for _, category := range b.categories.top(0, byRequests) {
+		c := b.categories[category]
+		res.Categories = append(res.Categories, BotCategory{
+			Category:      category,
+			Requests:      c.Requests,
+			Bytes:         c.Bytes,
+			RequestsShare: ratio(c.Requests, b.total.Requests),
+			BytesShare:    ratio(c.Bytes, b.total.Bytes),
+		})
+	}
+
+	return res
+}
+
+// Tables returns the bot shares as tables
+func (b *Bots) Tables() []Table {
+	res := b.Result().(*BotsResult)
+
+	shareColumns := []string{"requests", "bot requests", "bot requests %", "bytes", "bot bytes", "bot bytes %"}
+	shareRow := func(key string, s BotShare) []string {
+		return []string{
+			key,
+			strconv.FormatInt(s.Requests, 10),
+			strconv.FormatInt(s.BotRequests, 10),
+			percent(s.BotRequests, s.Requests),
+			strconv.FormatInt(s.Bytes, 10),
+			strconv.FormatInt(s.BotBytes, 10),
+			percent(s.BotBytes, s.Bytes),
+		}
+	}
+
+	overall := Table{Title: "Bot share overall", Columns: append([]string{"scope"}, shareColumns...)}
+	overall.Rows = append(overall.Rows, shareRow("(all)", res.Overall))
+
+	hosts := Table{Title: "Bot share by host", Columns: append([]string{"host"}, shareColumns...)}
+	for _, h := range res.Hosts {
+		hosts.Rows = append(hosts.Rows, shareRow(h.Host, h))
+	}
+
+	botColumns := []string{"bot", "category", "requests", "requests %", "bytes", "bytes %"}
+	if b.verify != nil {
+		botColumns = append(botColumns, "verified", "spoofed")
+	}
+	bots := Table{Title: "Bots", Columns: botColumns}
+	for _, e := range res.Bots {
+		row := []string{
+			e.Name,
+			e.Category,
+			strconv.FormatInt(e.Requests, 10),
+			percent(e.Requests, res.Overall.Requests),
+			strconv.FormatInt(e.Bytes, 10),
+			percent(e.Bytes, res.Overall.Bytes),
+		}
+		if b.verify != nil {
+			row = append(row, strconv.FormatInt(e.Verified, 10), strconv.FormatInt(e.Spoofed, 10))
+		}
+		bots.Rows = append(bots.Rows, row)
+	}
+
+	categories := Table{Title: "Bot categories", Columns: []string{"category", "requests", "requests %", "bytes", "bytes %"}}
+	for _, c := range res.Categories {
+		categories.Rows = append(categories.Rows, []string{
+			c.Category,
+			strconv.FormatInt(c.Requests, 10),
+			percent(c.Requests, res.Overall.Requests),
+			strconv.FormatInt(c.Bytes, 10),
+			percent(c.Bytes, res.Overall.Bytes),
+		})
+	}
+
+	return []Table{overall, hosts, bots, categories}
+}
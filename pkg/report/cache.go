@@ -0,0 +1,200 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// cacheStats counts requests by edge result type
+type cacheStats struct {
+	Requests    int64
+	Hits        int64
+	RefreshHits int64
+	Misses      int64
+	Errors      int64
+	Other       int64
+	Bytes       int64
+	MissBytes   int64
+}
+
+func (s *cacheStats) add(r *rtl.Record) {
+	s.Requests++
+	s.Bytes += r.Bytes
+	switch r.EdgeResultType {
+	case "Hit":
+		s.Hits++
+	case "RefreshHit":
+		s.RefreshHits++
+	case "Miss":
+		s.Misses++
+		s.MissBytes += r.Bytes
+	case "Error", "LimitExceeded", "CapacityExceeded", "FunctionExecutionError", "FunctionThrottledError":
+		s.Errors++
+	default:
+		// Redirect, FunctionGeneratedResponse and any future types
+		s.Other++
+	}
+}
+
+// CacheRatios is the JSON form of a set of cache counts
+type CacheRatios struct {
+	Key             string  `json:"key,omitempty"`
+	Requests        int64   `json:"requests"`
+	Bytes           int64   `json:"bytes"`
+	MissBytes       int64   `json:"miss_bytes"`
+	HitRatio        float64 `json:"hit_ratio"`
+	RefreshHitRatio float64 `json:"refresh_hit_ratio"`
+	MissRatio       float64 `json:"miss_ratio"`
+	ErrorRatio      float64 `json:"error_ratio"`
+	OtherRatio      float64 `json:"other_ratio"`
+}
+
+func (s *cacheStats) ratios(key string) CacheRatios {
+	return CacheRatios{
+		Key:             key,
+		Requests:        s.Requests,
+		Bytes:           s.Bytes,
+		MissBytes:       s.MissBytes,
+		HitRatio:        ratio(s.Hits, s.Requests),
+		RefreshHitRatio: ratio(s.RefreshHits, s.Requests),
+		MissRatio:       ratio(s.Misses, s.Requests),
+		ErrorRatio:      ratio(s.Errors, s.Requests),
+		OtherRatio:      ratio(s.Other, s.Requests),
+	}
+}
+
+// cacheGroups holds cache counts per key
+type cacheGroups map[string]*cacheStats
+
+func (g cacheGroups) add(key string, r *rtl.Record) {
+	s, ok := g[key]
+	if !ok {
+		s = &cacheStats{}
+		g[key] = s
+	}
+	s.add(r)
+}
+
+// sorted returns the group ratios ordered by less
+func (g cacheGroups) sorted(less func(a, b CacheRatios) bool) []CacheRatios {
+	out := make([]CacheRatios, 0, len(g))
+	for k, s := range g {
+		out = append(out, s.ratios(k))
+	}
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+// Cache reports CloudFront cache efficiency from the edge result types
+type Cache struct {
+	n        int
+	bucket   time.Duration
+	overall  cacheStats
+	patterns cacheGroups
+	edges    cacheGroups
+	buckets  cacheGroups
+	uris     cacheGroups
+}
+
+// CacheResult is the JSON form of the cache report
+type CacheResult struct {
+	Overall         CacheRatios   `json:"overall"`
+	ByPathPattern   []CacheRatios `json:"by_path_pattern"`
+	ByEdgeLocation  []CacheRatios `json:"by_edge_location"`
+	ByTime          []CacheRatios `json:"by_time"`
+	WorstURIsByMiss []CacheRatios `json:"worst_uris_by_miss_bytes"`
+}
+
+// NewCache returns a cache report with the given time bucket size and number of worst URIs
+func NewCache(n int, bucket time.Duration) *Cache {
+	return &Cache{
+		n:        n,
+		bucket:   bucket,
+		patterns: cacheGroups{},
+		edges:    cacheGroups{},
+		buckets:  cacheGroups{},
+		uris:     cacheGroups{},
+	}
+}
+
+// Add counts the record overall and in each grouping
+func (c *Cache) Add(r *rtl.Record) {
+	c.overall.add(r)
+	c.patterns.add(r.CacheBehaviorPathPattern, r)
+	c.edges.add(r.EdgeLocation, r)
+	c.buckets.add(r.Timestamp.UTC().Truncate(c.bucket).Format(time.RFC3339), r)
+	c.uris.add(r.UriStem, r)
+}
+
+// Result returns the cache ratios
+func (c *Cache) Result() interface{} {
+	byRequests := func(a, b CacheRatios) bool {
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Key < b.Key
+	}
+
+	worst := c.uris.sorted(func(a, b CacheRatios) bool {
+		if a.MissBytes != b.MissBytes {
+			return a.MissBytes > b.MissBytes
+		}
+		return a.Key < b.Key
+	})
+	// URIs without misses have nothing to tune
+	for i, u := range worst {
+		if u.MissBytes == 0 || (c.n > 0 && i == c.n) {
+			worst = worst[:i]
+			break
+		}
+	}
+
+	return &CacheResult{
+		Overall:         c.overall.ratios(""),
+		ByPathPattern:   c.patterns.sorted(byRequests),
+		ByEdgeLocation:  c.edges.sorted(byRequests),
+		ByTime:          c.buckets.sorted(func(a, b CacheRatios) bool { return a.Key < b.Key }),
+		WorstURIsByMiss: worst,
+	}
+}
+
+// Tables returns the cache ratios as tables
+func (c *Cache) Tables() []Table {
+	res := c.Result().(*CacheResult)
+	return []Table{
+		cacheTable("Cache overall", "scope", []CacheRatios{res.Overall}),
+		cacheTable("Cache by path pattern", "path_pattern", res.ByPathPattern),
+		cacheTable("Cache by edge location", "edge_location", res.ByEdgeLocation),
+		cacheTable(fmt.Sprintf("Cache per %s bucket", c.bucket), "time", res.ByTime),
+		cacheTable("Worst URIs by miss bytes", "uri_stem", res.WorstURIsByMiss),
+	}
+}
+
+func cacheTable(title, name string, rows []CacheRatios) Table {
+	table := Table{
+		Title:   title,
+		Columns: []string{name, "requests", "bytes", "miss bytes", "hit", "refresh hit", "miss", "error", "other"},
+	}
+	for _, r := range rows {
+		key := r.Key
+		if key == "" {
+			key = "(all)"
+		}
+		table.Rows = append(table.Rows, []string{
+			key,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.Bytes, 10),
+			strconv.FormatInt(r.MissBytes, 10),
+			fmt.Sprintf("%.2f%%", r.HitRatio*100),
+			fmt.Sprintf("%.2f%%", r.RefreshHitRatio*100),
+			fmt.Sprintf("%.2f%%", r.MissRatio*100),
+			fmt.Sprintf("%.2f%%", r.ErrorRatio*100),
+			fmt.Sprintf("%.2f%%", r.OtherRatio*100),
+		})
+	}
+	return table
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Dimension extracts a grouping key from a record
+type Dimension struct {
+	Name string
+	Key  func(record *rtl.Record) string
+}
+
+// dimensions are the groupings reports can be broken down by
+var dimensions = map[string]Dimension{
+	"host":             {Name: "host", Key: func(r *rtl.Record) string { return r.Host }},
+	"host_header":      {Name: "host_header", Key: func(r *rtl.Record) string { return r.HostHeader }},
+	"uri_stem":         {Name: "uri_stem", Key: func(r *rtl.Record) string { return r.UriStem }},
+	"client_ip":        {Name: "client_ip", Key: func(r *rtl.Record) string { return r.ClientIPAddr }},
+	"referer":          {Name: "referer", Key: func(r *rtl.Record) string { return r.Referer }},
+	"browser":          {Name: "browser", Key: browserName},
+	"country":          {Name: "country", Key: geoCountry},
+	"edge_location":    {Name: "edge_location", Key: func(r *rtl.Record) string { return r.EdgeLocation }},
+	"protocol_version": {Name: "protocol_version", Key: func(r *rtl.Record) string { return r.ProtoVersion }},
+	"edge_result_type": {Name: "edge_result_type", Key: func(r *rtl.Record) string { return r.EdgeResultType }},
+	"method":           {Name: "method", Key: func(r *rtl.Record) string { return r.Method }},
+	"path_pattern":     {Name: "path_pattern", Key: func(r *rtl.Record) string { return r.CacheBehaviorPathPattern }},
+	"asn":              {Name: "asn", Key: geoASN},
+	"isp":              {Name: "isp", Key: func(r *rtl.Record) string { return geo(r).ISP }},
+	"connection_type":  {Name: "connection_type", Key: func(r *rtl.Record) string { return geo(r).ConnectionType }},
+	"network":          {Name: "network", Key: geoNetwork},
+}
+
+// LookupDimensions resolves dimension names
+func LookupDimensions(names []string) ([]Dimension, error) {
+	out := make([]Dimension, 0, len(names))
+	for _, name := range names {
+		d, ok := dimensions[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown dimension %q (known: %s)", name, strings.Join(DimensionNames(), ", "))
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// DimensionNames lists the known dimension names
+func DimensionNames() []string {
+	names := make([]string, 0, len(dimensions))
+	for name := range dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func browserName(r *rtl.Record) string {
+	if r.UserAgent == nil {
+		return ""
+	}
+	return r.UserAgent.BrowserName
+}
+
+func geoCountry(r *rtl.Record) string {
+	if r.ClientIP == nil {
+		return ""
+	}
+	return r.ClientIP.Country
+}
+
+// geo returns the record's GeoIP data, empty when it has none
+func geo(r *rtl.Record) *geoip.GeoIPData {
+	if r.ClientIP == nil {
+		return &geoip.GeoIPData{}
+	}
+	return r.ClientIP
+}
+
+// geoASN keys on the autonomous system, e.g. "AS64500 Example Hosting"
+func geoASN(r *rtl.Record) string {
+	g := geo(r)
+	if g.ASN == 0 {
+		return ""
+	}
+	return strings.TrimSpace("AS" + strconv.FormatUint(uint64(g.ASN), 10) + " " + g.ASNOrg)
+}
+
+// geoNetwork classifies the client network from the Anonymous-IP data,
+// separating datacenter and anonymized traffic from everything else
+func geoNetwork(r *rtl.Record) string {
+	g := geo(r)
+	switch {
+	case g.IsTorExit:
+		return "tor_exit"
+	case g.IsVPN:
+		return "vpn"
+	case g.IsHostingProvider:
+		return "hosting_provider"
+	}
+	return ""
+}
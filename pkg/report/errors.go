@@ -0,0 +1,227 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// statusCounts counts requests by status class
+type statusCounts struct {
+	Total   int64 `json:"total"`
+	Status2 int64 `json:"status_2xx"`
+	Status3 int64 `json:"status_3xx"`
+	Status4 int64 `json:"status_4xx"`
+	Status5 int64 `json:"status_5xx"`
+	Other   int64 `json:"other"`
+}
+
+func (c *statusCounts) add(status int) {
+	c.Total++
+	switch status / 100 {
+	case 2:
+		c.Status2++
+	case 3:
+		c.Status3++
+	case 4:
+		c.Status4++
+	case 5:
+		c.Status5++
+	default:
+		c.Other++
+	}
+}
+
+// errorRate is the share of 4xx and 5xx responses
+func (c *statusCounts) errorRate() float64 {
+	return ratio(c.Status4+c.Status5, c.Total)
+}
+
+// ErrorPoint is one time bucket of the status series
+type ErrorPoint struct {
+	Time time.Time `json:"time"`
+	statusCounts
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// ErrorGroup is the status breakdown for one key
+type ErrorGroup struct {
+	Key string `json:"key"`
+	statusCounts
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// ErrorsResult is the JSON form of the errors report
+type ErrorsResult struct {
+	Bucket         string       `json:"bucket"`
+	Overall        ErrorGroup   `json:"overall"`
+	Series         []ErrorPoint `json:"series"`
+	TopURIs4xx     []ErrorGroup `json:"top_uris_4xx"`
+	TopURIs5xx     []ErrorGroup `json:"top_uris_5xx"`
+	TopClients4xx  []ErrorGroup `json:"top_clients_4xx"`
+	TopClients5xx  []ErrorGroup `json:"top_clients_5xx"`
+	ByEdgeLocation []ErrorGroup `json:"by_edge_location"`
+}
+
+// Errors reports status classes over time and the sources of 4xx and 5xx responses
+type Errors struct {
+	n       int
+	bucket  time.Duration
+	overall statusCounts
+	series  map[time.Time]*statusCounts
+	uris    map[string]*statusCounts
+	clients map[string]*statusCounts
+	edges   map[string]*statusCounts
+}
+
+// NewErrors returns an errors report with the given time bucket size and top list length
+func NewErrors(n int, bucket time.Duration) *Errors {
+	return &Errors{
+		n:       n,
+		bucket:  bucket,
+		series:  make(map[time.Time]*statusCounts),
+		uris:    make(map[string]*statusCounts),
+		clients: make(map[string]*statusCounts),
+		edges:   make(map[string]*statusCounts),
+	}
+}
+
+func countStatus[K comparable](m map[K]*statusCounts, key K, status int) {
+	c, ok := m[key]
+	if !ok {
+		c = &statusCounts{}
+		m[key] = c
+	}
+	c.add(status)
+}
+
+// Add counts the record's status
+func (e *Errors) Add(r *rtl.Record) {
+	e.overall.add(r.Status)
+	countStatus(e.series, r.Timestamp.UTC().Truncate(e.bucket), r.Status)
+	countStatus(e.uris, r.UriStem, r.Status)
+	countStatus(e.clients, r.ClientIPAddr, r.Status)
+	countStatus(e.edges, r.EdgeLocation, r.Status)
+}
+
+// Result returns the series and breakdowns
+func (e *Errors) Result() interface{} {
+	res := &ErrorsResult{
+		Bucket:  e.bucket.String(),
+		Overall: ErrorGroup{Key: "", statusCounts: e.overall, ErrorRate: e.overall.errorRate()},
+	}
+
+	times := make([]time.Time, 0, len(e.series))
+	for t := range e.series {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	// Buckets without requests are filled with zeros so charts do not
+	// interpolate across the gaps
+	if len(times) > 0 && e.bucket > 0 {
+		first, last := times[0], times[len(times)-1]
+		times = times[:0]
+		for t := first; !t.After(last); t = t.Add(e.bucket) {
+			times = append(times, t)
+		}
+	}
+	for _, t := range times {
+		var c statusCounts
+		if counts, ok := e.series[t]; ok {
+			c = *counts
+		}
+		res.Series = append(res.Series, ErrorPoint{Time: t, statusCounts: c, ErrorRate: c.errorRate()})
+	}
+
+	count4 := func(c *statusCounts) int64 { return c.Status4 }
+	count5 := func(c *statusCounts) int64 { return c.Status5 }
+	res.TopURIs4xx = topErrors(e.uris, e.n, count4)
+	res.TopURIs5xx = topErrors(e.uris, e.n, count5)
+	res.TopClients4xx = topErrors(e.clients, e.n, count4)
+	res.TopClients5xx = topErrors(e.clients, e.n, count5)
+	// every edge is listed, so error rates compare across all of them
+	res.ByEdgeLocation = rankErrors(e.edges, func(c *statusCounts) int64 { return c.Status4 + c.Status5 })
+
+	return res
+}
+
+// topErrors ranks keys by value, dropping keys where it is zero
+func topErrors(m map[string]*statusCounts, n int, value func(*statusCounts) int64) []ErrorGroup {
+	var out []ErrorGroup
+	for _, g := range rankErrors(m, value) {
+		if value(&g.statusCounts) == 0 || (n > 0 && len(out) == n) {
+			break
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// rankErrors returns every key ranked by value
+func rankErrors(m map[string]*statusCounts, value func(*statusCounts) int64) []ErrorGroup {
+	out := make([]ErrorGroup, 0, len(m))
+	for k, c := range m {
+		out = append(out, ErrorGroup{Key: k, statusCounts: *c, ErrorRate: c.errorRate()})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		vi, vj := value(&out[i].statusCounts), value(&out[j].statusCounts)
+		if vi != vj {
+			return vi > vj
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// Series returns the per-bucket status counts
+func (e *Errors) Series() Table {
+	res := e.Result().(*ErrorsResult)
+	table := Table{
+		Title:   fmt.Sprintf("Status per %s", e.bucket),
+		Columns: []string{"time", "total", "2xx", "3xx", "4xx", "5xx", "other", "error_rate"},
+	}
+	for _, p := range res.Series {
+		table.Rows = append(table.Rows, append([]string{p.Time.Format(time.RFC3339)}, countCells(p.statusCounts, p.ErrorRate)...))
+	}
+	return table
+}
+
+// Tables returns the terminal summary followed by the series
+func (e *Errors) Tables() []Table {
+	res := e.Result().(*ErrorsResult)
+	return []Table{
+		errorTable("Status overall", "scope", []ErrorGroup{{Key: "(all)", statusCounts: res.Overall.statusCounts, ErrorRate: res.Overall.ErrorRate}}),
+		errorTable("Top URIs by 4xx", "uri_stem", res.TopURIs4xx),
+		errorTable("Top URIs by 5xx", "uri_stem", res.TopURIs5xx),
+		errorTable("Top clients by 4xx", "client_ip", res.TopClients4xx),
+		errorTable("Top clients by 5xx", "client_ip", res.TopClients5xx),
+		errorTable("Errors by edge location", "edge_location", res.ByEdgeLocation),
+		e.Series(),
+	}
+}
+
+func errorTable(title, name string, groups []ErrorGroup) Table {
+	table := Table{
+		Title:   title,
+		Columns: []string{name, "total", "2xx", "3xx", "4xx", "5xx", "other", "error_rate"},
+	}
+	for _, g := range groups {
+		table.Rows = append(table.Rows, append([]string{g.Key}, countCells(g.statusCounts, g.ErrorRate)...))
+	}
+	return table
+}
+
+func countCells(c statusCounts, rate float64) []string {
+	return []string{
+		strconv.FormatInt(c.Total, 10),
+		strconv.FormatInt(c.Status2, 10),
+		strconv.FormatInt(c.Status3, 10),
+		strconv.FormatInt(c.Status4, 10),
+		strconv.FormatInt(c.Status5, 10),
+		strconv.FormatInt(c.Other, 10),
+		fmt.Sprintf("%.4f", rate),
+	}
+}
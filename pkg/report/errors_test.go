@@ -0,0 +1,49 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+func TestErrors(t *testing.T) {
+	start := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+	e := NewErrors(10, time.Minute)
+	for _, r := range []*rtl.Record{
+		{Timestamp: start, EdgeLocation: "IAD89-C1", UriStem: "/", Status: 200},
+		{Timestamp: start.Add(10 * time.Second), EdgeLocation: "IAD89-C1", UriStem: "/missing", Status: 404},
+		// nothing in the next two minutes
+		{Timestamp: start.Add(3 * time.Minute), EdgeLocation: "FRA56-P1", UriStem: "/", Status: 200},
+		{Timestamp: start.Add(3 * time.Minute), EdgeLocation: "FRA56-P1", UriStem: "/", Status: 304},
+	} {
+		e.Add(r)
+	}
+	res := e.Result().(*ErrorsResult)
+
+	if len(res.Series) != 4 {
+		t.Fatalf("got %d buckets, want 4 with the gap filled", len(res.Series))
+	}
+	for i, want := range []int64{2, 0, 0, 2} {
+		p := res.Series[i]
+		if !p.Time.Equal(start.Add(time.Duration(i)*time.Minute)) || p.Total != want {
+			t.Errorf("bucket %d: got %s with %d requests, want %s with %d", i, p.Time, p.Total, start.Add(time.Duration(i)*time.Minute), want)
+		}
+	}
+
+	// An edge without errors is listed with a zero rate
+	if len(res.ByEdgeLocation) != 2 {
+		t.Fatalf("got edges %+v, want both", res.ByEdgeLocation)
+	}
+	if g := res.ByEdgeLocation[0]; g.Key != "IAD89-C1" || g.ErrorRate != 0.5 {
+		t.Errorf("got %+v first, want IAD89-C1 at 0.5", g)
+	}
+	if g := res.ByEdgeLocation[1]; g.Key != "FRA56-P1" || g.ErrorRate != 0 || g.Total != 2 {
+		t.Errorf("got %+v second, want FRA56-P1 at 0", g)
+	}
+
+	// The top lists still leave out keys without errors of their class
+	if len(res.TopURIs4xx) != 1 || res.TopURIs4xx[0].Key != "/missing" || len(res.TopURIs5xx) != 0 {
+		t.Errorf("got top URIs %+v %+v", res.TopURIs4xx, res.TopURIs5xx)
+	}
+}
@@ -0,0 +1,335 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Latency histograms record microseconds between 1µs and 10 minutes with
+// two significant digits, so each group stays small and histograms built
+// from different inputs can be merged exactly.
+const (
+	latencyMin     = 1
+	latencyMax     = int64(10 * time.Minute / time.Microsecond)
+	latencySigFigs = 2
+)
+
+// LatencyDimensions are the default groupings for the latency report
+var LatencyDimensions = []Dimension{
+	dimensions["host"],
+}
+
+// latencyComponent is a part of a request's latency, recorded alongside
+// TimeTaken when the real-time log configuration includes its fields
+type latencyComponent struct {
+	name  string
+	value func(r *rtl.Record) (float64, bool)
+}
+
+// latencyComponents separate origin slowness from edge slowness. The origin
+// latencies are only logged for requests CloudFront forwarded to the origin;
+// edge is the rest of those requests' time taken.
+var latencyComponents = []latencyComponent{
+	{"ttfb", func(r *rtl.Record) (float64, bool) { return r.TimeToFirstByte, r.TimeToFirstByte > 0 }},
+	{"origin_fbl", func(r *rtl.Record) (float64, bool) { return r.OriginFBL, r.OriginFBL > 0 }},
+	{"origin_lbl", func(r *rtl.Record) (float64, bool) { return r.OriginLBL, r.OriginLBL > 0 }},
+	{"edge", func(r *rtl.Record) (float64, bool) { return r.TimeTaken - r.OriginLBL, r.OriginLBL > 0 }},
+}
+
+// Latency reports TimeTaken percentiles per group and time bucket, with the
+// origin and edge breakdown when the records carry it
+type Latency struct {
+	dimensions []Dimension
+	bucket     time.Duration
+	overall    *latencyHistograms
+	groups     map[string]*latencyGroup
+}
+
+// latencyGroup is the histograms for one combination of dimension values and bucket
+type latencyGroup struct {
+	keys   []string
+	bucket time.Time
+	*latencyHistograms
+}
+
+// latencyHistograms holds the TimeTaken histogram and one per latency
+// component, created when the component is first recorded
+type latencyHistograms struct {
+	h          *hdrhistogram.Histogram
+	components []*hdrhistogram.Histogram
+}
+
+// LatencyStats is the JSON form of one histogram, in seconds
+type LatencyStats struct {
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+	Time       *time.Time        `json:"time,omitempty"`
+	Count      int64             `json:"count"`
+	Mean       float64           `json:"mean"`
+	P50        float64           `json:"p50"`
+	P90        float64           `json:"p90"`
+	P99        float64           `json:"p99"`
+	Max        float64           `json:"max"`
+
+	// Breakdown holds the stats of the latency components, by name
+	Breakdown map[string]LatencyStats `json:"breakdown,omitempty"`
+}
+
+// LatencyResult is the JSON form of the latency report
+type LatencyResult struct {
+	Overall LatencyStats   `json:"overall"`
+	Groups  []LatencyStats `json:"groups"`
+}
+
+// NewLatency returns a latency report grouped by the given dimensions
+// (LatencyDimensions if none) and, when bucket is non-zero, by time bucket
+func NewLatency(bucket time.Duration, dims ...Dimension) *Latency {
+	if len(dims) == 0 {
+		dims = LatencyDimensions
+	}
+	return &Latency{
+		dimensions: dims,
+		bucket:     bucket,
+		overall:    newLatencyHistograms(),
+		groups:     make(map[string]*latencyGroup),
+	}
+}
+
+func newLatencyHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(latencyMin, latencyMax, latencySigFigs)
+}
+
+func newLatencyHistograms() *latencyHistograms {
+	return &latencyHistograms{
+		h:          newLatencyHistogram(),
+		components: make([]*hdrhistogram.Histogram, len(latencyComponents)),
+	}
+}
+
+// Add records the request's time taken and its latency components
+func (l *Latency) Add(r *rtl.Record) {
+	l.overall.record(r)
+	l.group(r).record(r)
+}
+
+func (lh *latencyHistograms) record(r *rtl.Record) {
+	lh.h.RecordValue(micros(r.TimeTaken))
+	for i, c := range latencyComponents {
+		v, ok := c.value(r)
+		if !ok {
+			continue
+		}
+		if lh.components[i] == nil {
+			lh.components[i] = newLatencyHistogram()
+		}
+		lh.components[i].RecordValue(micros(v))
+	}
+}
+
+func (lh *latencyHistograms) merge(other *latencyHistograms) {
+	lh.h.Merge(other.h)
+	for i, h := range other.components {
+		if h == nil {
+			continue
+		}
+		if lh.components[i] == nil {
+			lh.components[i] = newLatencyHistogram()
+		}
+		lh.components[i].Merge(h)
+	}
+}
+
+// stats returns the TimeTaken stats with the recorded components' breakdown
+func (lh *latencyHistograms) stats() LatencyStats {
+	stats := latencyStats(lh.h)
+	for i, h := range lh.components {
+		if h == nil {
+			continue
+		}
+		if stats.Breakdown == nil {
+			stats.Breakdown = make(map[string]LatencyStats)
+		}
+		stats.Breakdown[latencyComponents[i].name] = latencyStats(h)
+	}
+	return stats
+}
+
+// micros converts seconds into histogram units, clamped to the histogram range
+func micros(seconds float64) int64 {
+	v := int64(seconds * float64(time.Second/time.Microsecond))
+	if v > latencyMax {
+		v = latencyMax
+	}
+	if v < 0 {
+		v = 0
+	}
+	return v
+}
+
+func (l *Latency) group(r *rtl.Record) *latencyGroup {
+	keys := make([]string, len(l.dimensions))
+	for i, d := range l.dimensions {
+		keys[i] = d.Key(r)
+	}
+	var bucket time.Time
+	if l.bucket > 0 {
+		bucket = r.Timestamp.UTC().Truncate(l.bucket)
+	}
+	return l.groupFor(keys, bucket)
+}
+
+func (l *Latency) groupFor(keys []string, bucket time.Time) *latencyGroup {
+	id := strings.Join(keys, "\x00") + "\x00" + bucket.Format(time.RFC3339)
+	g, ok := l.groups[id]
+	if !ok {
+		g = &latencyGroup{keys: keys, bucket: bucket, latencyHistograms: newLatencyHistograms()}
+		l.groups[id] = g
+	}
+	return g
+}
+
+// Merge folds another latency report with the same dimensions and bucket into l.
+// This lets separate inputs be summarized independently and combined afterwards.
+func (l *Latency) Merge(other *Latency) error {
+	if l.bucket != other.bucket || !sameDimensions(l.dimensions, other.dimensions) {
+		return fmt.Errorf("cannot merge latency reports with different groupings")
+	}
+	l.overall.merge(other.overall)
+	for _, og := range other.groups {
+		l.groupFor(og.keys, og.bucket).merge(og.latencyHistograms)
+	}
+	return nil
+}
+
+func sameDimensions(a, b []Dimension) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// Result returns the percentiles overall and per group, busiest groups first
+func (l *Latency) Result() interface{} {
+	res := &LatencyResult{Overall: l.overall.stats()}
+
+	groups := make([]*latencyGroup, 0, len(l.groups))
+	for _, g := range l.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].bucket.Equal(groups[j].bucket) {
+			return groups[i].bucket.Before(groups[j].bucket)
+		}
+		if ci, cj := groups[i].h.TotalCount(), groups[j].h.TotalCount(); ci != cj {
+			return ci > cj
+		}
+		return strings.Join(groups[i].keys, "\x00") < strings.Join(groups[j].keys, "\x00")
+	})
+
+	for _, g := range groups {
+		stats := g.stats()
+		stats.Dimensions = make(map[string]string, len(l.dimensions))
+		for i, d := range l.dimensions {
+			stats.Dimensions[d.Name] = g.keys[i]
+		}
+		if l.bucket > 0 {
+			t := g.bucket
+			stats.Time = &t
+		}
+		res.Groups = append(res.Groups, stats)
+	}
+	return res
+}
+
+func latencyStats(h *hdrhistogram.Histogram) LatencyStats {
+	seconds := func(v int64) float64 {
+		return float64(v) / float64(time.Second/time.Microsecond)
+	}
+	return LatencyStats{
+		Count: h.TotalCount(),
+		Mean:  h.Mean() / float64(time.Second/time.Microsecond),
+		P50:   seconds(h.ValueAtQuantile(50)),
+		P90:   seconds(h.ValueAtQuantile(90)),
+		P99:   seconds(h.ValueAtQuantile(99)),
+		Max:   seconds(h.Max()),
+	}
+}
+
+// Tables returns the time taken percentiles and, when any record carried the
+// latency components, a second table breaking them down per group
+func (l *Latency) Tables() []Table {
+	res := l.Result().(*LatencyResult)
+
+	var keyColumns []string
+	if l.bucket > 0 {
+		keyColumns = append(keyColumns, "time")
+	}
+	for _, d := range l.dimensions {
+		keyColumns = append(keyColumns, d.Name)
+	}
+	statColumns := []string{"count", "mean", "p50", "p90", "p99", "max"}
+
+	table := Table{Title: "Time taken (seconds)", Columns: append(append([]string{}, keyColumns...), statColumns...)}
+	row := func(stats LatencyStats, keys []string) []string {
+		return append(append([]string{}, keys...),
+			strconv.FormatInt(stats.Count, 10),
+			fmt.Sprintf("%.3f", stats.Mean),
+			fmt.Sprintf("%.3f", stats.P50),
+			fmt.Sprintf("%.3f", stats.P90),
+			fmt.Sprintf("%.3f", stats.P99),
+			fmt.Sprintf("%.3f", stats.Max),
+		)
+	}
+
+	overall := make([]string, len(keyColumns))
+	for i := range overall {
+		overall[i] = "(all)"
+	}
+	table.Rows = append(table.Rows, row(res.Overall, overall))
+
+	groupKeys := func(g LatencyStats) []string {
+		var keys []string
+		if g.Time != nil {
+			keys = append(keys, g.Time.Format(time.RFC3339))
+		}
+		for _, d := range l.dimensions {
+			keys = append(keys, g.Dimensions[d.Name])
+		}
+		return keys
+	}
+	for _, g := range res.Groups {
+		table.Rows = append(table.Rows, row(g, groupKeys(g)))
+	}
+
+	if len(res.Overall.Breakdown) == 0 {
+		return []Table{table}
+	}
+
+	breakdown := Table{
+		Title:   "Origin and edge latency (seconds)",
+		Columns: append(append(append([]string{}, keyColumns...), "component"), statColumns...),
+	}
+	components := func(stats LatencyStats, keys []string) {
+		for _, c := range latencyComponents {
+			if cs, ok := stats.Breakdown[c.name]; ok {
+				breakdown.Rows = append(breakdown.Rows, row(cs, append(append([]string{}, keys...), c.name)))
+			}
+		}
+	}
+	components(res.Overall, overall)
+	for _, g := range res.Groups {
+		components(g, groupKeys(g))
+	}
+
+	return []Table{table, breakdown}
+}
@@ -0,0 +1,91 @@
+package report
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+func near(got, want float64) bool {
+	// two significant digits of histogram precision
+	return math.Abs(got-want) <= want*0.01
+}
+
+func TestLatencyBreakdown(t *testing.T) {
+	start := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+	records := []*rtl.Record{
+		// served from the edge cache
+		{Timestamp: start, Host: "a.example.com", TimeTaken: 0.010, TimeToFirstByte: 0.008},
+		// forwarded to a slow origin
+		{Timestamp: start, Host: "a.example.com", TimeTaken: 1.200, TimeToFirstByte: 0.900, OriginFBL: 0.850, OriginLBL: 1.100},
+		// an older log configuration without the fields
+		{Timestamp: start, Host: "b.example.com", TimeTaken: 0.300},
+	}
+
+	// Split across two reports and merged, the way files are summarized
+	l := NewLatency(0)
+	other := NewLatency(0)
+	l.Add(records[0])
+	other.Add(records[1])
+	other.Add(records[2])
+	if err := l.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+
+	res := l.Result().(*LatencyResult)
+	if res.Overall.Count != 3 {
+		t.Errorf("got %d records, want 3", res.Overall.Count)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		count int64
+		max   float64
+	}{
+		{"ttfb", 2, 0.900},
+		{"origin_fbl", 1, 0.850},
+		{"origin_lbl", 1, 1.100},
+		{"edge", 1, 0.100},
+	} {
+		stats, ok := res.Overall.Breakdown[tc.name]
+		if !ok {
+			t.Errorf("%s: missing from the breakdown", tc.name)
+			continue
+		}
+		if stats.Count != tc.count || !near(stats.Max, tc.max) {
+			t.Errorf("%s: got count %d max %.3f, want %d %.3f", tc.name, stats.Count, stats.Max, tc.count, tc.max)
+		}
+	}
+
+	for _, g := range res.Groups {
+		if g.Dimensions["host"] == "b.example.com" && g.Breakdown != nil {
+			t.Errorf("got a breakdown for records without the fields: %+v", g.Breakdown)
+		}
+	}
+
+	tables := l.Tables()
+	if len(tables) != 2 {
+		t.Fatalf("got %d tables, want the breakdown table too", len(tables))
+	}
+	// (all) and a.example.com each have ttfb, origin_fbl, origin_lbl and edge
+	if rows := len(tables[1].Rows); rows != 8 {
+		t.Errorf("got %d breakdown rows, want 8", rows)
+	}
+	if got := tables[1].Columns; got[0] != "host" || got[1] != "component" {
+		t.Errorf("unexpected breakdown columns %v", got)
+	}
+}
+
+func TestLatencyWithoutBreakdown(t *testing.T) {
+	l := NewLatency(time.Hour)
+	l.Add(&rtl.Record{Timestamp: time.Now(), Host: "a.example.com", TimeTaken: 0.2})
+
+	if b := l.Result().(*LatencyResult).Overall.Breakdown; b != nil {
+		t.Errorf("got breakdown %+v", b)
+	}
+	if tables := l.Tables(); len(tables) != 1 || len(tables[0].Rows) != 2 {
+		t.Errorf("got %+v, want the time taken table only", tables)
+	}
+}
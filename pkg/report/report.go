@@ -0,0 +1,129 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Supported output formats
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+)
+
+// Report accumulates records and summarizes them
+type Report interface {
+	// Add folds a single record into the report
+	Add(record *rtl.Record)
+	// Result returns the summary in a form suitable for JSON encoding
+	Result() interface{}
+	// Tables returns the summary as tables for terminal and CSV output
+	Tables() []Table
+}
+
+// Series is implemented by reports whose CSV output is a single,
+// plot-ready time series rather than every table
+type Series interface {
+	Series() Table
+}
+
+// Table is a titled grid of report output
+type Table struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+// Render writes the report to w in the given output format
+func Render(w io.Writer, format string, r Report) error {
+	switch format {
+	case "", OutputTable:
+		return writeTables(w, r.Tables())
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r.Result())
+	case OutputCSV:
+		if s, ok := r.(Series); ok {
+			return writeSeries(w, s.Series())
+		}
+		return writeCSV(w, r.Tables())
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeTables prints each table with aligned columns
+func writeTables(w io.Writer, tables []Table) error {
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\n%s\n", t.Title, strings.Repeat("=", len(t.Title)))
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.Columns, "\t"))
+		for _, row := range t.Rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes every table into a single CSV stream.
+// The first column names the table and a header row is written whenever the columns change.
+func writeCSV(w io.Writer, tables []Table) error {
+	cw := csv.NewWriter(w)
+	var header []string
+	for _, t := range tables {
+		columns := append([]string{"table"}, t.Columns...)
+		if strings.Join(columns, "\x00") != strings.Join(header, "\x00") {
+			if err := cw.Write(columns); err != nil {
+				return err
+			}
+			header = columns
+		}
+		for _, row := range t.Rows {
+			if err := cw.Write(append([]string{t.Title}, row...)); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeSeries writes a single table as plain CSV with its own header
+func writeSeries(w io.Writer, t Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(t.Rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// percent formats part as a percentage of total
+func percent(part, total int64) string {
+	return fmt.Sprintf("%.2f%%", ratio(part, total)*100)
+}
+
+// ratio returns part/total, or 0 when total is 0
+func ratio(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
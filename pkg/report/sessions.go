@@ -0,0 +1,221 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/session"
+)
+
+// durationBuckets are the upper bounds of the session length histogram
+var durationBuckets = []time.Duration{
+	0,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+}
+
+// pageBuckets are the upper bounds of the pages per session histogram
+var pageBuckets = []int{0, 1, 2, 5, 10, 20, 50}
+
+// Sessions reports visitor session lengths and common entry and exit pages
+type Sessions struct {
+	n          int
+	sessionize *session.Config
+	flushed    bool
+
+	count     int64
+	total     time.Duration
+	durations []int64
+	lengths   []time.Duration
+	pages     []int64
+	entries   map[string]int64
+	exits     map[string]int64
+}
+
+// SessionBucket is one bar of a histogram
+type SessionBucket struct {
+	Label    string  `json:"label"`
+	Sessions int64   `json:"sessions"`
+	Share    float64 `json:"share"`
+}
+
+// SessionPage is an entry or exit page
+type SessionPage struct {
+	URI      string  `json:"uri"`
+	Sessions int64   `json:"sessions"`
+	Share    float64 `json:"share"`
+}
+
+// SessionsResult is the JSON form of the sessions report
+type SessionsResult struct {
+	Sessions        int64           `json:"sessions"`
+	MeanDuration    float64         `json:"mean_duration_seconds"`
+	MedianDuration  float64         `json:"median_duration_seconds"`
+	DurationBuckets []SessionBucket `json:"duration_buckets"`
+	PageBuckets     []SessionBucket `json:"page_buckets"`
+	EntryPages      []SessionPage   `json:"entry_pages"`
+	ExitPages       []SessionPage   `json:"exit_pages"`
+}
+
+// NewSessions returns a sessions report listing the top n entry and exit pages.
+// Every completed session is also passed to emit when it is not nil.
+func NewSessions(n int, timeout time.Duration, cookieName string, emit func(s *session.Session)) (*Sessions, error) {
+	s := &Sessions{
+		n:         n,
+		durations: make([]int64, len(durationBuckets)+1),
+		pages:     make([]int64, len(pageBuckets)+1),
+		entries:   make(map[string]int64),
+		exits:     make(map[string]int64),
+	}
+
+	sessionize, err := session.New(
+		session.SetTimeout(timeout),
+		session.SetCookieName(cookieName),
+		session.SetEmit(func(sess *session.Session) {
+			s.collect(sess)
+			if emit != nil {
+				emit(sess)
+			}
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.sessionize = sessionize
+
+	return s, nil
+}
+
+// Add assigns the record to its session
+func (s *Sessions) Add(r *rtl.Record) {
+	s.sessionize.Add(r)
+}
+
+// Flush closes every open session; it is called by Result
+func (s *Sessions) Flush() {
+	if !s.flushed {
+		s.sessionize.Flush()
+		s.flushed = true
+	}
+}
+
+func (s *Sessions) collect(sess *session.Session) {
+	s.count++
+	s.total += sess.Duration
+	s.lengths = append(s.lengths, sess.Duration)
+
+	i := sort.Search(len(durationBuckets), func(i int) bool { return sess.Duration <= durationBuckets[i] })
+	s.durations[i]++
+	j := sort.Search(len(pageBuckets), func(j int) bool { return sess.Pages <= pageBuckets[j] })
+	s.pages[j]++
+
+	s.entries[sess.EntryURI]++
+	s.exits[sess.ExitURI]++
+}
+
+// Result closes open sessions and summarizes them
+func (s *Sessions) Result() interface{} {
+	s.Flush()
+
+	res := &SessionsResult{Sessions: s.count}
+	if s.count > 0 {
+		res.MeanDuration = (s.total / time.Duration(s.count)).Seconds()
+		sort.Slice(s.lengths, func(i, j int) bool { return s.lengths[i] < s.lengths[j] })
+		res.MedianDuration = s.lengths[len(s.lengths)/2].Seconds()
+	}
+
+	for i, n := range s.durations {
+		res.DurationBuckets = append(res.DurationBuckets, SessionBucket{
+			Label:    bucketLabel(i, len(durationBuckets), func(i int) string { return durationBuckets[i].String() }),
+			Sessions: n,
+			Share:    ratio(n, s.count),
+		})
+	}
+	for i, n := range s.pages {
+		res.PageBuckets = append(res.PageBuckets, SessionBucket{
+			Label:    bucketLabel(i, len(pageBuckets), func(i int) string { return strconv.Itoa(pageBuckets[i]) }),
+			Sessions: n,
+			Share:    ratio(n, s.count),
+		})
+	}
+
+	pages := func(counts map[string]int64) []SessionPage {
+		var out []SessionPage
+		for uri, n := range counts {
+			out = append(out, SessionPage{URI: uri, Sessions: n, Share: ratio(n, s.count)})
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Sessions != out[j].Sessions {
+				return out[i].Sessions > out[j].Sessions
+			}
+			return out[i].URI < out[j].URI
+		})
+		if s.n > 0 && len(out) > s.n {
+			out = out[:s.n]
+		}
+		return out
+	}
+	res.EntryPages = pages(s.entries)
+	res.ExitPages = pages(s.exits)
+
+	return res
+}
+
+// bucketLabel describes histogram bucket i of n upper bounds
+func bucketLabel(i, n int, bound func(int) string) string {
+	switch {
+	case i == 0:
+		return "<= " + bound(0)
+	case i == n:
+		return "> " + bound(n-1)
+	default:
+		return fmt.Sprintf("%s - %s", bound(i-1), bound(i))
+	}
+}
+
+// Tables returns the session summary as tables
+func (s *Sessions) Tables() []Table {
+	res := s.Result().(*SessionsResult)
+
+	summary := Table{
+		Title:   "Sessions",
+		Columns: []string{"sessions", "mean duration", "median duration"},
+		Rows: [][]string{{
+			strconv.FormatInt(res.Sessions, 10),
+			(time.Duration(res.MeanDuration * float64(time.Second))).Round(time.Second).String(),
+			(time.Duration(res.MedianDuration * float64(time.Second))).Round(time.Second).String(),
+		}},
+	}
+
+	histogram := func(title, name string, buckets []SessionBucket) Table {
+		t := Table{Title: title, Columns: []string{name, "sessions", "share"}}
+		for _, b := range buckets {
+			t.Rows = append(t.Rows, []string{b.Label, strconv.FormatInt(b.Sessions, 10), fmt.Sprintf("%.2f%%", b.Share*100)})
+		}
+		return t
+	}
+
+	pages := func(title string, entries []SessionPage) Table {
+		t := Table{Title: title, Columns: []string{"uri_stem", "sessions", "share"}}
+		for _, p := range entries {
+			t.Rows = append(t.Rows, []string{p.URI, strconv.FormatInt(p.Sessions, 10), fmt.Sprintf("%.2f%%", p.Share*100)})
+		}
+		return t
+	}
+
+	return []Table{
+		summary,
+		histogram("Session length", "duration", res.DurationBuckets),
+		histogram("Pages per session", "pages", res.PageBuckets),
+		pages("Top entry pages", res.EntryPages),
+		pages("Top exit pages", res.ExitPages),
+	}
+}
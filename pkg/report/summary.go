@@ -0,0 +1,278 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// summaryPoints is the most points an automatically sized series has
+const summaryPoints = 240
+
+// summaryBuckets are the bucket sizes tried, smallest first, when none is set
+var summaryBuckets = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// summaryCounts are the totals behind one point of the summary series
+type summaryCounts struct {
+	status statusCounts
+	cache  cacheStats
+}
+
+func (c *summaryCounts) add(r *rtl.Record) {
+	c.status.add(r.Status)
+	c.cache.add(r)
+}
+
+// countryCounts accumulates requests and the mean location of one country
+type countryCounts struct {
+	tally
+	located   int64
+	latitude  float64
+	longitude float64
+}
+
+// SummaryPoint is one bucket of the summary series
+type SummaryPoint struct {
+	Time     time.Time `json:"time"`
+	Requests int64     `json:"requests"`
+	Bytes    int64     `json:"bytes"`
+	Status2  int64     `json:"status_2xx"`
+	Status3  int64     `json:"status_3xx"`
+	Status4  int64     `json:"status_4xx"`
+	Status5  int64     `json:"status_5xx"`
+	HitRatio float64   `json:"hit_ratio"`
+}
+
+// SummaryCountry is a country's traffic placed at the mean location of its clients
+type SummaryCountry struct {
+	Country   string  `json:"country"`
+	Requests  int64   `json:"requests"`
+	Bytes     int64   `json:"bytes"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// SummaryResult is the JSON form of the summary report
+type SummaryResult struct {
+	Bucket    string           `json:"bucket"`
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Requests  int64            `json:"requests"`
+	Bytes     int64            `json:"bytes"`
+	Status    ErrorGroup       `json:"status"`
+	Cache     CacheRatios      `json:"cache"`
+	Series    []SummaryPoint   `json:"series"`
+	Countries []SummaryCountry `json:"countries"`
+	TopURIs   []TopEntry       `json:"top_uris"`
+}
+
+// Summary is an overview of traffic: volume over time, status mix,
+// cache hit ratio, countries and the busiest URIs
+type Summary struct {
+	n         int
+	bucket    time.Duration
+	base      time.Duration
+	overall   summaryCounts
+	series    map[time.Time]*summaryCounts
+	countries map[string]*countryCounts
+	top       *Top
+}
+
+// NewSummary returns a summary report listing n countries and URIs.
+// A zero bucket picks the smallest bucket that keeps the series short enough to plot.
+func NewSummary(n int, bucket time.Duration) *Summary {
+	base := bucket
+	if base <= 0 {
+		base = summaryBuckets[0]
+	}
+	return &Summary{
+		n:         n,
+		bucket:    bucket,
+		base:      base,
+		series:    make(map[time.Time]*summaryCounts),
+		countries: make(map[string]*countryCounts),
+		top:       NewTop(n, dimensions["uri_stem"]),
+	}
+}
+
+// Add counts the record
+func (s *Summary) Add(r *rtl.Record) {
+	s.overall.add(r)
+	s.top.Add(r)
+
+	t := r.Timestamp.UTC().Truncate(s.base)
+	p, ok := s.series[t]
+	if !ok {
+		p = &summaryCounts{}
+		s.series[t] = p
+	}
+	p.add(r)
+
+	country := geoCountry(r)
+	c, ok := s.countries[country]
+	if !ok {
+		c = &countryCounts{}
+		s.countries[country] = c
+	}
+	c.add(r)
+	if r.ClientIP != nil && (r.ClientIP.Latitude != 0 || r.ClientIP.Longitude != 0) {
+		c.located++
+		c.latitude += r.ClientIP.Latitude
+		c.longitude += r.ClientIP.Longitude
+	}
+}
+
+// Result returns the overview
+func (s *Summary) Result() interface{} {
+	res := &SummaryResult{
+		Requests: s.overall.cache.Requests,
+		Bytes:    s.overall.cache.Bytes,
+		Status:   ErrorGroup{statusCounts: s.overall.status, ErrorRate: s.overall.status.errorRate()},
+		Cache:    s.overall.cache.ratios(""),
+	}
+
+	times := make([]time.Time, 0, len(s.series))
+	for t := range s.series {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	bucket := s.bucket
+	if len(times) > 0 {
+		res.From = times[0]
+		res.To = times[len(times)-1].Add(s.base)
+		if bucket <= 0 {
+			bucket = s.autoBucket(res.To.Sub(res.From))
+		}
+	}
+	if bucket <= 0 {
+		bucket = s.base
+	}
+	res.Bucket = bucket.String()
+
+	// Fold the base buckets into the output buckets
+	for _, t := range times {
+		p := s.series[t]
+		t = t.Truncate(bucket)
+		if n := len(res.Series); n == 0 || !res.Series[n-1].Time.Equal(t) {
+			res.Series = append(res.Series, SummaryPoint{Time: t})
+		}
+		point := &res.Series[len(res.Series)-1]
+		point.Requests += p.cache.Requests
+		point.Bytes += p.cache.Bytes
+		point.Status2 += p.status.Status2
+		point.Status3 += p.status.Status3
+		point.Status4 += p.status.Status4
+		point.Status5 += p.status.Status5
+		// hits are summed here and divided below
+		point.HitRatio += float64(p.cache.Hits + p.cache.RefreshHits)
+	}
+	for i := range res.Series {
+		if res.Series[i].Requests > 0 {
+			res.Series[i].HitRatio /= float64(res.Series[i].Requests)
+		}
+	}
+
+	for country, c := range s.countries {
+		entry := SummaryCountry{Country: country, Requests: c.Requests, Bytes: c.Bytes}
+		if c.located > 0 {
+			entry.Latitude = c.latitude / float64(c.located)
+			entry.Longitude = c.longitude / float64(c.located)
+		}
+		res.Countries = append(res.Countries, entry)
+	}
+	sort.Slice(res.Countries, func(i, j int) bool {
+		if res.Countries[i].Requests != res.Countries[j].Requests {
+			return res.Countries[i].Requests > res.Countries[j].Requests
+		}
+		return res.Countries[i].Country < res.Countries[j].Country
+	})
+	if s.n > 0 && len(res.Countries) > s.n {
+		res.Countries = res.Countries[:s.n]
+	}
+
+	uris := s.top.counts[0]
+	res.TopURIs = s.top.entries(uris, uris.top(s.n, byRequests))
+
+	return res
+}
+
+// autoBucket returns the smallest bucket that splits span into at most summaryPoints
+func (s *Summary) autoBucket(span time.Duration) time.Duration {
+	for _, b := range summaryBuckets {
+		if b >= s.base && span/b <= summaryPoints {
+			return b
+		}
+	}
+	return summaryBuckets[len(summaryBuckets)-1]
+}
+
+// Tables returns the totals, the series, the countries and the top URIs
+func (s *Summary) Tables() []Table {
+	res := s.Result().(*SummaryResult)
+
+	totals := Table{
+		Title:   "Summary",
+		Columns: []string{"requests", "bytes", "2xx", "3xx", "4xx", "5xx", "error rate", "cache hit ratio"},
+		Rows: [][]string{{
+			strconv.FormatInt(res.Requests, 10),
+			strconv.FormatInt(res.Bytes, 10),
+			strconv.FormatInt(res.Status.Status2, 10),
+			strconv.FormatInt(res.Status.Status3, 10),
+			strconv.FormatInt(res.Status.Status4, 10),
+			strconv.FormatInt(res.Status.Status5, 10),
+			fmt.Sprintf("%.2f%%", res.Status.ErrorRate*100),
+			fmt.Sprintf("%.2f%%", (res.Cache.HitRatio+res.Cache.RefreshHitRatio)*100),
+		}},
+	}
+
+	series := Table{
+		Title:   fmt.Sprintf("Requests per %s", res.Bucket),
+		Columns: []string{"time", "requests", "bytes", "2xx", "3xx", "4xx", "5xx", "hit ratio"},
+	}
+	for _, p := range res.Series {
+		series.Rows = append(series.Rows, []string{
+			p.Time.Format(time.RFC3339),
+			strconv.FormatInt(p.Requests, 10),
+			strconv.FormatInt(p.Bytes, 10),
+			strconv.FormatInt(p.Status2, 10),
+			strconv.FormatInt(p.Status3, 10),
+			strconv.FormatInt(p.Status4, 10),
+			strconv.FormatInt(p.Status5, 10),
+			fmt.Sprintf("%.2f%%", p.HitRatio*100),
+		})
+	}
+
+	countries := Table{
+		Title:   "Top countries",
+		Columns: []string{"country", "requests", "requests %", "latitude", "longitude"},
+	}
+	for _, c := range res.Countries {
+		key := c.Country
+		if key == "" {
+			key = "(none)"
+		}
+		countries.Rows = append(countries.Rows, []string{
+			key,
+			strconv.FormatInt(c.Requests, 10),
+			percent(c.Requests, res.Requests),
+			strconv.FormatFloat(c.Latitude, 'f', 2, 64),
+			strconv.FormatFloat(c.Longitude, 'f', 2, 64),
+		})
+	}
+
+	uris := s.top.table("Top URIs", "uri_stem", res.TopURIs)
+
+	return []Table{totals, series, countries, uris}
+}
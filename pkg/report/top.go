@@ -0,0 +1,180 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// TopDimensions are the dimensions ranked by the top report
+var TopDimensions = []Dimension{
+	dimensions["uri_stem"],
+	dimensions["client_ip"],
+	dimensions["referer"],
+	dimensions["browser"],
+	dimensions["country"],
+	dimensions["edge_location"],
+}
+
+// tally counts requests and bytes for a key
+type tally struct {
+	Requests int64
+	Bytes    int64
+}
+
+func (t *tally) add(r *rtl.Record) {
+	t.Requests++
+	t.Bytes += r.Bytes
+}
+
+// tallies counts requests and bytes per key
+type tallies map[string]*tally
+
+func (t tallies) add(key string, r *rtl.Record) {
+	c, ok := t[key]
+	if !ok {
+		c = &tally{}
+		t[key] = c
+	}
+	c.add(r)
+}
+
+// top returns the n keys with the highest value, ties broken by key
+func (t tallies) top(n int, value func(*tally) int64) []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		vi, vj := value(t[keys[i]]), value(t[keys[j]])
+		if vi != vj {
+			return vi > vj
+		}
+		return keys[i] < keys[j]
+	})
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func byRequests(t *tally) int64 { return t.Requests }
+func byBytes(t *tally) int64    { return t.Bytes }
+
+// Top ranks the busiest values of each dimension by requests and by bytes
+type Top struct {
+	n          int
+	dimensions []Dimension
+	total      tally
+	counts     []tallies
+}
+
+// TopEntry is a single ranked value
+type TopEntry struct {
+	Key           string  `json:"key"`
+	Requests      int64   `json:"requests"`
+	Bytes         int64   `json:"bytes"`
+	RequestsShare float64 `json:"requests_share"`
+	BytesShare    float64 `json:"bytes_share"`
+}
+
+// TopDimension holds the rankings for one dimension
+type TopDimension struct {
+	Name       string     `json:"name"`
+	ByRequests []TopEntry `json:"by_requests"`
+	ByBytes    []TopEntry `json:"by_bytes"`
+}
+
+// TopResult is the JSON form of the top report
+type TopResult struct {
+	Requests   int64          `json:"requests"`
+	Bytes      int64          `json:"bytes"`
+	Dimensions []TopDimension `json:"dimensions"`
+}
+
+// NewTop returns a top-n report over the given dimensions (TopDimensions if none)
+func NewTop(n int, dimensions ...Dimension) *Top {
+	if len(dimensions) == 0 {
+		dimensions = TopDimensions
+	}
+	counts := make([]tallies, len(dimensions))
+	for i := range counts {
+		counts[i] = tallies{}
+	}
+	return &Top{n: n, dimensions: dimensions, counts: counts}
+}
+
+// Add counts the record against every dimension
+func (t *Top) Add(r *rtl.Record) {
+	t.total.add(r)
+	for i, d := range t.dimensions {
+		t.counts[i].add(d.Key(r), r)
+	}
+}
+
+// Result returns the rankings
+func (t *Top) Result() interface{} {
+	res := &TopResult{
+		Requests: t.total.Requests,
+		Bytes:    t.total.Bytes,
+	}
+	for i, d := range t.dimensions {
+		res.Dimensions = append(res.Dimensions, TopDimension{
+			Name:       d.Name,
+			ByRequests: t.entries(t.counts[i], t.counts[i].top(t.n, byRequests)),
+			ByBytes:    t.entries(t.counts[i], t.counts[i].top(t.n, byBytes)),
+		})
+	}
+	return res
+}
+
+func (t *Top) entries(counts tallies, keys []string) []TopEntry {
+	entries := make([]TopEntry, 0, len(keys))
+	for _, k := range keys {
+		c := counts[k]
+		entries = append(entries, TopEntry{
+			Key:           k,
+			Requests:      c.Requests,
+			Bytes:         c.Bytes,
+			RequestsShare: ratio(c.Requests, t.total.Requests),
+			BytesShare:    ratio(c.Bytes, t.total.Bytes),
+		})
+	}
+	return entries
+}
+
+// Tables returns two tables per dimension, ranked by requests and by bytes
+func (t *Top) Tables() []Table {
+	res := t.Result().(*TopResult)
+	var tables []Table
+	for _, d := range res.Dimensions {
+		tables = append(tables,
+			t.table(fmt.Sprintf("Top %s by requests", d.Name), d.Name, d.ByRequests),
+			t.table(fmt.Sprintf("Top %s by bytes", d.Name), d.Name, d.ByBytes),
+		)
+	}
+	return tables
+}
+
+func (t *Top) table(title, name string, entries []TopEntry) Table {
+	table := Table{
+		Title:   title,
+		Columns: []string{name, "requests", "requests %", "bytes", "bytes %"},
+	}
+	for _, e := range entries {
+		key := e.Key
+		if key == "" {
+			key = "(none)"
+		}
+		table.Rows = append(table.Rows, []string{
+			key,
+			strconv.FormatInt(e.Requests, 10),
+			percent(e.Requests, t.total.Requests),
+			strconv.FormatInt(e.Bytes, 10),
+			percent(e.Bytes, t.total.Bytes),
+		})
+	}
+	return table
+}
@@ -0,0 +1,341 @@
+package rtl
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+)
+
+// Flat is a Record with the GeoIP and user agent data flattened into
+// top-level columns, for tabular outputs such as CSV and Parquet.
+type Flat struct {
+	Timestamp                time.Time `json:"timestamp" parquet:"timestamp,timestamp(millisecond)"`
+	ClientIPAddr             string    `json:"client_ip_addr" parquet:"client_ip_addr,dict"`
+	Status                   int       `json:"status" parquet:"status"`
+	Bytes                    int64     `json:"bytes" parquet:"bytes"`
+	Method                   string    `json:"method" parquet:"method,dict"`
+	Protocol                 string    `json:"protocol" parquet:"protocol,dict"`
+	Host                     string    `json:"host" parquet:"host,dict"`
+	UriStem                  string    `json:"uri_stem" parquet:"uri_stem"`
+	EdgeLocation             string    `json:"edge_location" parquet:"edge_location,dict"`
+	EdgeRequestID            string    `json:"edge_request_id" parquet:"edge_request_id"`
+	HostHeader               string    `json:"host_header" parquet:"host_header,dict"`
+	TimeTaken                float64   `json:"time_taken" parquet:"time_taken"`
+	ProtoVersion             string    `json:"proto_version" parquet:"proto_version,dict"`
+	IPVersion                string    `json:"ip_version" parquet:"ip_version,dict"`
+	Referer                  string    `json:"referer" parquet:"referer"`
+	Cookie                   string    `json:"cookie" parquet:"cookie"`
+	UriQuery                 string    `json:"uri_query" parquet:"uri_query"`
+	EdgeResponseResultType   string    `json:"edge_response_result_type" parquet:"edge_response_result_type,dict"`
+	SslProtocol              string    `json:"ssl_protocol" parquet:"ssl_protocol,dict"`
+	SslCipher                string    `json:"ssl_cipher" parquet:"ssl_cipher,dict"`
+	EdgeResultType           string    `json:"edge_result_type" parquet:"edge_result_type,dict"`
+	ContentType              string    `json:"content_type" parquet:"content_type,dict"`
+	ContentLength            int64     `json:"content_length" parquet:"content_length"`
+	EdgeDetailedResultType   string    `json:"edge_detailed_result_type" parquet:"edge_detailed_result_type,dict"`
+	Country                  string    `json:"country" parquet:"country,dict"`
+	CacheBehaviorPathPattern string    `json:"cache_behavior_path_pattern" parquet:"cache_behavior_path_pattern,dict"`
+	Year                     int       `json:"year" parquet:"year"`
+	Month                    int       `json:"month" parquet:"month"`
+	Day                      int       `json:"day" parquet:"day"`
+	TimeToFirstByte          float64   `json:"time_to_first_byte" parquet:"time_to_first_byte"`
+	OriginFBL                float64   `json:"origin_fbl" parquet:"origin_fbl"`
+	OriginLBL                float64   `json:"origin_lbl" parquet:"origin_lbl"`
+	ClientPort               int       `json:"client_port" parquet:"client_port"`
+	ASN                      int64     `json:"asn" parquet:"asn"`
+	RangeStart               int64     `json:"range_start" parquet:"range_start"`
+	RangeEnd                 int64     `json:"range_end" parquet:"range_end"`
+	AcceptEncoding           string    `json:"accept_encoding" parquet:"accept_encoding,dict"`
+	Accept                   string    `json:"accept" parquet:"accept,dict"`
+	HeadersCount             int       `json:"headers_count" parquet:"headers_count"`
+
+	GeoCity        string  `json:"geo_city_name" parquet:"geo_city_name,dict"`
+	GeoContinent   string  `json:"geo_continent_code" parquet:"geo_continent_code,dict"`
+	GeoCountry     string  `json:"geo_country_code" parquet:"geo_country_code,dict"`
+	GeoLatitude    float64 `json:"geo_latitude" parquet:"geo_latitude"`
+	GeoLongitude   float64 `json:"geo_longitude" parquet:"geo_longitude"`
+	GeoMetroCode   uint    `json:"geo_metro_code" parquet:"geo_metro_code"`
+	GeoTimeZone    string  `json:"geo_time_zone" parquet:"geo_time_zone,dict"`
+	GeoPostalCode  string  `json:"geo_postal_code" parquet:"geo_postal_code,dict"`
+	GeoSubdivision string  `json:"geo_subdivision_code" parquet:"geo_subdivision_code,dict"`
+
+	GeoASN               uint   `json:"geo_asn" parquet:"geo_asn"`
+	GeoASNOrg            string `json:"geo_asn_org" parquet:"geo_asn_org,dict"`
+	GeoISP               string `json:"geo_isp" parquet:"geo_isp,dict"`
+	GeoIsHostingProvider bool   `json:"geo_is_hosting_provider" parquet:"geo_is_hosting_provider"`
+	GeoIsTorExit         bool   `json:"geo_is_tor_exit" parquet:"geo_is_tor_exit"`
+	GeoIsVPN             bool   `json:"geo_is_vpn" parquet:"geo_is_vpn"`
+	GeoConnectionType    string `json:"geo_connection_type" parquet:"geo_connection_type,dict"`
+
+	UARaw                  string `json:"ua_raw" parquet:"ua_raw,dict"`
+	UABrowserEngine        string `json:"ua_browser_engine" parquet:"ua_browser_engine,dict"`
+	UABrowserEngineVersion string `json:"ua_browser_engine_version" parquet:"ua_browser_engine_version,dict"`
+	UABrowserName          string `json:"ua_browser_name" parquet:"ua_browser_name,dict"`
+	UABrowserVersion       string `json:"ua_browser_version" parquet:"ua_browser_version,dict"`
+	UAMozilla              string `json:"ua_mozilla" parquet:"ua_mozilla,dict"`
+	UAPlatform             string `json:"ua_platform" parquet:"ua_platform,dict"`
+	UAOS                   string `json:"ua_os" parquet:"ua_os,dict" gorm:"column:ua_os"`
+	UALocalization         string `json:"ua_localization" parquet:"ua_localization,dict"`
+	UABot                  bool   `json:"ua_bot" parquet:"ua_bot"`
+	UABotName              string `json:"ua_bot_name" parquet:"ua_bot_name,dict"`
+	UABotCategory          string `json:"ua_bot_category" parquet:"ua_bot_category,dict"`
+	UAMobile               bool   `json:"ua_mobile" parquet:"ua_mobile"`
+}
+
+// FlatColumns lists the column names of Flat in field order
+var FlatColumns = []string{
+	"timestamp", "client_ip_addr", "status", "bytes", "method", "protocol", "host",
+	"uri_stem", "edge_location", "edge_request_id", "host_header", "time_taken",
+	"proto_version", "ip_version", "referer", "cookie", "uri_query",
+	"edge_response_result_type", "ssl_protocol", "ssl_cipher", "edge_result_type",
+	"content_type", "content_length", "edge_detailed_result_type", "country",
+	"cache_behavior_path_pattern", "year", "month", "day",
+	"time_to_first_byte", "origin_fbl", "origin_lbl", "client_port", "asn",
+	"range_start", "range_end", "accept_encoding", "accept", "headers_count",
+	"geo_city_name", "geo_continent_code", "geo_country_code", "geo_latitude",
+	"geo_longitude", "geo_metro_code", "geo_time_zone", "geo_postal_code",
+	"geo_subdivision_code",
+	"geo_asn", "geo_asn_org", "geo_isp", "geo_is_hosting_provider", "geo_is_tor_exit",
+	"geo_is_vpn", "geo_connection_type",
+	"ua_raw", "ua_browser_engine", "ua_browser_engine_version", "ua_browser_name",
+	"ua_browser_version", "ua_mozilla", "ua_platform", "ua_os", "ua_localization",
+	"ua_bot", "ua_bot_name", "ua_bot_category", "ua_mobile",
+}
+
+// Flatten returns the flattened form of the record
+func (r *Record) Flatten() *Flat {
+	f := &Flat{
+		Timestamp:                r.Timestamp.UTC(),
+		ClientIPAddr:             r.ClientIPAddr,
+		Status:                   r.Status,
+		Bytes:                    r.Bytes,
+		Method:                   r.Method,
+		Protocol:                 r.Protocol,
+		Host:                     r.Host,
+		UriStem:                  r.UriStem,
+		EdgeLocation:             r.EdgeLocation,
+		EdgeRequestID:            r.EdgeRequestID,
+		HostHeader:               r.HostHeader,
+		TimeTaken:                r.TimeTaken,
+		ProtoVersion:             r.ProtoVersion,
+		IPVersion:                r.IPVersion,
+		Referer:                  r.Referer,
+		Cookie:                   r.Cookie,
+		UriQuery:                 r.UriQuery,
+		EdgeResponseResultType:   r.EdgeResponseResultType,
+		SslProtocol:              r.SslProtocol,
+		SslCipher:                r.SslCipher,
+		EdgeResultType:           r.EdgeResultType,
+		ContentType:              r.ContentType,
+		ContentLength:            r.ContentLength,
+		EdgeDetailedResultType:   r.EdgeDetailedResultType,
+		Country:                  r.Country,
+		CacheBehaviorPathPattern: r.CacheBehaviorPathPattern,
+		Year:                     r.Year,
+		Month:                    r.Month,
+		Day:                      r.Day,
+		TimeToFirstByte:          r.TimeToFirstByte,
+		OriginFBL:                r.OriginFBL,
+		OriginLBL:                r.OriginLBL,
+		ClientPort:               r.ClientPort,
+		ASN:                      r.ASN,
+		RangeStart:               r.RangeStart,
+		RangeEnd:                 r.RangeEnd,
+		AcceptEncoding:           r.AcceptEncoding,
+		Accept:                   r.Accept,
+		HeadersCount:             r.HeadersCount,
+	}
+
+	if g := r.ClientIP; g != nil {
+		f.GeoCity = g.City
+		f.GeoContinent = g.Continent
+		f.GeoCountry = g.Country
+		f.GeoLatitude = g.Latitude
+		f.GeoLongitude = g.Longitude
+		f.GeoMetroCode = g.MetroCode
+		f.GeoTimeZone = g.TimeZone
+		f.GeoPostalCode = g.PostalCode
+		f.GeoSubdivision = g.Subdivision
+		f.GeoASN = g.ASN
+		f.GeoASNOrg = g.ASNOrg
+		f.GeoISP = g.ISP
+		f.GeoIsHostingProvider = g.IsHostingProvider
+		f.GeoIsTorExit = g.IsTorExit
+		f.GeoIsVPN = g.IsVPN
+		f.GeoConnectionType = g.ConnectionType
+	}
+
+	if ua := r.UserAgent; ua != nil {
+		f.UARaw = ua.Raw
+		f.UABrowserEngine = ua.BrowserEngine
+		f.UABrowserEngineVersion = ua.BrowserEngineVersion
+		f.UABrowserName = ua.BrowserName
+		f.UABrowserVersion = ua.BrowserVersion
+		f.UAMozilla = ua.Mozilla
+		f.UAPlatform = ua.Platform
+		f.UAOS = ua.OS
+		f.UALocalization = ua.Localization
+		f.UABot = ua.Bot
+		f.UABotName = ua.BotName
+		f.UABotCategory = ua.BotCategory
+		f.UAMobile = ua.Mobile
+	}
+
+	return f
+}
+
+// Strings returns the column values of f as strings, in FlatColumns order
+func (f *Flat) Strings() []string {
+	return []string{
+		f.Timestamp.Format(time.RFC3339Nano),
+		f.ClientIPAddr,
+		strconv.Itoa(f.Status),
+		strconv.FormatInt(f.Bytes, 10),
+		f.Method,
+		f.Protocol,
+		f.Host,
+		f.UriStem,
+		f.EdgeLocation,
+		f.EdgeRequestID,
+		f.HostHeader,
+		strconv.FormatFloat(f.TimeTaken, 'f', -1, 64),
+		f.ProtoVersion,
+		f.IPVersion,
+		f.Referer,
+		f.Cookie,
+		f.UriQuery,
+		f.EdgeResponseResultType,
+		f.SslProtocol,
+		f.SslCipher,
+		f.EdgeResultType,
+		f.ContentType,
+		strconv.FormatInt(f.ContentLength, 10),
+		f.EdgeDetailedResultType,
+		f.Country,
+		f.CacheBehaviorPathPattern,
+		strconv.Itoa(f.Year),
+		strconv.Itoa(f.Month),
+		strconv.Itoa(f.Day),
+		strconv.FormatFloat(f.TimeToFirstByte, 'f', -1, 64),
+		strconv.FormatFloat(f.OriginFBL, 'f', -1, 64),
+		strconv.FormatFloat(f.OriginLBL, 'f', -1, 64),
+		strconv.Itoa(f.ClientPort),
+		strconv.FormatInt(f.ASN, 10),
+		strconv.FormatInt(f.RangeStart, 10),
+		strconv.FormatInt(f.RangeEnd, 10),
+		f.AcceptEncoding,
+		f.Accept,
+		strconv.Itoa(f.HeadersCount),
+		f.GeoCity,
+		f.GeoContinent,
+		f.GeoCountry,
+		strconv.FormatFloat(f.GeoLatitude, 'f', -1, 64),
+		strconv.FormatFloat(f.GeoLongitude, 'f', -1, 64),
+		strconv.FormatUint(uint64(f.GeoMetroCode), 10),
+		f.GeoTimeZone,
+		f.GeoPostalCode,
+		f.GeoSubdivision,
+		strconv.FormatUint(uint64(f.GeoASN), 10),
+		f.GeoASNOrg,
+		f.GeoISP,
+		strconv.FormatBool(f.GeoIsHostingProvider),
+		strconv.FormatBool(f.GeoIsTorExit),
+		strconv.FormatBool(f.GeoIsVPN),
+		f.GeoConnectionType,
+		f.UARaw,
+		f.UABrowserEngine,
+		f.UABrowserEngineVersion,
+		f.UABrowserName,
+		f.UABrowserVersion,
+		f.UAMozilla,
+		f.UAPlatform,
+		f.UAOS,
+		f.UALocalization,
+		strconv.FormatBool(f.UABot),
+		f.UABotName,
+		f.UABotCategory,
+		strconv.FormatBool(f.UAMobile),
+	}
+}
+
+// Record rebuilds a Record from its flattened form
+func (f *Flat) Record() *Record {
+	return &Record{
+		Timestamp:                f.Timestamp,
+		ClientIPAddr:             f.ClientIPAddr,
+		Status:                   f.Status,
+		Bytes:                    f.Bytes,
+		Method:                   f.Method,
+		Protocol:                 f.Protocol,
+		Host:                     f.Host,
+		UriStem:                  f.UriStem,
+		EdgeLocation:             f.EdgeLocation,
+		EdgeRequestID:            f.EdgeRequestID,
+		HostHeader:               f.HostHeader,
+		TimeTaken:                f.TimeTaken,
+		ProtoVersion:             f.ProtoVersion,
+		IPVersion:                f.IPVersion,
+		Referer:                  f.Referer,
+		Cookie:                   f.Cookie,
+		UriQuery:                 f.UriQuery,
+		EdgeResponseResultType:   f.EdgeResponseResultType,
+		SslProtocol:              f.SslProtocol,
+		SslCipher:                f.SslCipher,
+		EdgeResultType:           f.EdgeResultType,
+		ContentType:              f.ContentType,
+		ContentLength:            f.ContentLength,
+		EdgeDetailedResultType:   f.EdgeDetailedResultType,
+		Country:                  f.Country,
+		CacheBehaviorPathPattern: f.CacheBehaviorPathPattern,
+		Year:                     f.Year,
+		Month:                    f.Month,
+		Day:                      f.Day,
+		TimeToFirstByte:          f.TimeToFirstByte,
+		OriginFBL:                f.OriginFBL,
+		OriginLBL:                f.OriginLBL,
+		ClientPort:               f.ClientPort,
+		ASN:                      f.ASN,
+		RangeStart:               f.RangeStart,
+		RangeEnd:                 f.RangeEnd,
+		AcceptEncoding:           f.AcceptEncoding,
+		Accept:                   f.Accept,
+		HeadersCount:             f.HeadersCount,
+		ClientIP: &geoip.GeoIPData{
+			IP:                net.ParseIP(f.ClientIPAddr),
+			City:              f.GeoCity,
+			Continent:         f.GeoContinent,
+			Country:           f.GeoCountry,
+			Latitude:          f.GeoLatitude,
+			Longitude:         f.GeoLongitude,
+			MetroCode:         f.GeoMetroCode,
+			TimeZone:          f.GeoTimeZone,
+			PostalCode:        f.GeoPostalCode,
+			Subdivision:       f.GeoSubdivision,
+			ASN:               f.GeoASN,
+			ASNOrg:            f.GeoASNOrg,
+			ISP:               f.GeoISP,
+			IsHostingProvider: f.GeoIsHostingProvider,
+			IsTorExit:         f.GeoIsTorExit,
+			IsVPN:             f.GeoIsVPN,
+			ConnectionType:    f.GeoConnectionType,
+		},
+		UserAgent: &useragent.Record{
+			Raw:                  f.UARaw,
+			BrowserEngine:        f.UABrowserEngine,
+			BrowserEngineVersion: f.UABrowserEngineVersion,
+			BrowserName:          f.UABrowserName,
+			BrowserVersion:       f.UABrowserVersion,
+			Mozilla:              f.UAMozilla,
+			Platform:             f.UAPlatform,
+			OS:                   f.UAOS,
+			Localization:         f.UALocalization,
+			Bot:                  f.UABot,
+			BotName:              f.UABotName,
+			BotCategory:          f.UABotCategory,
+			Mobile:               f.UAMobile,
+		},
+	}
+}
@@ -38,6 +38,20 @@ type Record struct {
 	Year                     int               `json:"year"`
 	Month                    int               `json:"month"`
 	Day                      int               `json:"day"`
+	TimeToFirstByte          float64           `json:"time_to_first_byte,omitempty"`
+	OriginFBL                float64           `json:"origin_fbl,omitempty"`
+	OriginLBL                float64           `json:"origin_lbl,omitempty"`
+	ClientPort               int               `json:"client_port,omitempty"`
+	ASN                      int64             `json:"asn,omitempty"`
+	RangeStart               int64             `json:"range_start,omitempty"`
+	RangeEnd                 int64             `json:"range_end,omitempty"`
+	AcceptEncoding           string            `json:"accept_encoding,omitempty"`
+	Accept                   string            `json:"accept,omitempty"`
+	HeadersCount             int               `json:"headers_count,omitempty"`
 	ClientIP                 *geoip.GeoIPData  `json:"geoip_data"`     //gorm:"embedded"
 	UserAgent                *useragent.Record `json:"useragent_data"` //gorm:"embedded"
+
+	// Extra holds mapped log fields without a field of their own, by column.
+	// Tabular outputs and the databases do not keep them.
+	Extra map[string]string `json:"extra,omitempty"`
 }
@@ -0,0 +1,284 @@
+// Package rtlfile reads CloudFront real-time log files, the tab separated
+// records Kinesis Data Firehose delivers to S3 before Glue and Trino see them.
+package rtlfile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+)
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// file source configs
+type Config struct {
+	paths []string
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if len(config.paths) == 0 {
+		return nil, fmt.Errorf("at least one path is required")
+	}
+
+	return config, nil
+}
+
+// SetPaths sets the log files to read. Directories are read recursively.
+func SetPaths(paths ...string) Option {
+	return func(c *Config) {
+		c.paths = paths
+	}
+}
+
+// Rows returns the entries in the files matching query. The query's mapping
+// gives the field order of the real-time log configuration that wrote the
+// files. Files are read in path order each time Rows is called.
+func (c *Config) Rows(ctx context.Context, query *fetch.Query) (fetch.Rows, error) {
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := query.Mapping
+	if mapping == nil {
+		mapping = fetch.DefaultMapping
+	}
+
+	return &rows{
+		ctx:     ctx,
+		query:   query,
+		files:   files,
+		mapping: mapping,
+	}, nil
+}
+
+// Close releases the source; files are only open while rows are read
+func (c *Config) Close() error {
+	return nil
+}
+
+// files expands the configured paths into a sorted list of files,
+// skipping hidden files such as in-progress downloads
+func (c *Config) files() ([]string, error) {
+	var files []string
+	for _, path := range c.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != path && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// rows reads entries line by line across the files
+type rows struct {
+	ctx     context.Context
+	query   *fetch.Query
+	files   []string
+	mapping *fetch.Mapping
+
+	path    string
+	line    int
+	file    *os.File
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+
+	entry fetch.Entry
+	count int
+	err   error
+}
+
+// Next advances to the next matching entry
+func (r *rows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.query.Limit > 0 && r.count >= r.query.Limit {
+		r.closeFile()
+		return false
+	}
+
+	for {
+		if err := r.ctx.Err(); err != nil {
+			r.err = err
+			return false
+		}
+
+		if r.scanner == nil {
+			if len(r.files) == 0 {
+				return false
+			}
+			if err := r.open(r.files[0]); err != nil {
+				r.err = err
+				return false
+			}
+			r.files = r.files[1:]
+		}
+
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				r.err = fmt.Errorf("%s: %w", r.path, err)
+				return false
+			}
+			if err := r.closeFile(); err != nil {
+				r.err = fmt.Errorf("%s: %w", r.path, err)
+				return false
+			}
+			continue
+		}
+		r.line++
+
+		line := strings.TrimRight(r.scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if err := r.parse(line); err != nil {
+			r.err = fmt.Errorf("%s:%d: %w", r.path, r.line, err)
+			return false
+		}
+
+		ok, err := r.query.Match(&r.entry)
+		if err != nil {
+			r.err = fmt.Errorf("%s:%d: %w", r.path, r.line, err)
+			return false
+		}
+		if ok {
+			r.count++
+			return true
+		}
+	}
+}
+
+// StructScan copies the current entry into dest, which must be an *fetch.Entry
+func (r *rows) StructScan(dest interface{}) error {
+	entry, ok := dest.(*fetch.Entry)
+	if !ok {
+		return fmt.Errorf("cannot scan into %T", dest)
+	}
+	*entry = r.entry
+	return nil
+}
+
+// Err returns the error that stopped the iteration, if any
+func (r *rows) Err() error {
+	return r.err
+}
+
+// Close closes the file being read
+func (r *rows) Close() error {
+	r.files = nil
+	return r.closeFile()
+}
+
+// open starts reading a file, decompressing it when it is gzipped.
+// Firehose names compressed objects without an extension, so the content is checked.
+func (r *rows) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	var gz *gzip.Reader
+	var in io.Reader = bufio.NewReader(f)
+	if magic, _ := in.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err = gzip.NewReader(in)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		in = gz
+	}
+
+	r.path = path
+	r.line = 0
+	r.file = f
+	r.gz = gz
+	r.scanner = bufio.NewScanner(in)
+	r.scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return nil
+}
+
+// closeFile closes the file being read. A gzip stream that did not end
+// with a valid trailer is reported.
+func (r *rows) closeFile() error {
+	var err error
+	if r.gz != nil {
+		err = r.gz.Close()
+	}
+	if r.file != nil {
+		if cerr := r.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	r.file = nil
+	r.gz = nil
+	r.scanner = nil
+	return err
+}
+
+// parse fills the current entry from a log line
+func (r *rows) parse(line string) error {
+	r.entry = fetch.Entry{}
+	if err := r.mapping.Parse(&r.entry, strings.Split(line, "\t")); err != nil {
+		return err
+	}
+
+	// The partition columns come from the S3 prefix in Glue; derive them instead
+	if r.entry.Year == "" {
+		ms, err := fetch.Millis(r.entry.Timestamp)
+		if err != nil {
+			return err
+		}
+		t := time.UnixMilli(ms).UTC()
+		r.entry.Year = strconv.Itoa(t.Year())
+		r.entry.Month = strconv.Itoa(int(t.Month()))
+		r.entry.Day = strconv.Itoa(t.Day())
+	}
+	return nil
+}
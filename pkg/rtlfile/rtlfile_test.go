@@ -0,0 +1,226 @@
+package rtlfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+)
+
+var mapping, _ = fetch.NewMapping("timestamp", "c-ip", "time-to-first-byte", "sc-status", "sc-bytes", "cs-method", "cs-host", "cs-uri-stem", "x-edge-location", "time-taken", "cs-user-agent", "c-country")
+
+var lines = []string{
+	"1700000000.123\t192.0.2.1\t0.002\t200\t1024\tGET\td111.cloudfront.net\t/\tIAD89-C1\t0.004\tMozilla/5.0%20(X11)\tUS",
+	"1700000060.000\t192.0.2.2\t0.010\t404\t512\tPOST\td111.cloudfront.net\t/missing\tFRA56-P1\t0.020\t-\tDE",
+	"1700000120.500\t192.0.2.3\t0.001\t200\t2048\tGET\td222.cloudfront.net\t/other\tIAD89-C1\t0.003\tcurl/8.0\t-",
+}
+
+func writeFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "2023", "11", "14"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Firehose objects carry no extension even when gzipped
+	f, err := os.Create(filepath.Join(dir, "2023", "11", "14", "cfrtl-1-2023-11-14-22-13-20-abcd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(strings.Join(lines[:2], "\n") + "\n"))
+	gz.Close()
+	f.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "2023", "11", "14", "cfrtl-1-2023-11-14-22-18-20-efgh"), []byte(lines[2]+"\r\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".partial"), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func read(t *testing.T, c *Config, q *fetch.Query) []fetch.Entry {
+	t.Helper()
+	rows, err := c.Rows(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var entries []fetch.Entry
+	for rows.Next() {
+		var entry fetch.Entry
+		if err := rows.StructScan(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+var all = &fetch.Query{
+	From:    time.Unix(1700000000, 0),
+	To:      time.Unix(1700000200, 0),
+	Mapping: mapping,
+}
+
+func TestRows(t *testing.T) {
+	c, err := New(SetPaths(writeFiles(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	entries := read(t, c, all)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	want := fetch.Entry{
+		Timestamp:       "1700000000.123",
+		ClientIP:        "192.0.2.1",
+		Status:          200,
+		Bytes:           1024,
+		Method:          "GET",
+		Host:            "d111.cloudfront.net",
+		UriStem:         "/",
+		EdgeLocation:    "IAD89-C1",
+		TimeTaken:       0.004,
+		UserAgent:       "Mozilla/5.0%20(X11)",
+		Country:         "US",
+		Year:            "2023",
+		Month:           "11",
+		Day:             "14",
+		TimeToFirstByte: 0.002,
+	}
+	if !reflect.DeepEqual(entries[0], want) {
+		t.Errorf("got %+v\nwant %+v", entries[0], want)
+	}
+	if entries[1].UserAgent != "" || entries[2].Country != "" {
+		t.Errorf("- was not read as empty: %+v", entries[1:])
+	}
+	if entries[2].UriStem != "/other" {
+		t.Errorf("files read out of order: %+v", entries)
+	}
+}
+
+func TestRowsQuery(t *testing.T) {
+	c, err := New(SetPaths(writeFiles(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query fetch.Query
+		want  []string
+	}{
+		{"hostname", fetch.Query{From: all.From, To: all.To, Hostname: "d222.cloudfront.net"}, []string{"/other"}},
+		{"time range", fetch.Query{From: time.Unix(1700000060, 0), To: time.Unix(1700000120, int64(500*time.Millisecond))}, []string{"/missing"}},
+		{"status", fetch.Query{From: all.From, To: all.To, Status: []int{200}}, []string{"/", "/other"}},
+		{"method", fetch.Query{From: all.From, To: all.To, Methods: []string{"post"}}, []string{"/missing"}},
+		{"edge location", fetch.Query{From: all.From, To: all.To, EdgeLocations: []string{"IAD89-C1"}}, []string{"/", "/other"}},
+		{"limit", fetch.Query{From: all.From, To: all.To, Limit: 2}, []string{"/", "/missing"}},
+	} {
+		tc.query.Mapping = mapping
+		var got []string
+		for _, entry := range read(t, c, &tc.query) {
+			got = append(got, entry.UriStem)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRowsErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	if err := os.WriteFile(path, []byte(lines[0]+"\n1700000000.000\tshort\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(SetPaths(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := c.Rows(context.Background(), all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err := rows.Err(); err == nil || !strings.Contains(err.Error(), path+":2:") {
+		t.Errorf("got error %v, want one naming line 2", err)
+	}
+}
+
+func TestRowsGzipTrailer(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(strings.Join(lines[:2], "\n") + "\n"))
+	gz.Close()
+	data := buf.Bytes()
+
+	for name, corrupt := range map[string]func([]byte) []byte{
+		"bad checksum": func(b []byte) []byte { b[len(b)-8] ^= 0xff; return b },
+		"bad length":   func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b },
+		"truncated":    func(b []byte) []byte { return b[:len(b)-4] },
+	} {
+		path := filepath.Join(t.TempDir(), "log")
+		if err := os.WriteFile(path, corrupt(append([]byte(nil), data...)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c, err := New(SetPaths(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := c.Rows(context.Background(), all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+		}
+		if err := rows.Err(); err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("%s: got error %v, want one naming the file", name, err)
+		}
+		rows.Close()
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(); err == nil {
+		t.Error("expected an error without paths")
+	}
+}
+
+func TestDefaultMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	line := "1700000000.123\t192.0.2.1\t200\t1024\tGET\thttps\td111.cloudfront.net\t/\tIAD89-C1\tid\td111.cloudfront.net\t0.004\tHTTP/2.0\tIPv4\tcurl/8.0\t-\t-\t-\tHit\tTLSv1.3\tTLS_AES_128_GCM_SHA256\tHit\ttext/html\t42\tHit\tUS\t*"
+	if err := os.WriteFile(path, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(SetPaths(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := *all
+	q.Mapping = nil
+	entries := read(t, c, &q)
+	if len(entries) != 1 || entries[0].ContentLength != 42 || entries[0].CacheBehaviorPathPattern != "*" {
+		t.Errorf("got %+v", entries)
+	}
+}
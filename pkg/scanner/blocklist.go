@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// Blocklist formats
+const (
+	BlocklistText = "text"
+	BlocklistWAF  = "waf"
+)
+
+// WAF IP set scopes
+const (
+	ScopeCloudFront = "CLOUDFRONT"
+	ScopeRegional   = "REGIONAL"
+)
+
+// IPSet is the input of `aws wafv2 create-ip-set --cli-input-json`
+type IPSet struct {
+	Name             string   `json:"Name"`
+	Scope            string   `json:"Scope"`
+	Description      string   `json:"Description,omitempty"`
+	IPAddressVersion string   `json:"IPAddressVersion"`
+	Addresses        []string `json:"Addresses"`
+}
+
+// Blocklist returns the CIDR of every flagged client with at least minHits
+// rule hits, IPv4 then IPv6. A single hit, such as one request for
+// /wp-login.php, is not enough evidence to block a client.
+// Clients whose address could not be parsed are skipped.
+func Blocklist(clients []Client, minHits int) (v4, v6 []netip.Prefix) {
+	for _, client := range clients {
+		if !client.prefix.IsValid() || client.RuleHits < minHits {
+			continue
+		}
+		if client.prefix.Addr().Is4() {
+			v4 = append(v4, client.prefix)
+		} else {
+			v6 = append(v6, client.prefix)
+		}
+	}
+	return v4, v6
+}
+
+// WriteText writes one CIDR per line
+func WriteText(w io.Writer, prefixes []netip.Prefix) error {
+	for _, p := range prefixes {
+		if _, err := fmt.Fprintln(w, p.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewIPSet returns a WAF IP set holding prefixes, which must all be one IP version.
+// WAF requires a separate IP set for each version.
+func NewIPSet(name, scope string, prefixes []netip.Prefix) (*IPSet, error) {
+	set := &IPSet{
+		Name:             name,
+		Scope:            scope,
+		Description:      "Clients flagged by rtl-trino-analysis detect scanners",
+		IPAddressVersion: "IPV4",
+		Addresses:        []string{},
+	}
+	if len(prefixes) > 0 && prefixes[0].Addr().Is6() {
+		set.IPAddressVersion = "IPV6"
+	}
+	for _, p := range prefixes {
+		if p.Addr().Is6() != (set.IPAddressVersion == "IPV6") {
+			return nil, fmt.Errorf("IP set %s mixes IPv4 and IPv6 addresses", name)
+		}
+		set.Addresses = append(set.Addresses, p.String())
+	}
+	return set, nil
+}
+
+// WriteWAF writes the prefixes as a WAF IP set
+func WriteWAF(w io.Writer, name, scope string, prefixes []netip.Prefix) error {
+	set, err := NewIPSet(name, scope, prefixes)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(set)
+}
@@ -0,0 +1,397 @@
+package scanner
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/report"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Defaults
+const (
+	DefaultWindow      = time.Minute
+	DefaultMaxRequests = 300
+	DefaultMax404      = 20
+	DefaultSamples     = 5
+	DefaultMinHits     = 2
+)
+
+// DefaultExploitPaths are paths that only vulnerability scanners ask for.
+// They are matched case-insensitively against the URI stem: patterns starting
+// with / match the whole stem, or its start when they end in / or *; other
+// patterns match anywhere. Paths real sites serve, such as /wp-admin/ or
+// /config.json, are left out.
+var DefaultExploitPaths = []string{
+	"/wp-login.php",
+	"/xmlrpc.php",
+	"/wp-config.php*",
+	"/.env",
+	"/.env.*",
+	"/.git/",
+	"/.svn/",
+	"/.aws/",
+	"/.ds_store",
+	"/phpmyadmin/",
+	"/pma/",
+	"/phpinfo.php",
+	"/vendor/phpunit/",
+	"/cgi-bin/",
+	"/server-status",
+	"/boaform/",
+	"/hnap1/",
+	"/.htaccess",
+	"/shell.php",
+	"etc/passwd",
+	"../",
+}
+
+// Client is the evidence gathered for one client address or network
+type Client struct {
+	Network       string         `json:"network"`
+	Requests      int64          `json:"requests"`
+	Bytes         int64          `json:"bytes"`
+	First         time.Time      `json:"first"`
+	Last          time.Time      `json:"last"`
+	PeakRequests  int64          `json:"peak_requests"`
+	PeakWindow    time.Time      `json:"peak_window"`
+	Distinct404   int            `json:"distinct_404"`
+	ExploitHits   int64          `json:"exploit_hits"`
+	ExploitPaths  []string       `json:"exploit_paths,omitempty"`
+	RuleHits      int            `json:"rule_hits"`
+	Sample404     []string       `json:"sample_404,omitempty"`
+	Addresses     int            `json:"addresses"`
+	UserAgents    int            `json:"user_agents"`
+	StatusClasses map[string]int `json:"status_classes"`
+	Score         float64        `json:"score"`
+	Reasons       []string       `json:"reasons"`
+
+	prefix netip.Prefix
+}
+
+// Result is the JSON form of the scanner report
+type Result struct {
+	Window      string   `json:"window"`
+	MaxRequests int64    `json:"max_requests"`
+	Max404      int      `json:"max_404"`
+	Clients     int      `json:"clients"`
+	Flagged     []Client `json:"flagged"`
+}
+
+// tracker accumulates the raw counts for one client
+type tracker struct {
+	prefix     netip.Prefix
+	requests   int64
+	bytes      int64
+	first      time.Time
+	last       time.Time
+	windows    map[time.Time]int64
+	notFound   map[string]struct{}
+	exploits   map[string]int64
+	addresses  map[string]struct{}
+	userAgents map[string]struct{}
+	statuses   map[string]int
+}
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// scanner detector configs
+type Config struct {
+	v4Bits       int
+	v6Bits       int
+	window       time.Duration
+	maxRequests  int64
+	max404       int
+	exploitPaths []string
+	samples      int
+	clients      map[string]*tracker
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{
+		v4Bits:       32,
+		v6Bits:       128,
+		window:       DefaultWindow,
+		maxRequests:  DefaultMaxRequests,
+		max404:       DefaultMax404,
+		exploitPaths: DefaultExploitPaths,
+		samples:      DefaultSamples,
+		clients:      make(map[string]*tracker),
+	}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if config.v4Bits < 0 || config.v4Bits > 32 {
+		return nil, fmt.Errorf("IPv4 prefix length must be between 0 and 32")
+	}
+
+	if config.v6Bits < 0 || config.v6Bits > 128 {
+		return nil, fmt.Errorf("IPv6 prefix length must be between 0 and 128")
+	}
+
+	if config.window <= 0 {
+		return nil, fmt.Errorf("window must be positive")
+	}
+
+	if config.maxRequests < 1 || config.max404 < 1 {
+		return nil, fmt.Errorf("thresholds must be positive")
+	}
+
+	// matching is case-insensitive
+	paths := make([]string, len(config.exploitPaths))
+	for i, p := range config.exploitPaths {
+		paths[i] = strings.ToLower(p)
+	}
+	config.exploitPaths = paths
+
+	return config, nil
+}
+
+// SetPrefixes aggregates clients into networks of the given prefix lengths,
+// e.g. 24 and 64. Full lengths (32 and 128) keep single addresses.
+func SetPrefixes(v4Bits, v6Bits int) Option {
+	return func(c *Config) {
+		c.v4Bits = v4Bits
+		c.v6Bits = v6Bits
+	}
+}
+
+// SetWindow sets the window the request rate threshold applies to
+func SetWindow(window time.Duration) Option {
+	return func(c *Config) {
+		c.window = window
+	}
+}
+
+// SetMaxRequests sets the most requests a client may make in one window
+func SetMaxRequests(n int64) Option {
+	return func(c *Config) {
+		c.maxRequests = n
+	}
+}
+
+// SetMax404 sets the most distinct URIs a client may get a 404 for
+func SetMax404(n int) Option {
+	return func(c *Config) {
+		c.max404 = n
+	}
+}
+
+// SetExploitPaths replaces the list of exploit path fragments
+func SetExploitPaths(paths []string) Option {
+	return func(c *Config) {
+		c.exploitPaths = paths
+	}
+}
+
+// SetSamples sets the number of example 404 URIs kept as evidence
+func SetSamples(n int) Option {
+	return func(c *Config) {
+		c.samples = n
+	}
+}
+
+// network returns the client's address or, when aggregating, its network
+func (c *Config) network(ip string) netip.Prefix {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}
+	}
+	addr = addr.Unmap()
+	bits := c.v6Bits
+	if addr.Is4() {
+		bits = c.v4Bits
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}
+	}
+	return prefix
+}
+
+// Add counts the record against its client
+func (c *Config) Add(r *rtl.Record) {
+	prefix := c.network(r.ClientIPAddr)
+	key := r.ClientIPAddr
+	if prefix.IsValid() && !prefix.IsSingleIP() {
+		key = prefix.String()
+	}
+
+	t, ok := c.clients[key]
+	if !ok {
+		t = &tracker{
+			prefix:     prefix,
+			first:      r.Timestamp,
+			last:       r.Timestamp,
+			windows:    make(map[time.Time]int64),
+			notFound:   make(map[string]struct{}),
+			exploits:   make(map[string]int64),
+			addresses:  make(map[string]struct{}),
+			userAgents: make(map[string]struct{}),
+			statuses:   make(map[string]int),
+		}
+		c.clients[key] = t
+	}
+
+	t.requests++
+	t.bytes += r.Bytes
+	if r.Timestamp.Before(t.first) {
+		t.first = r.Timestamp
+	}
+	if r.Timestamp.After(t.last) {
+		t.last = r.Timestamp
+	}
+	t.windows[r.Timestamp.UTC().Truncate(c.window)]++
+	t.addresses[r.ClientIPAddr] = struct{}{}
+	if r.UserAgent != nil {
+		t.userAgents[r.UserAgent.Raw] = struct{}{}
+	}
+	t.statuses[strconv.Itoa(r.Status/100)+"xx"]++
+
+	if r.Status == 404 {
+		t.notFound[r.UriStem] = struct{}{}
+	}
+
+	uri := strings.ToLower(r.UriStem)
+	for _, p := range c.exploitPaths {
+		if matchPath(uri, p) {
+			t.exploits[p]++
+			break
+		}
+	}
+}
+
+// matchPath reports whether the lower-cased uri matches an exploit path pattern
+func matchPath(uri, pattern string) bool {
+	if !strings.HasPrefix(pattern, "/") {
+		return strings.Contains(uri, pattern)
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(uri, prefix)
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(uri, pattern)
+	}
+	return uri == pattern
+}
+
+// Flagged returns the clients that broke at least one rule, highest score first.
+// The score is the sum of how far each threshold was exceeded, plus one per
+// distinct exploit path probed. RuleHits counts the same: one per threshold
+// exceeded and one per distinct exploit path.
+func (c *Config) Flagged() []Client {
+	var out []Client
+	for key, t := range c.clients {
+		client := Client{
+			Network:       key,
+			Requests:      t.requests,
+			Bytes:         t.bytes,
+			First:         t.first,
+			Last:          t.last,
+			Distinct404:   len(t.notFound),
+			Addresses:     len(t.addresses),
+			UserAgents:    len(t.userAgents),
+			StatusClasses: t.statuses,
+			prefix:        t.prefix,
+		}
+
+		for w, n := range t.windows {
+			if n > client.PeakRequests || (n == client.PeakRequests && w.Before(client.PeakWindow)) {
+				client.PeakRequests = n
+				client.PeakWindow = w
+			}
+		}
+
+		if client.PeakRequests > c.maxRequests {
+			client.Score += float64(client.PeakRequests) / float64(c.maxRequests)
+			client.RuleHits++
+			client.Reasons = append(client.Reasons, fmt.Sprintf("%d requests in the %s window starting %s (limit %d)",
+				client.PeakRequests, c.window, client.PeakWindow.Format(time.RFC3339), c.maxRequests))
+		}
+
+		if client.Distinct404 > c.max404 {
+			client.Score += float64(client.Distinct404) / float64(c.max404)
+			client.RuleHits++
+			client.Reasons = append(client.Reasons, fmt.Sprintf("404 for %d distinct URIs (limit %d)", client.Distinct404, c.max404))
+		}
+
+		if len(t.exploits) > 0 {
+			for p, n := range t.exploits {
+				client.ExploitPaths = append(client.ExploitPaths, p)
+				client.ExploitHits += n
+			}
+			sort.Strings(client.ExploitPaths)
+			client.Score += float64(len(t.exploits))
+			client.RuleHits += len(t.exploits)
+			client.Reasons = append(client.Reasons, fmt.Sprintf("%d requests for exploit paths %s",
+				client.ExploitHits, strings.Join(client.ExploitPaths, ", ")))
+		}
+
+		if len(client.Reasons) == 0 {
+			continue
+		}
+
+		for uri := range t.notFound {
+			client.Sample404 = append(client.Sample404, uri)
+		}
+		sort.Strings(client.Sample404)
+		if len(client.Sample404) > c.samples {
+			client.Sample404 = client.Sample404[:c.samples]
+		}
+
+		out = append(out, client)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Network < out[j].Network
+	})
+	return out
+}
+
+// Result returns the flagged clients
+func (c *Config) Result() interface{} {
+	return &Result{
+		Window:      c.window.String(),
+		MaxRequests: c.maxRequests,
+		Max404:      c.max404,
+		Clients:     len(c.clients),
+		Flagged:     c.Flagged(),
+	}
+}
+
+// Tables returns the flagged clients with their evidence
+func (c *Config) Tables() []report.Table {
+	clients := c.Flagged()
+	flagged := report.Table{
+		Title:   fmt.Sprintf("Flagged clients (%d of %d)", len(clients), len(c.clients)),
+		Columns: []string{"network", "score", "rule_hits", "requests", "peak", "distinct_404", "exploit_hits", "addresses", "user_agents", "evidence"},
+	}
+	for _, client := range clients {
+		flagged.Rows = append(flagged.Rows, []string{
+			client.Network,
+			strconv.FormatFloat(client.Score, 'f', 1, 64),
+			strconv.Itoa(client.RuleHits),
+			strconv.FormatInt(client.Requests, 10),
+			strconv.FormatInt(client.PeakRequests, 10),
+			strconv.Itoa(client.Distinct404),
+			strconv.FormatInt(client.ExploitHits, 10),
+			strconv.Itoa(client.Addresses),
+			strconv.Itoa(client.UserAgents),
+			strings.Join(client.Reasons, "; "),
+		})
+	}
+
+	return []report.Table{flagged}
+}
@@ -0,0 +1,196 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+var start = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+func request(ip string, offset time.Duration, uri string, status int) *rtl.Record {
+	return &rtl.Record{
+		Timestamp:    start.Add(offset),
+		ClientIPAddr: ip,
+		UriStem:      uri,
+		Status:       status,
+		Bytes:        100,
+	}
+}
+
+// traffic has one client breaking each rule among well-behaved ones
+func traffic() []*rtl.Record {
+	var records []*rtl.Record
+	// a browser spread over an hour
+	for i := 0; i < 600; i++ {
+		records = append(records, request("192.0.2.1", time.Duration(i)*6*time.Second, "/", 200))
+	}
+	// a flood within one minute
+	for i := 0; i < 400; i++ {
+		records = append(records, request("192.0.2.2", time.Duration(i)*100*time.Millisecond, "/", 200))
+	}
+	// directory brute forcing
+	for i := 0; i < 30; i++ {
+		records = append(records, request("2001:db8::1", time.Duration(i)*time.Minute, fmt.Sprintf("/backup%d.zip", i), 404))
+	}
+	// exploit probes, in mixed case
+	records = append(records,
+		request("198.51.100.7", 0, "/WP-LOGIN.PHP", 404),
+		request("198.51.100.7", time.Second, "/.env", 403),
+	)
+	// a few broken links
+	for i := 0; i < 5; i++ {
+		records = append(records, request("192.0.2.3", time.Duration(i)*time.Minute, fmt.Sprintf("/old%d", i), 404))
+	}
+	return records
+}
+
+func flagged(t *testing.T, records []*rtl.Record, opts ...func(*Config)) map[string]Client {
+	t.Helper()
+	c, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		c.Add(r)
+	}
+	clients := map[string]Client{}
+	for _, client := range c.Flagged() {
+		clients[client.Network] = client
+	}
+	return clients
+}
+
+func TestFlagged(t *testing.T) {
+	clients := flagged(t, traffic())
+	for _, tc := range []struct {
+		network string
+		check   func(Client) bool
+	}{
+		{"192.0.2.2", func(c Client) bool { return c.PeakRequests == 400 && c.PeakWindow.Equal(start) }},
+		{"2001:db8::1", func(c Client) bool { return c.Distinct404 == 30 && len(c.Sample404) == DefaultSamples }},
+		{"198.51.100.7", func(c Client) bool {
+			return c.ExploitHits == 2 && len(c.ExploitPaths) == 2 && c.ExploitPaths[0] == "/.env" && c.Score == 2
+		}},
+	} {
+		client, ok := clients[tc.network]
+		if !ok {
+			t.Errorf("%s: not flagged", tc.network)
+			continue
+		}
+		if len(client.Reasons) != 1 || client.RuleHits < 1 || !tc.check(client) {
+			t.Errorf("%s: got %+v", tc.network, client)
+		}
+	}
+	for _, ok := range []string{"192.0.2.1", "192.0.2.3"} {
+		if _, found := clients[ok]; found {
+			t.Errorf("%s: flagged a well-behaved client", ok)
+		}
+	}
+}
+
+func TestExploitPaths(t *testing.T) {
+	for _, tc := range []struct {
+		uri  string
+		want bool
+	}{
+		{"/wp-login.php", true},
+		{"/WP-LOGIN.PHP", true},
+		{"/.env", true},
+		{"/.env.production", true},
+		{"/.git/config", true},
+		{"/wp-config.php.bak", true},
+		{"/cgi-bin/luci", true},
+		{"/HNAP1/", true},
+		{"/static/../../etc/passwd", true},
+		// paths real sites serve
+		{"/wp-admin/admin-ajax.php", false},
+		{"/wp-content/themes/site/style.css", false},
+		{"/actuator/health", false},
+		{"/config.json", false},
+		{"/assets/config.json", false},
+		{"/.github/workflows/ci.yml", false},
+		{"/.environment/setup", false},
+		{"/blog/wp-login.php-guide", false},
+		{"/shell", false},
+		{"/shellfish-recipes", false},
+		{"/docs/phpinfo.php.html", false},
+		{"/server-status-page", false},
+	} {
+		clients := flagged(t, []*rtl.Record{request("192.0.2.1", 0, tc.uri, 200)})
+		if got := len(clients) == 1; got != tc.want {
+			t.Errorf("%s: flagged %v, want %v", tc.uri, got, tc.want)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	var records []*rtl.Record
+	// 30 addresses in one /24 each request a different missing page
+	for i := 0; i < 30; i++ {
+		records = append(records, request(fmt.Sprintf("203.0.113.%d", i), 0, fmt.Sprintf("/x%d", i), 404))
+	}
+
+	if clients := flagged(t, records); len(clients) != 0 {
+		t.Errorf("got %d flagged single addresses, want none", len(clients))
+	}
+	clients := flagged(t, records, SetPrefixes(24, 64))
+	client, ok := clients["203.0.113.0/24"]
+	if !ok || client.Addresses != 30 || client.Distinct404 != 30 {
+		t.Errorf("got %+v, want the /24 flagged", clients)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range append(traffic(), request("not-an-ip", 0, "/.git/config", 404)) {
+		c.Add(r)
+	}
+	// One rule hit is not enough to block a client by default
+	v4, v6 := Blocklist(c.Flagged(), DefaultMinHits)
+	if len(v4) != 1 || v4[0] != netip.MustParsePrefix("198.51.100.7/32") || len(v6) != 0 {
+		t.Errorf("got blocklist %v %v, want the client probing two exploit paths only", v4, v6)
+	}
+
+	v4, v6 = Blocklist(c.Flagged(), 1)
+
+	var text bytes.Buffer
+	if err := WriteText(&text, v4); err != nil {
+		t.Fatal(err)
+	}
+	// highest score first; the unparsable address is left out
+	if got, want := text.String(), "198.51.100.7/32\n192.0.2.2/32\n"; got != want {
+		t.Errorf("got blocklist %q, want %q", got, want)
+	}
+	if len(v6) != 1 || v6[0] != netip.MustParsePrefix("2001:db8::1/128") {
+		t.Errorf("got IPv6 blocklist %v", v6)
+	}
+
+	var out bytes.Buffer
+	if err := WriteWAF(&out, "scanners-v6", ScopeCloudFront, v6); err != nil {
+		t.Fatal(err)
+	}
+	var set IPSet
+	if err := json.Unmarshal(out.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if set.Name != "scanners-v6" || set.Scope != ScopeCloudFront || set.IPAddressVersion != "IPV6" ||
+		len(set.Addresses) != 1 || set.Addresses[0] != "2001:db8::1/128" {
+		t.Errorf("got IP set %+v", set)
+	}
+
+	if _, err := NewIPSet("mixed", ScopeRegional, append(v4, v6...)); err == nil {
+		t.Error("expected an error for an IP set mixing versions")
+	}
+	if set, err := NewIPSet("empty", ScopeRegional, nil); err != nil || set.IPAddressVersion != "IPV4" || set.Addresses == nil {
+		t.Errorf("got %+v, %v for an empty IP set", set, err)
+	}
+}
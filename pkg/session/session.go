@@ -0,0 +1,245 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// DefaultTimeout is the inactivity gap that ends a session
+const DefaultTimeout = 30 * time.Minute
+
+// Session is a run of requests from one visitor without a gap longer than the timeout
+type Session struct {
+	ClientIP  string        `json:"client_ip"`
+	UserAgent string        `json:"user_agent"`
+	Cookie    string        `json:"cookie,omitempty"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Duration  time.Duration `json:"duration"`
+	Requests  int           `json:"requests"`
+	Pages     int           `json:"pages"`
+	EntryURI  string        `json:"entry_uri"`
+	ExitURI   string        `json:"exit_uri"`
+	Bytes     int64         `json:"bytes"`
+	Country   string        `json:"country"`
+	Host      string        `json:"host"`
+}
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// sessionizer configs
+type Config struct {
+	timeout    time.Duration
+	cookieName string
+	emit       func(s *Session)
+	visitors   map[string]*visitor
+	watermark  time.Time
+	lastSweep  time.Time
+}
+
+// visitor holds a visitor's hits that are not part of an emitted session yet
+type visitor struct {
+	clientIP  string
+	userAgent string
+	cookie    string
+	hits      []hit
+}
+
+// hit is the part of a record a session is built from
+type hit struct {
+	ts      time.Time
+	uri     string
+	bytes   int64
+	page    bool
+	host    string
+	country string
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{
+		timeout:  DefaultTimeout,
+		visitors: make(map[string]*visitor),
+	}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// emit must be set
+	if config.emit == nil {
+		return nil, fmt.Errorf("emit is required")
+	}
+
+	if config.timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive")
+	}
+
+	return config, nil
+}
+
+// SetTimeout sets the inactivity gap that ends a session
+func SetTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.timeout = timeout
+	}
+}
+
+// SetCookieName adds the value of the named cookie to the visitor key
+func SetCookieName(name string) Option {
+	return func(c *Config) {
+		c.cookieName = name
+	}
+}
+
+// SetEmit sets the callback receiving each completed session
+func SetEmit(emit func(s *Session)) Option {
+	return func(c *Config) {
+		c.emit = emit
+	}
+}
+
+// Add assigns a record to its visitor's session.
+// Records may arrive out of time order: each visitor's hits are buffered and
+// sorted, and a session is only emitted once no record up to the timeout
+// behind the latest one seen can extend it. A record later than that starts
+// a new session.
+func (c *Config) Add(r *rtl.Record) {
+	ua := ""
+	if r.UserAgent != nil {
+		ua = r.UserAgent.Raw
+	}
+	cookie := ""
+	if c.cookieName != "" {
+		cookie = cookieValue(r.Cookie, c.cookieName)
+	}
+	key := r.ClientIPAddr + "\x00" + ua + "\x00" + cookie
+
+	v, ok := c.visitors[key]
+	if !ok {
+		v = &visitor{clientIP: r.ClientIPAddr, userAgent: ua, cookie: cookie}
+		c.visitors[key] = v
+	}
+	h := hit{
+		ts:    r.Timestamp,
+		uri:   r.UriStem,
+		bytes: r.Bytes,
+		page:  IsPage(r),
+		host:  r.Host,
+	}
+	if r.ClientIP != nil {
+		h.country = r.ClientIP.Country
+	}
+	v.hits = append(v.hits, h)
+
+	if r.Timestamp.After(c.watermark) {
+		c.watermark = r.Timestamp
+	}
+	if c.watermark.Sub(c.lastSweep) > c.timeout {
+		c.sweep(false)
+	}
+}
+
+// sweep emits the sessions that can no longer change. A record arriving now
+// is at most the timeout behind the watermark, so a session that ended more
+// than twice the timeout before it is complete. With final set every
+// session is emitted.
+func (c *Config) sweep(final bool) {
+	for key, v := range c.visitors {
+		sort.SliceStable(v.hits, func(i, j int) bool { return v.hits[i].ts.Before(v.hits[j].ts) })
+
+		start := 0
+		for i := 1; i <= len(v.hits); i++ {
+			if i < len(v.hits) && v.hits[i].ts.Sub(v.hits[i-1].ts) <= c.timeout {
+				continue
+			}
+			// hits[start:i] is a run without a gap longer than the timeout
+			if !final && c.watermark.Sub(v.hits[i-1].ts) <= 2*c.timeout {
+				break
+			}
+			c.emit(v.session(v.hits[start:i]))
+			start = i
+		}
+
+		if start == len(v.hits) {
+			delete(c.visitors, key)
+		} else {
+			v.hits = append(v.hits[:0], v.hits[start:]...)
+		}
+	}
+	c.lastSweep = c.watermark
+}
+
+// session builds the session of a run of hits in time order
+func (v *visitor) session(hits []hit) *Session {
+	first, last := hits[0], hits[len(hits)-1]
+	s := &Session{
+		ClientIP:  v.clientIP,
+		UserAgent: v.userAgent,
+		Cookie:    v.cookie,
+		Start:     first.ts,
+		End:       last.ts,
+		Duration:  last.ts.Sub(first.ts),
+		EntryURI:  first.uri,
+		ExitURI:   first.uri,
+		Country:   first.country,
+		Host:      first.host,
+	}
+	for _, h := range hits {
+		s.Requests++
+		s.Bytes += h.bytes
+		if h.page {
+			// entry and exit are pages when there are any; other requests
+			// only stand in when there are none
+			if s.Pages == 0 {
+				s.EntryURI = h.uri
+			}
+			s.ExitURI = h.uri
+			s.Pages++
+		}
+	}
+	return s
+}
+
+// Flush emits every buffered session
+func (c *Config) Flush() {
+	c.sweep(true)
+}
+
+// pageExtensions are URI extensions counted as page views
+var pageExtensions = map[string]bool{
+	"":      true,
+	".html": true,
+	".htm":  true,
+	".php":  true,
+	".asp":  true,
+	".aspx": true,
+	".jsp":  true,
+}
+
+// IsPage reports whether the request looks like a page view rather than an asset
+func IsPage(r *rtl.Record) bool {
+	// CloudFront logs a missing value as "-"
+	contentType := strings.TrimPrefix(r.ContentType, "-")
+	if strings.HasPrefix(contentType, "text/html") {
+		return true
+	}
+	return contentType == "" && pageExtensions[strings.ToLower(path.Ext(r.UriStem))]
+}
+
+// cookieValue returns the value of the named cookie in a Cookie header
+func cookieValue(header, name string) string {
+	req := http.Request{Header: http.Header{"Cookie": {header}}}
+	if c, err := req.Cookie(name); err == nil {
+		return c.Value
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package session
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/useragent"
+)
+
+var start = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+func hitAt(ip string, offset time.Duration, uri string) *rtl.Record {
+	return &rtl.Record{
+		Timestamp:    start.Add(offset),
+		ClientIPAddr: ip,
+		UriStem:      uri,
+		Bytes:        100,
+		UserAgent:    &useragent.Record{Raw: "Mozilla/5.0"},
+	}
+}
+
+// sessionize feeds records through a sessionizer and returns the sessions by start
+func sessionize(t *testing.T, records []*rtl.Record, opts ...func(*Config)) []*Session {
+	t.Helper()
+	var sessions []*Session
+	opts = append(opts, SetEmit(func(s *Session) { sessions = append(sessions, s) }))
+	c, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		c.Add(r)
+	}
+	c.Flush()
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].Start.Equal(sessions[j].Start) {
+			return sessions[i].Start.Before(sessions[j].Start)
+		}
+		return sessions[i].ClientIP < sessions[j].ClientIP
+	})
+	return sessions
+}
+
+func TestIdleGap(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		gap  time.Duration
+		want int
+	}{
+		{"within the timeout", 29 * time.Minute, 1},
+		{"exactly the timeout", 30 * time.Minute, 1},
+		{"just over the timeout", 30*time.Minute + time.Millisecond, 2},
+		{"long idle", 3 * time.Hour, 2},
+	} {
+		sessions := sessionize(t, []*rtl.Record{
+			hitAt("192.0.2.1", 0, "/"),
+			hitAt("192.0.2.1", tc.gap, "/next"),
+		})
+		if len(sessions) != tc.want {
+			t.Errorf("%s: got %d sessions, want %d", tc.name, len(sessions), tc.want)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	sessions := sessionize(t, []*rtl.Record{
+		hitAt("192.0.2.1", 0, "/style.css"),
+		hitAt("192.0.2.1", time.Minute, "/"),
+		hitAt("192.0.2.1", 2*time.Minute, "/logo.png"),
+		hitAt("192.0.2.1", 3*time.Minute, "/about"),
+		hitAt("192.0.2.1", 4*time.Minute, "/app.js"),
+		// another visitor interleaved with the first
+		hitAt("192.0.2.2", 90*time.Second, "/only.js"),
+	})
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+
+	s := sessions[0]
+	if s.Requests != 5 || s.Pages != 2 || s.Bytes != 500 || s.Duration != 4*time.Minute {
+		t.Errorf("got %+v", s)
+	}
+	// assets stand in for entry and exit pages only when there are no pages
+	if s.EntryURI != "/" || s.ExitURI != "/about" {
+		t.Errorf("entry %s exit %s, want / and /about", s.EntryURI, s.ExitURI)
+	}
+	if o := sessions[1]; o.EntryURI != "/only.js" || o.ExitURI != "/only.js" || o.Pages != 0 {
+		t.Errorf("got %+v", o)
+	}
+}
+
+func TestCookie(t *testing.T) {
+	a := hitAt("192.0.2.1", 0, "/")
+	a.Cookie = "sid=a; theme=dark"
+	b := hitAt("192.0.2.1", time.Minute, "/")
+	b.Cookie = "sid=b"
+
+	if got := sessionize(t, []*rtl.Record{a, b}); len(got) != 1 {
+		t.Errorf("without a cookie name: got %d sessions, want 1", len(got))
+	}
+	got := sessionize(t, []*rtl.Record{a, b}, SetCookieName("sid"))
+	if len(got) != 2 || got[0].Cookie != "a" || got[1].Cookie != "b" {
+		t.Errorf("with a cookie name: got %+v", got)
+	}
+}
+
+func TestOutOfOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		records []*rtl.Record
+		want    int
+	}{
+		{
+			// another visitor moves the watermark past the first visit
+			// before its second hit arrives
+			name: "late hit",
+			records: []*rtl.Record{
+				hitAt("192.0.2.1", 0, "/"),
+				hitAt("192.0.2.2", 50*time.Minute, "/"),
+				hitAt("192.0.2.1", 25*time.Minute, "/next"),
+			},
+			want: 2,
+		},
+		{
+			name: "reversed visit",
+			records: []*rtl.Record{
+				hitAt("192.0.2.1", 40*time.Minute, "/"),
+				hitAt("192.0.2.1", 20*time.Minute, "/"),
+				hitAt("192.0.2.1", 0, "/"),
+			},
+			want: 1,
+		},
+		{
+			// later than the timeout behind the watermark: a new session
+			name: "too late",
+			records: []*rtl.Record{
+				hitAt("192.0.2.1", 0, "/"),
+				hitAt("192.0.2.2", 2*time.Hour, "/"),
+				hitAt("192.0.2.1", 20*time.Minute, "/"),
+			},
+			want: 3,
+		},
+	} {
+		if got := sessionize(t, tc.records); len(got) != tc.want {
+			t.Errorf("%s: got %d sessions, want %d", tc.name, len(got), tc.want)
+		}
+	}
+}
+
+func TestShuffled(t *testing.T) {
+	// Three staggered visitors over a day, each requesting every five minutes
+	// for two hours out of every four
+	var records []*rtl.Record
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		for visit := time.Duration(i) * 50 * time.Minute; visit < 24*time.Hour; visit += 4 * time.Hour {
+			for offset := time.Duration(0); offset <= 2*time.Hour; offset += 5 * time.Minute {
+				records = append(records, hitAt(ip, visit+offset, "/"))
+			}
+		}
+	}
+	want := sessionize(t, records)
+	if len(want) != 18 {
+		t.Fatalf("got %d sessions in order, want 18", len(want))
+	}
+
+	// Shuffle within windows just under the timeout, as parallel fetches
+	// interleave rows
+	shuffled := append([]*rtl.Record{}, records...)
+	sort.SliceStable(shuffled, func(i, j int) bool { return shuffled[i].Timestamp.Before(shuffled[j].Timestamp) })
+	rng := rand.New(rand.NewSource(1))
+	for lo := 0; lo < len(shuffled); {
+		hi := lo
+		for hi < len(shuffled) && shuffled[hi].Timestamp.Sub(shuffled[lo].Timestamp) < DefaultTimeout {
+			hi++
+		}
+		rng.Shuffle(hi-lo, func(i, j int) { shuffled[lo+i], shuffled[lo+j] = shuffled[lo+j], shuffled[lo+i] })
+		lo = hi
+	}
+	got := sessionize(t, shuffled)
+	if len(got) != len(want) {
+		t.Fatalf("got %d sessions from shuffled input, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != *want[i] {
+			t.Errorf("session %d:\n got %+v\nwant %+v", i, *got[i], *want[i])
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/store"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// DefaultBatchSize is the number of records written per transaction
+const DefaultBatchSize = 1000
+
+// maxVariables is SQLite's limit on bound variables per statement
+const maxVariables = 32766
+
+// rowsPerStatement keeps each INSERT under SQLite's bound variable limit.
+// Each row binds one variable per column, plus one for the ID.
+var rowsPerStatement = maxVariables / (len(rtl.FlatColumns) + 1)
+
+// Record is a single request row with the GeoIP and user agent data
+// flattened into columns, keyed on the CloudFront edge request ID
+type Record struct {
+	ID       uint `gorm:"primaryKey"`
+	rtl.Flat `gorm:"embedded"`
+}
+
+// indexes are created after the table so ad-hoc queries on the common
+// dimensions stay fast. The unique index backs the upsert.
+var indexes = []string{
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_records_edge_request_id ON records (edge_request_id)",
+	"CREATE INDEX IF NOT EXISTS idx_records_timestamp ON records (timestamp)",
+	"CREATE INDEX IF NOT EXISTS idx_records_host_timestamp ON records (host, timestamp)",
+	"CREATE INDEX IF NOT EXISTS idx_records_status ON records (status)",
+	"CREATE INDEX IF NOT EXISTS idx_records_geo_country ON records (geo_country)",
+}
+
+// Used to manage varidic options
+type Option func(c *Config)
+
+// database configs
+type Config struct {
+	path      string
+	batchSize int
+	db        *gorm.DB
+	pending   []*Record
+}
+
+// New returns a new Config with the given options
+func New(opts ...func(*Config)) (*Config, error) {
+	config := &Config{
+		batchSize: DefaultBatchSize,
+	}
+
+	// apply options
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// path must be set
+	if config.path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	if config.batchSize < 1 {
+		return nil, fmt.Errorf("batch size must be positive")
+	}
+
+	// open the database, creating it if needed
+	if err := os.MkdirAll(filepath.Dir(config.path), 0755); err != nil {
+		return nil, err
+	}
+	dsn := config.path + "?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)"
+	if db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard}); err != nil {
+		return nil, err
+	} else {
+		config.db = db
+	}
+
+	if err := config.migrate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// SetPath sets the database file
+func SetPath(path string) Option {
+	return func(c *Config) {
+		c.path = path
+	}
+}
+
+// SetBatchSize sets the number of records written per transaction
+func SetBatchSize(size int) Option {
+	return func(c *Config) {
+		c.batchSize = size
+	}
+}
+
+// migrate creates the records table and its indexes
+func (c *Config) migrate() error {
+	if err := c.db.AutoMigrate(&Record{}); err != nil {
+		return err
+	}
+	for _, stmt := range indexes {
+		if err := c.db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write queues a record and writes the queue once a batch is full
+func (c *Config) Write(record *rtl.Record) error {
+	c.pending = append(c.pending, &Record{Flat: *record.Flatten()})
+	if len(c.pending) >= c.batchSize {
+		return c.Flush()
+	}
+	return nil
+}
+
+// Flush writes all queued records in a single transaction.
+// Existing rows with the same edge request ID are replaced, so reruns do not duplicate rows.
+func (c *Config) Flush() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "edge_request_id"}},
+			UpdateAll: true,
+		}).CreateInBatches(c.pending, rowsPerStatement).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	c.pending = c.pending[:0]
+	return nil
+}
+
+// Each calls fn for every stored record matching filter, in timestamp order
+func (c *Config) Each(ctx context.Context, filter *store.Filter, fn func(record *rtl.Record) error) error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	where, args := filter.Conditions()
+	if filter != nil && filter.Country != "" {
+		// country codes are stored upper case; Match ignores case too
+		where += " AND geo_country = ?"
+		args = append(args, strings.ToUpper(filter.Country))
+	}
+
+	rows, err := c.db.WithContext(ctx).Model(&Record{}).Where(where, args...).Order("timestamp").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row Record
+		if err := c.db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		record := row.Record()
+		if !filter.Match(record) {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Close flushes queued records and closes the database
+func (c *Config) Close() error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	db, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+func TestFlushBatch(t *testing.T) {
+	db, err := New(SetPath(filepath.Join(t.TempDir(), "rtl.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	start := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+	record := func(i int) *rtl.Record {
+		return &rtl.Record{
+			Timestamp:     start.Add(time.Duration(i) * time.Second),
+			EdgeRequestID: fmt.Sprintf("req-%04d", i),
+			Host:          "d111111abcdef8.cloudfront.net",
+			Status:        200,
+		}
+	}
+
+	// A full batch flushes on its own, across several statements
+	for i := 0; i < DefaultBatchSize; i++ {
+		if err := db.Write(record(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(db.pending) != 0 {
+		t.Fatalf("%d records still queued after a full batch", len(db.pending))
+	}
+
+	// Rewriting a record replaces it rather than adding a row
+	if err := db.Write(record(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	err = db.Each(context.Background(), nil, func(r *rtl.Record) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != DefaultBatchSize {
+		t.Errorf("got %d rows, want %d", count, DefaultBatchSize)
+	}
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/fetch"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/reader"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Store is a local copy of fetched records that can be scanned repeatedly
+type Store interface {
+	// Each calls fn for every record matching filter, stopping at the first error
+	Each(ctx context.Context, filter *Filter, fn func(record *rtl.Record) error) error
+	Close() error
+}
+
+// Filter selects records by time range and request attributes.
+// Zero values match everything.
+type Filter struct {
+	From          time.Time
+	To            time.Time
+	Host          string
+	Status        []int
+	Methods       []string
+	EdgeLocations []string
+	Country       string
+	URIPrefix     string
+}
+
+// Match reports whether the record passes every filter
+func (f *Filter) Match(r *rtl.Record) bool {
+	if f == nil {
+		return true
+	}
+	if !f.From.IsZero() && r.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Timestamp.Before(f.To) {
+		return false
+	}
+	// a host matches itself and its subdomains, the same as fetch --hostname
+	if !fetch.MatchHost(r.Host, f.Host) {
+		return false
+	}
+	if len(f.Status) > 0 && !contains(f.Status, r.Status) {
+		return false
+	}
+	if len(f.Methods) > 0 && !containsFold(f.Methods, r.Method) {
+		return false
+	}
+	if len(f.EdgeLocations) > 0 && !contains(f.EdgeLocations, r.EdgeLocation) {
+		return false
+	}
+	if f.Country != "" && (r.ClientIP == nil || !strings.EqualFold(r.ClientIP.Country, f.Country)) {
+		return false
+	}
+	if f.URIPrefix != "" && !strings.HasPrefix(r.UriStem, f.URIPrefix) {
+		return false
+	}
+	return true
+}
+
+// Conditions returns a SQL WHERE clause and its arguments for the filters
+// on columns every database store shares. Stores still call Match on each
+// row for the rest.
+func (f *Filter) Conditions() (string, []interface{}) {
+	if f == nil {
+		return "1 = 1", nil
+	}
+
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if !f.From.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, f.To)
+	}
+	if f.Host != "" {
+		where = append(where, "(host = ? OR host LIKE ? ESCAPE '!')")
+		args = append(args, f.Host, "%."+likeEscaper.Replace(f.Host))
+	}
+	if len(f.Status) > 0 {
+		where = append(where, "status IN ?")
+		args = append(args, f.Status)
+	}
+	if len(f.Methods) > 0 {
+		methods := make([]string, len(f.Methods))
+		for i, m := range f.Methods {
+			methods[i] = strings.ToUpper(m)
+		}
+		where = append(where, "method IN ?")
+		args = append(args, methods)
+	}
+	if len(f.EdgeLocations) > 0 {
+		where = append(where, "edge_location IN ?")
+		args = append(args, f.EdgeLocations)
+	}
+	if f.URIPrefix != "" {
+		where = append(where, "uri_stem LIKE ? ESCAPE '!'")
+		args = append(args, likeEscaper.Replace(f.URIPrefix)+"%")
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// likeEscaper escapes LIKE wildcards for an ESCAPE '!' clause. A backslash
+// would need quoting differently in SQLite and MySQL string literals.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Files scans data files written by fetch
+type Files struct {
+	Paths  []string
+	Format string
+}
+
+// NewFiles returns a store over the given data files.
+// The format is inferred from each file's extension when empty.
+func NewFiles(format string, paths ...string) (*Files, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("at least one data file is required")
+	}
+	return &Files{Paths: paths, Format: format}, nil
+}
+
+// Each reads every file from the start, so changes to the files are picked up
+func (s *Files) Each(ctx context.Context, filter *Filter, fn func(record *rtl.Record) error) error {
+	for _, path := range s.Paths {
+		in, err := reader.Open(path, s.Format)
+		if err != nil {
+			return err
+		}
+		err = reader.Each(in, func(record *rtl.Record) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !filter.Match(record) {
+				return nil
+			}
+			return fn(record)
+		})
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Close is a no-op; files are opened per scan
+func (s *Files) Close() error {
+	return nil
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
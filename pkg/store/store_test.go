@@ -0,0 +1,86 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/geoip"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+var start = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+func TestMatch(t *testing.T) {
+	record := &rtl.Record{
+		Timestamp:    start.Add(time.Minute),
+		Host:         "www.example.com",
+		Status:       404,
+		Method:       "GET",
+		EdgeLocation: "IAD89-C1",
+		UriStem:      "/static/app.js",
+		ClientIP:     &geoip.GeoIPData{Country: "US"},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter *Filter
+		want   bool
+	}{
+		{"nil", nil, true},
+		{"empty", &Filter{}, true},
+		{"in range", &Filter{From: start, To: start.Add(time.Hour)}, true},
+		{"before from", &Filter{From: start.Add(2 * time.Minute)}, false},
+		{"to is exclusive", &Filter{To: start.Add(time.Minute)}, false},
+		{"exact host", &Filter{Host: "www.example.com"}, true},
+		{"parent domain", &Filter{Host: "example.com"}, true},
+		{"look-alike host", &Filter{Host: "w.example.com"}, false},
+		{"wildcard host", &Filter{Host: "%.com"}, false},
+		{"status", &Filter{Status: []int{200, 404}}, true},
+		{"other status", &Filter{Status: []int{200}}, false},
+		{"method in any case", &Filter{Methods: []string{"get"}}, true},
+		{"edge location", &Filter{EdgeLocations: []string{"FRA56-P1"}}, false},
+		{"country in any case", &Filter{Country: "us"}, true},
+		{"other country", &Filter{Country: "DE"}, false},
+		{"uri prefix", &Filter{URIPrefix: "/static/"}, true},
+		{"other uri prefix", &Filter{URIPrefix: "/api/"}, false},
+	} {
+		if got := tc.filter.Match(record); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if (&Filter{Country: "US"}).Match(&rtl.Record{}) {
+		t.Error("a country filter matched a record without GeoIP data")
+	}
+}
+
+func TestConditions(t *testing.T) {
+	where, args := (&Filter{
+		From:      start,
+		To:        start.Add(time.Hour),
+		Host:      "my_site.example.com",
+		Status:    []int{500},
+		Methods:   []string{"get"},
+		URIPrefix: "/100%_off!",
+	}).Conditions()
+
+	want := "1 = 1 AND timestamp >= ? AND timestamp < ? AND (host = ? OR host LIKE ? ESCAPE '!') AND status IN ? AND method IN ? AND uri_stem LIKE ? ESCAPE '!'"
+	if where != want {
+		t.Errorf("where:\n got %s\nwant %s", where, want)
+	}
+	wantArgs := []interface{}{
+		start, start.Add(time.Hour),
+		"my_site.example.com", "%.my!_site.example.com",
+		[]int{500},
+		[]string{"GET"},
+		"/100!%!_off!!%",
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args: got %v, want %v", args, wantArgs)
+	}
+
+	if where, args := (*Filter)(nil).Conditions(); where != "1 = 1" || args != nil {
+		t.Errorf("nil filter: got %q %v", where, args)
+	}
+}
@@ -0,0 +1,126 @@
+package useragent
+
+import (
+	"strings"
+)
+
+// Bot categories
+const (
+	CategorySearch  = "search"
+	CategoryAI      = "ai"
+	CategorySocial  = "social"
+	CategorySEO     = "seo"
+	CategoryMonitor = "monitor"
+	CategoryTool    = "tool"
+	CategoryOther   = "other"
+)
+
+// Bot identifies a known crawler or automated client
+type Bot struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// botRule matches a lower-cased user agent substring
+type botRule struct {
+	match string
+	bot   Bot
+}
+
+// botRules are checked in order, so more specific tokens come first
+var botRules = []botRule{
+	// search engines
+	{"googlebot", Bot{"Googlebot", CategorySearch}},
+	{"google-inspectiontool", Bot{"Google-InspectionTool", CategorySearch}},
+	{"adsbot-google", Bot{"AdsBot-Google", CategorySearch}},
+	{"bingbot", Bot{"Bingbot", CategorySearch}},
+	{"bingpreview", Bot{"BingPreview", CategorySearch}},
+	{"applebot", Bot{"Applebot", CategorySearch}},
+	{"duckduckbot", Bot{"DuckDuckBot", CategorySearch}},
+	{"yandexbot", Bot{"YandexBot", CategorySearch}},
+	{"baiduspider", Bot{"Baiduspider", CategorySearch}},
+	{"seznambot", Bot{"SeznamBot", CategorySearch}},
+
+	// AI crawlers and assistants
+	{"gptbot", Bot{"GPTBot", CategoryAI}},
+	{"chatgpt-user", Bot{"ChatGPT-User", CategoryAI}},
+	{"oai-searchbot", Bot{"OAI-SearchBot", CategoryAI}},
+	{"claudebot", Bot{"ClaudeBot", CategoryAI}},
+	{"claude-web", Bot{"Claude-Web", CategoryAI}},
+	{"anthropic-ai", Bot{"anthropic-ai", CategoryAI}},
+	{"ccbot", Bot{"CCBot", CategoryAI}},
+	{"perplexitybot", Bot{"PerplexityBot", CategoryAI}},
+	{"bytespider", Bot{"Bytespider", CategoryAI}},
+	{"amazonbot", Bot{"Amazonbot", CategoryAI}},
+	{"meta-externalagent", Bot{"Meta-ExternalAgent", CategoryAI}},
+	{"cohere-ai", Bot{"cohere-ai", CategoryAI}},
+	{"diffbot", Bot{"Diffbot", CategoryAI}},
+
+	// social previews
+	{"facebookexternalhit", Bot{"facebookexternalhit", CategorySocial}},
+	{"twitterbot", Bot{"Twitterbot", CategorySocial}},
+	{"linkedinbot", Bot{"LinkedInBot", CategorySocial}},
+	{"slackbot", Bot{"Slackbot", CategorySocial}},
+	{"discordbot", Bot{"Discordbot", CategorySocial}},
+	{"telegrambot", Bot{"TelegramBot", CategorySocial}},
+	{"whatsapp", Bot{"WhatsApp", CategorySocial}},
+
+	// SEO tools
+	{"ahrefsbot", Bot{"AhrefsBot", CategorySEO}},
+	{"semrushbot", Bot{"SemrushBot", CategorySEO}},
+	{"mj12bot", Bot{"MJ12bot", CategorySEO}},
+	{"dotbot", Bot{"DotBot", CategorySEO}},
+	{"petalbot", Bot{"PetalBot", CategorySEO}},
+
+	// uptime monitors
+	{"uptimerobot", Bot{"UptimeRobot", CategoryMonitor}},
+	{"pingdom", Bot{"Pingdom", CategoryMonitor}},
+	{"statuscake", Bot{"StatusCake", CategoryMonitor}},
+	{"datadogsynthetics", Bot{"Datadog Synthetics", CategoryMonitor}},
+	{"site24x7", Bot{"Site24x7", CategoryMonitor}},
+	{"amazon-route53-health-check", Bot{"Route 53 Health Check", CategoryMonitor}},
+	{"elb-healthchecker", Bot{"ELB-HealthChecker", CategoryMonitor}},
+
+	// HTTP libraries and command line tools
+	{"curl/", Bot{"curl", CategoryTool}},
+	{"wget/", Bot{"Wget", CategoryTool}},
+	{"python-requests", Bot{"python-requests", CategoryTool}},
+	{"python-urllib", Bot{"Python-urllib", CategoryTool}},
+	{"aiohttp", Bot{"aiohttp", CategoryTool}},
+	{"httpx", Bot{"httpx", CategoryTool}},
+	{"go-http-client", Bot{"Go-http-client", CategoryTool}},
+	{"okhttp", Bot{"okhttp", CategoryTool}},
+	{"axios/", Bot{"axios", CategoryTool}},
+	{"node-fetch", Bot{"node-fetch", CategoryTool}},
+	{"java/", Bot{"Java", CategoryTool}},
+	{"libwww-perl", Bot{"libwww-perl", CategoryTool}},
+	{"scrapy", Bot{"Scrapy", CategoryTool}},
+	{"headlesschrome", Bot{"HeadlessChrome", CategoryTool}},
+}
+
+// genericBotTokens mark self-declared automated clients that are not otherwise known
+var genericBotTokens = []string{"bot", "crawler", "spider", "scraper", "http://", "https://"}
+
+// Classify returns the known bot for a user agent string, or nil for ordinary browsers.
+// Self-declared bots that match no rule are reported as an unknown bot.
+func Classify(ua string) *Bot {
+	lower := strings.ToLower(ua)
+	if lower == "" || lower == "-" {
+		return nil
+	}
+
+	for _, rule := range botRules {
+		if strings.Contains(lower, rule.match) {
+			bot := rule.bot
+			return &bot
+		}
+	}
+
+	for _, token := range genericBotTokens {
+		if strings.Contains(lower, token) {
+			return &Bot{Name: "unknown", Category: CategoryOther}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package useragent
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		ua       string
+		name     string
+		category string
+	}{
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Googlebot", CategorySearch},
+		{"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/116.0.1938.76 Safari/537.36", "Bingbot", CategorySearch},
+		{"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.2; +https://openai.com/gptbot)", "GPTBot", CategoryAI},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", "facebookexternalhit", CategorySocial},
+		{"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", "AhrefsBot", CategorySEO},
+		{"Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", "UptimeRobot", CategoryMonitor},
+		{"curl/8.4.0", "curl", CategoryTool},
+		{"python-requests/2.31.0", "python-requests", CategoryTool},
+		// AdsBot-Google is not mistaken for Googlebot
+		{"AdsBot-Google (+http://www.google.com/adsbot.html)", "AdsBot-Google", CategorySearch},
+		// self-declared but unknown
+		{"ExampleCrawler/1.0", "unknown", CategoryOther},
+		{"Mozilla/5.0 (compatible; +https://example.com/about)", "unknown", CategoryOther},
+		// browsers and empty fields
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", "", ""},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36", "", ""},
+		{"-", "", ""},
+		{"", "", ""},
+	} {
+		bot := Classify(tc.ua)
+		if tc.name == "" {
+			if bot != nil {
+				t.Errorf("%q: got %+v, want no bot", tc.ua, *bot)
+			}
+			continue
+		}
+		if bot == nil || bot.Name != tc.name || bot.Category != tc.category {
+			t.Errorf("%q: got %+v, want %s (%s)", tc.ua, bot, tc.name, tc.category)
+		}
+	}
+}
+
+func TestParseBot(t *testing.T) {
+	r, err := Parse("Mozilla/5.0 (compatible; ClaudeBot/1.0; +claudebot@anthropic.com)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Bot || r.BotName != "ClaudeBot" || r.BotCategory != CategoryAI {
+		t.Errorf("got %+v", r)
+	}
+}
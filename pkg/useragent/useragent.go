@@ -37,6 +37,8 @@ type Record struct {
 	OS                   string `json:"os"`
 	Localization         string `json:"localization"`
 	Bot                  bool   `json:"bot"`
+	BotName              string `json:"bot_name,omitempty"`
+	BotCategory          string `json:"bot_category,omitempty"`
 	Mobile               bool   `json:"mobile"`
 }
 
@@ -47,7 +49,7 @@ func Parse(line string) (*Record, error) {
 	engineName, engineVersion := client.Engine()
 	browserName, browserVersion := client.Browser()
 
-	return &Record{
+	record := &Record{
 		Raw:                  strings.TrimSpace(line),
 		Mozilla:              strings.TrimSpace(client.Mozilla()),
 		Platform:             strings.TrimSpace(client.Platform()),
@@ -59,5 +61,13 @@ func Parse(line string) (*Record, error) {
 		BrowserEngineVersion: strings.TrimSpace(engineVersion),
 		BrowserName:          strings.TrimSpace(browserName),
 		BrowserVersion:       strings.TrimSpace(browserVersion),
-	}, nil
+	}
+
+	if bot := Classify(line); bot != nil {
+		record.Bot = true
+		record.BotName = bot.Name
+		record.BotCategory = bot.Category
+	}
+
+	return record, nil
 }
@@ -0,0 +1,151 @@
+package useragent
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Verification results
+const (
+	// VerifyUnknown means the bot has no allowlist entry, so it cannot be checked
+	VerifyUnknown = "unknown"
+	// VerifyVerified means the client IP resolves to an allowlisted domain and back
+	VerifyVerified = "verified"
+	// VerifySpoofed means the client claims to be the bot but its IP does not belong to it
+	VerifySpoofed = "spoofed"
+)
+
+//go:embed allowlist.json
+var defaultAllowlist []byte
+
+// Resolver is the subset of net.Resolver used for verification
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Used to manage varidic options
+type VerifierOption func(v *Verifier)
+
+// Verifier checks claimed bots by forward-confirmed reverse DNS against
+// an allowlist of domain suffixes per bot name
+type Verifier struct {
+	allowlist     map[string][]string
+	allowlistFile string
+	resolver      Resolver
+	cache         sync.Map
+}
+
+// NewVerifier returns a Verifier using the bundled allowlist unless another is set
+func NewVerifier(opts ...func(*Verifier)) (*Verifier, error) {
+	v := &Verifier{
+		resolver: net.DefaultResolver,
+	}
+
+	// apply options
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	data := defaultAllowlist
+	if v.allowlistFile != "" {
+		var err error
+		if data, err = os.ReadFile(v.allowlistFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(data, &v.allowlist); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// SetAllowlist sets a JSON file mapping bot names to their reverse DNS domain suffixes
+func SetAllowlist(path string) VerifierOption {
+	return func(v *Verifier) {
+		v.allowlistFile = path
+	}
+}
+
+// SetResolver sets the DNS resolver
+func SetResolver(resolver Resolver) VerifierOption {
+	return func(v *Verifier) {
+		v.resolver = resolver
+	}
+}
+
+// Verify checks whether ip really belongs to the named bot.
+// Results are cached per bot and IP, so repeated requests cost one lookup.
+func (v *Verifier) Verify(ctx context.Context, name string, ip string) string {
+	suffixes, ok := v.allowlist[name]
+	if !ok {
+		return VerifyUnknown
+	}
+
+	key := name + "|" + ip
+	if cached, ok := v.cache.Load(key); ok {
+		return cached.(string)
+	}
+
+	result := v.lookup(ctx, suffixes, ip)
+	if result != VerifyUnknown {
+		v.cache.Store(key, result)
+	}
+	return result
+}
+
+// lookup resolves ip to a host name under one of the suffixes and confirms
+// the host name resolves back to ip
+func (v *Verifier) lookup(ctx context.Context, suffixes []string, ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return VerifySpoofed
+	}
+
+	names, err := v.resolver.LookupAddr(ctx, ip)
+	if err != nil {
+		// An address without a PTR record cannot be the bot; any other
+		// failure says nothing about the client
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return VerifySpoofed
+		}
+		return VerifyUnknown
+	}
+
+	for _, name := range names {
+		host := strings.TrimSuffix(strings.ToLower(name), ".")
+		if !matchesSuffix(host, suffixes) {
+			continue
+		}
+
+		addrs, err := v.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a.IP.Equal(addr) {
+				return VerifyVerified
+			}
+		}
+	}
+
+	return VerifySpoofed
+}
+
+func matchesSuffix(host string, suffixes []string) bool {
+	for _, s := range suffixes {
+		s = strings.ToLower(s)
+		if host == s || strings.HasSuffix(host, "."+s) {
+			return true
+		}
+	}
+	return false
+}
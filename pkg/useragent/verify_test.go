@@ -0,0 +1,145 @@
+package useragent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeResolver answers from fixed reverse and forward records
+type fakeResolver struct {
+	ptr     map[string][]string
+	forward map[string][]string
+	fail    error
+	lookups int
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.lookups++
+	if r.fail != nil {
+		return nil, r.fail
+	}
+	names, ok := r.ptr[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r.forward[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		ptr: map[string][]string{
+			"66.249.66.1":  {"crawl-66-249-66-1.googlebot.com."},
+			"66.249.66.2":  {"CRAWL-66-249-66-2.GOOGLEBOT.COM."},
+			"157.55.39.1":  {"msnbot-157-55-39-1.search.msn.com."},
+			"2001:db8::1":  {"crawl.googlebot.com."},
+			"198.51.100.1": {"crawl-198-51-100-1.googlebot.com.evil.net."},
+			"198.51.100.2": {"crawl.evilgooglebot.com."},
+			"198.51.100.3": {"crawl-66-249-66-1.googlebot.com."},
+			"198.51.100.4": {"host.example.net.", "crawl-198-51-100-4.googlebot.com."},
+		},
+		forward: map[string][]string{
+			"crawl-66-249-66-1.googlebot.com":           {"66.249.66.1"},
+			"crawl-66-249-66-2.googlebot.com":           {"66.249.66.2"},
+			"msnbot-157-55-39-1.search.msn.com":         {"157.55.39.1"},
+			"crawl.googlebot.com":                       {"2001:db8::1"},
+			"crawl-198-51-100-1.googlebot.com.evil.net": {"198.51.100.1"},
+			"crawl.evilgooglebot.com":                   {"198.51.100.2"},
+			"crawl-198-51-100-4.googlebot.com":          {"198.51.100.4"},
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		bot  string
+		ip   string
+		want string
+	}{
+		{"googlebot", "Googlebot", "66.249.66.1", VerifyVerified},
+		{"upper case with trailing dot", "Googlebot", "66.249.66.2", VerifyVerified},
+		{"bingbot", "Bingbot", "157.55.39.1", VerifyVerified},
+		{"ipv6", "Googlebot", "2001:db8::1", VerifyVerified},
+		{"second PTR name", "Googlebot", "198.51.100.4", VerifyVerified},
+		{"another bot's domain", "Bingbot", "66.249.66.1", VerifySpoofed},
+		{"no PTR record", "Googlebot", "203.0.113.7", VerifySpoofed},
+		{"allowlisted name under another domain", "Googlebot", "198.51.100.1", VerifySpoofed},
+		{"look-alike domain", "Googlebot", "198.51.100.2", VerifySpoofed},
+		{"forward lookup does not confirm", "Googlebot", "198.51.100.3", VerifySpoofed},
+		{"not an address", "Googlebot", "not-an-ip", VerifySpoofed},
+		{"bot without an allowlist entry", "GPTBot", "66.249.66.1", VerifyUnknown},
+	} {
+		v, err := NewVerifier(SetResolver(newFakeResolver()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.Verify(context.Background(), tc.bot, tc.ip); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyCache(t *testing.T) {
+	r := newFakeResolver()
+	v, err := NewVerifier(SetResolver(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if got := v.Verify(context.Background(), "Googlebot", "66.249.66.1"); got != VerifyVerified {
+			t.Fatalf("got %s, want %s", got, VerifyVerified)
+		}
+	}
+	if r.lookups != 1 {
+		t.Errorf("got %d reverse lookups, want 1", r.lookups)
+	}
+
+	// A resolver failure proves nothing and is retried next time
+	r.fail = errors.New("i/o timeout")
+	for i := 0; i < 2; i++ {
+		if got := v.Verify(context.Background(), "Googlebot", "203.0.113.9"); got != VerifyUnknown {
+			t.Errorf("got %s on a resolver failure, want %s", got, VerifyUnknown)
+		}
+	}
+	if r.lookups != 3 {
+		t.Errorf("got %d reverse lookups, want failures retried", r.lookups)
+	}
+}
+
+func TestAllowlistFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := os.WriteFile(path, []byte(`{"GPTBot": ["openai.com"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeResolver()
+	r.ptr["20.171.207.1"] = []string{"crawl.openai.com."}
+	r.forward["crawl.openai.com"] = []string{"20.171.207.1"}
+
+	v, err := NewVerifier(SetAllowlist(path), SetResolver(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.Verify(context.Background(), "GPTBot", "20.171.207.1"); got != VerifyVerified {
+		t.Errorf("GPTBot: got %s, want %s", got, VerifyVerified)
+	}
+	// the file replaces the bundled list
+	if got := v.Verify(context.Background(), "Googlebot", "66.249.66.1"); got != VerifyUnknown {
+		t.Errorf("Googlebot: got %s, want %s", got, VerifyUnknown)
+	}
+}
@@ -0,0 +1,51 @@
+package writer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// CSV writes flattened records with a header row
+type CSV struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSV returns a CSV writer
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{w: csv.NewWriter(w)}
+}
+
+// Write appends a single record row, preceded by the header on first use
+func (w *CSV) Write(record *rtl.Record) error {
+	if !w.header {
+		if err := w.w.Write(rtl.FlatColumns); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	return w.w.Write(record.Flatten().Strings())
+}
+
+// Close flushes buffered rows
+func (w *CSV) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// checkHeader reads the header row of an existing CSV file and reports an
+// error unless it matches the columns written today
+func checkHeader(r io.Reader) error {
+	header, err := csv.NewReader(r).Read()
+	if err != nil {
+		return fmt.Errorf("reading CSV header: %w", err)
+	}
+	if !slices.Equal(header, rtl.FlatColumns) {
+		return fmt.Errorf("CSV header has %d columns that do not match the %d current columns", len(header), len(rtl.FlatColumns))
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Gob writes a stream of gob-encoded records, one value per record
+type Gob struct {
+	buf *bufio.Writer
+	enc *gob.Encoder
+}
+
+// NewGob returns a gob stream writer
+func NewGob(w io.Writer) *Gob {
+	buf := bufio.NewWriter(w)
+	return &Gob{buf: buf, enc: gob.NewEncoder(buf)}
+}
+
+// Write encodes a single record
+func (w *Gob) Write(record *rtl.Record) error {
+	return w.enc.Encode(record)
+}
+
+// Close flushes buffered data
+func (w *Gob) Close() error {
+	return w.buf.Flush()
+}
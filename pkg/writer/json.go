@@ -0,0 +1,76 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// JSON writes records as an indented JSON array
+type JSON struct {
+	buf   *bufio.Writer
+	count int64
+}
+
+// NewJSON returns a JSON array writer
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{buf: bufio.NewWriter(w)}
+}
+
+// Write appends a single record to the array
+func (w *JSON) Write(record *rtl.Record) error {
+	data, err := json.MarshalIndent(record, " ", " ")
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n "
+	if w.count == 0 {
+		sep = "[\n "
+	}
+	if _, err := w.buf.WriteString(sep); err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(data); err != nil {
+		return err
+	}
+	w.count++
+
+	return nil
+}
+
+// Close terminates the array
+func (w *JSON) Close() error {
+	end := "\n]"
+	if w.count == 0 {
+		end = "[]"
+	}
+	if _, err := w.buf.WriteString(end); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+// NDJSON writes one compact JSON record per line
+type NDJSON struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewNDJSON returns a newline-delimited JSON writer
+func NewNDJSON(w io.Writer) *NDJSON {
+	buf := bufio.NewWriter(w)
+	return &NDJSON{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+// Write appends a single record line
+func (w *NDJSON) Write(record *rtl.Record) error {
+	return w.enc.Encode(record)
+}
+
+// Close flushes buffered lines
+func (w *NDJSON) Close() error {
+	return w.buf.Flush()
+}
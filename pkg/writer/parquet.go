@@ -0,0 +1,53 @@
+package writer
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// parquetBatch is the number of rows buffered before handing them to the encoder
+const parquetBatch = 1024
+
+// Parquet writes flattened records as a Parquet file
+type Parquet struct {
+	w    *parquet.GenericWriter[rtl.Flat]
+	rows []rtl.Flat
+}
+
+// NewParquet returns a Parquet writer
+func NewParquet(w io.Writer) *Parquet {
+	return &Parquet{
+		w:    parquet.NewGenericWriter[rtl.Flat](w, parquet.Compression(&parquet.Snappy)),
+		rows: make([]rtl.Flat, 0, parquetBatch),
+	}
+}
+
+// Write buffers a single record row
+func (w *Parquet) Write(record *rtl.Record) error {
+	w.rows = append(w.rows, *record.Flatten())
+	if len(w.rows) == parquetBatch {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes buffered rows and the file footer
+func (w *Parquet) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
+
+func (w *Parquet) flush() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	if _, err := w.w.Write(w.rows); err != nil {
+		return err
+	}
+	w.rows = w.rows[:0]
+	return nil
+}
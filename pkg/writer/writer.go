@@ -0,0 +1,215 @@
+package writer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+// Supported output formats
+const (
+	FormatJSON    = "json"
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatGob     = "gob"
+	FormatParquet = "parquet"
+)
+
+// Writer writes records to an output one at a time.
+// Close flushes any buffered data; it does not close the underlying io.Writer.
+type Writer interface {
+	Write(record *rtl.Record) error
+	Close() error
+}
+
+// FormatFromPath infers the output format from the file extension
+func FormatFromPath(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return FormatJSON, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	case ".csv":
+		return FormatCSV, nil
+	case ".gob":
+		return FormatGob, nil
+	case ".parquet":
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("cannot infer format from extension %q", ext)
+	}
+}
+
+// New returns a Writer for the given format
+func New(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatJSON:
+		return NewJSON(w), nil
+	case FormatNDJSON:
+		return NewNDJSON(w), nil
+	case FormatCSV:
+		return NewCSV(w), nil
+	case FormatGob:
+		return NewGob(w), nil
+	case FormatParquet:
+		return NewParquet(w), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// File is a Writer backed by a file it owns.
+// Close commits the output and Abort discards it.
+type File struct {
+	Writer
+	Path string
+	f    *os.File
+	// tmp is the file written until Close renames it to Path
+	tmp string
+	// size is the length of an appended file before writing began
+	size int64
+}
+
+// Create returns a Writer for a new file at path. Records are written to a
+// temporary file in the same directory that replaces path on Close, so an
+// existing file survives a failed write.
+// An empty format is inferred from the file extension.
+func Create(path string, format string) (*File, error) {
+	if format == "" {
+		var err error
+		if format, err = FormatFromPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Resolve the output file path
+	fqpn, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fqpn), 0755); err != nil {
+		return nil, err
+	}
+
+	// Create the temporary output file
+	f, err := os.CreateTemp(filepath.Dir(fqpn), "."+filepath.Base(fqpn)+".*")
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := New(f, format)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &File{Writer: w, Path: fqpn, f: f, tmp: f.Name()}, nil
+}
+
+// Append opens the file at path for appending, creating it if needed.
+// Only line-oriented formats can be appended to; a CSV file that already
+// has rows is not given a second header, and is refused unless its header
+// matches the current columns.
+func Append(path string, format string) (*File, error) {
+	if format == "" {
+		var err error
+		if format, err = FormatFromPath(path); err != nil {
+			return nil, err
+		}
+	}
+	if !Appendable(format) {
+		return nil, fmt.Errorf("cannot append to %s files (use ndjson or csv)", format)
+	}
+
+	fqpn, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fqpn), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(fqpn, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w, err := New(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if c, ok := w.(*CSV); ok && info.Size() > 0 {
+		if err := checkHeader(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("cannot append to %s: %w", fqpn, err)
+		}
+		c.header = true
+	}
+
+	return &File{Writer: w, Path: fqpn, f: f, size: info.Size()}, nil
+}
+
+// Appendable reports whether files of format can be appended to
+func Appendable(format string) bool {
+	return format == FormatNDJSON || format == FormatCSV
+}
+
+// Close flushes the writer, closes the file and moves it into place
+func (f *File) Close() error {
+	if f.f == nil {
+		return nil
+	}
+	err := f.Writer.Close()
+	if err == nil && f.tmp != "" {
+		// CreateTemp makes the file private; match os.Create
+		err = f.f.Chmod(0644)
+	}
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	f.f = nil
+
+	if f.tmp != "" {
+		if err == nil {
+			err = os.Rename(f.tmp, f.Path)
+		}
+		if err != nil {
+			os.Remove(f.tmp)
+		}
+	}
+	return err
+}
+
+// Abort closes the file without committing it: a new file is removed and
+// an appended file is cut back to its original length
+func (f *File) Abort() error {
+	if f.f == nil {
+		return nil
+	}
+	var err error
+	if f.tmp == "" {
+		err = f.f.Truncate(f.size)
+	}
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	f.f = nil
+
+	if f.tmp != "" {
+		err = os.Remove(f.tmp)
+	}
+	return err
+}
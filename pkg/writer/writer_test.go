@@ -0,0 +1,54 @@
+package writer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmrfslashbin/rtl-trino-analysis/pkg/rtl"
+)
+
+func appendRecord(path string) error {
+	f, err := Append(path, "")
+	if err != nil {
+		return err
+	}
+	if err := f.Write(&rtl.Record{Timestamp: time.Unix(1700000000, 0).UTC(), Host: "a.example.com"}); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Close()
+}
+
+func TestAppendCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.csv")
+
+	// A new file gets one header; a second append adds a row only
+	for i := 0; i < 2; i++ {
+		if err := appendRecord(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || lines[0] != strings.Join(rtl.FlatColumns, ",") {
+		t.Fatalf("got %d lines starting %q, want a header and two rows", len(lines), lines[0])
+	}
+
+	// A file written with an older column set is left alone
+	old := strings.Join(rtl.FlatColumns[:len(rtl.FlatColumns)-1], ",") + "\n1,2\n"
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendRecord(path); err == nil {
+		t.Error("appended to a CSV file with a different header")
+	}
+	if data, _ := os.ReadFile(path); string(data) != old {
+		t.Errorf("file changed to %q", data)
+	}
+}